@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/p9c/log"
+	"github.com/urfave/cli"
+
+	"github.com/p9c/glom/pkg/appdata"
+	"github.com/p9c/glom/pkg/apputil"
+	"github.com/p9c/glom/pkg/export"
+	"github.com/p9c/glom/pkg/fold"
+	"github.com/p9c/glom/pkg/grammar"
+	"github.com/p9c/glom/pkg/importer"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/settings"
+	"github.com/p9c/glom/pkg/undo"
+	"github.com/p9c/glom/version"
+)
+
+// options are the flags that apply to every command
+type options struct {
+	data  string
+	level string
+	theme string
+}
+
+// journals returns the directory the journals of files are kept in
+func (o *options) journals() string {
+	return filepath.Join(o.data, journal.DirName)
+}
+
+// folds returns the directory the fold states of files are kept in
+func (o *options) folds() string {
+	return filepath.Join(o.data, fold.DirName)
+}
+
+// grammars returns the directory the grammar files of languages are kept in
+func (o *options) grammars() string {
+	return filepath.Join(o.data, grammar.DirName)
+}
+
+// apply checks the global flags and sets up logging from them
+func (o *options) apply(c *cli.Context) (e error) {
+	if !contains(log.Levels, o.level) {
+		return cli.NewExitError(
+			fmt.Sprintf("log level %q is not one of %s", o.level, strings.Join(log.Levels, ", ")), 2,
+		)
+	}
+	if o.theme != "" && o.theme != "light" && o.theme != "dark" {
+		return cli.NewExitError(fmt.Sprintf("theme %q is not light or dark", o.theme), 2)
+	}
+	log.SetLogLevel(o.level)
+	return
+}
+
+// override changes the settings to the ones given on the command line
+func (o *options) override(st settings.Settings) settings.Settings {
+	if o.theme != "" {
+		st.Theme = o.theme
+	}
+	return st
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// app is the command line of glom. Without a command it opens the editor on the file or directory given as its
+// argument.
+func app() (a *cli.App) {
+	o := &options{}
+	a = cli.NewApp()
+	a.Name = "glom"
+	a.Usage = "a code editor for the visual thinkers"
+	a.Version = version.Get()
+	a.ArgsUsage = "[file or directory]"
+	a.Flags = []cli.Flag{
+		apputil.String(
+			"datadir", "directory glom keeps its settings and the journals and folds of files in",
+			appdata.Dir("glom", false), &o.data,
+		),
+		apputil.String("loglevel", "level of logging: "+strings.Join(log.Levels, ", "), log.Info, &o.level),
+		apputil.String("theme", "colors of the editor, light or dark, instead of the one in the settings", "", &o.theme),
+	}
+	a.Before = o.apply
+	a.Action = func(c *cli.Context) error { return run(c.Args().First(), o) }
+	a.Commands = apputil.SubCommands(
+		openCommand(o),
+		exportCommand(o),
+		importCommand(o),
+		replayCommand(o),
+		infoCommand(o),
+		compactCommand(o),
+	)
+	return
+}
+
+// openCommand opens the editor
+func openCommand(o *options) cli.Command {
+	return apputil.Command(
+		"open",
+		"edit the workspace of a file or directory, the current directory if none is given",
+		func(c *cli.Context) error { return run(c.Args().First(), o) },
+		nil,
+		nil,
+		"o",
+	)
+}
+
+// exportCommand assembles files from their journals for transmission
+func exportCommand(o *options) cli.Command {
+	var eo export.Options
+	return apputil.Command(
+		"export",
+		"write files as they are at a node of their history, or their notes as Markdown",
+		func(c *cli.Context) (e error) {
+			if c.NArg() == 0 {
+				return cli.NewExitError("export needs a file or journal", 2)
+			}
+			if eo.JournalDir == "" {
+				eo.JournalDir = o.journals()
+			}
+			if eo.Notes {
+				// grammar files that cannot be used are left out of the languages
+				var le error
+				if eo.Languages, le = grammar.Load(o.grammars()); E.Chk(le) {
+				}
+			}
+			var written []string
+			written, e = export.Export(c.Args(), eo)
+			for _, path := range written {
+				fmt.Println(path)
+			}
+			return
+		},
+		nil,
+		[]cli.Flag{
+			apputil.String("node", "ID or bookmark name of the node to export, the current node if empty", "", &eo.Node),
+			apputil.Bool("gofmt", "format Go files with gofmt before writing them", &eo.Gofmt),
+			apputil.Bool(
+				"notes", "write the files as Markdown with their notes, to their name with "+export.NotesExt+" added",
+				&eo.Notes,
+			),
+			apputil.String("out", "directory to write to instead of the files themselves", "", &eo.Out),
+			apputil.String(
+				"journals", "directory the journals of files are kept in, below the data directory if empty", "",
+				&eo.JournalDir,
+			),
+		},
+	)
+}
+
+// importCommand creates the journals of files written outside of glom
+func importCommand(o *options) cli.Command {
+	im := importer.Options{}
+	return apputil.Command(
+		"import",
+		"start the history of files, optionally from the git commits that changed them",
+		func(c *cli.Context) (e error) {
+			if c.NArg() == 0 {
+				return cli.NewExitError("import needs a file", 2)
+			}
+			if im.JournalDir == "" {
+				im.JournalDir = o.journals()
+			}
+			for _, file := range c.Args() {
+				var path string
+				if path, e = importer.Import(file, im); e != nil {
+					return fmt.Errorf("%s: %v", file, e)
+				}
+				fmt.Println(path)
+			}
+			return
+		},
+		nil,
+		[]cli.Flag{
+			apputil.Bool("git", "make a node of the history for each git commit that changed the file", &im.Git),
+			apputil.Bool("force", "replace the journal a file already has", &im.Force),
+			apputil.String(
+				"journals", "directory the journals of files are kept in, below the data directory if empty", "",
+				&im.JournalDir,
+			),
+		},
+	)
+}
+
+// replayCommand prints the edits that lead from the root of the history of a file to one of its nodes
+func replayCommand(o *options) cli.Command {
+	var node string
+	var text bool
+	return apputil.Command(
+		"replay",
+		"print the edits from the start of the history of a file or journal to a node",
+		func(c *cli.Context) (e error) {
+			if c.NArg() != 1 {
+				return cli.NewExitError("replay needs one file or journal", 2)
+			}
+			name := c.Args().First()
+			path, _ := export.Locate(name, o.journals())
+			if _, e = os.Stat(path); e != nil {
+				return fmt.Errorf("%s has no journal: %w", name, e)
+			}
+			var t *undo.Tree
+			if t, _, e = export.History(path, node); e != nil {
+				return fmt.Errorf("%s: %w", name, e)
+			}
+			var steps []*undo.Node
+			for n := t.Current(); n.Parent != nil; n = n.Parent {
+				steps = append([]*undo.Node{n}, steps...)
+			}
+			if e = t.Switch(t.Root().ID); e != nil {
+				return
+			}
+			for _, n := range steps {
+				if e = t.Switch(n.ID); e != nil {
+					return
+				}
+				fmt.Printf("node %d %s", n.ID, n.Time.Format(time.RFC3339))
+				if n.Name != "" {
+					fmt.Printf(" %q", n.Name)
+				}
+				fmt.Println()
+				for _, ev := range n.Events {
+					fmt.Printf("\t%s %v\n", ev.Author, ev)
+				}
+				if text {
+					fmt.Print(t.Doc().Text())
+				}
+			}
+			return
+		},
+		nil,
+		[]cli.Flag{
+			apputil.String("node", "ID or bookmark name of the node to replay to, the current node if empty", "", &node),
+			apputil.Bool("text", "print the document after each node", &text),
+		},
+	)
+}
+
+// infoCommand describes the journals of files
+func infoCommand(o *options) cli.Command {
+	return apputil.Command(
+		"journal-info",
+		"describe the journal of a file and the history in it",
+		func(c *cli.Context) (e error) {
+			if c.NArg() == 0 {
+				return cli.NewExitError("journal-info needs a file or journal", 2)
+			}
+			for _, name := range c.Args() {
+				path, _ := export.Locate(name, o.journals())
+				if _, e = os.Stat(path); e != nil {
+					return fmt.Errorf("%s has no journal: %w", name, e)
+				}
+				var in journal.Info
+				if in, e = journal.Inspect(path); e != nil {
+					return fmt.Errorf("%s: %w", name, e)
+				}
+				printInfo(in)
+			}
+			return
+		},
+		nil,
+		nil,
+	)
+}
+
+func printInfo(in journal.Info) {
+	fmt.Println("journal ", in.Path)
+	fmt.Println("file    ", in.File)
+	fmt.Println("size    ", in.Size, "bytes")
+	var kinds []string
+	for k := journal.NodeRecord; k <= journal.DiskRecord; k++ {
+		kinds = append(kinds, fmt.Sprintf("%d %s", in.Records[k], k))
+	}
+	fmt.Println("records ", strings.Join(kinds, ", "))
+	fmt.Printf("history  %d nodes, %d branches, %d events\n", in.Nodes, in.Branches, in.Events)
+	fmt.Printf("current  node %d at depth %d, %d runes\n", in.Current, in.Depth, in.Length)
+	if !in.First.IsZero() {
+		fmt.Println("edited  ", in.First.Format(time.RFC3339), "to", in.Last.Format(time.RFC3339))
+	}
+	if len(in.Bookmarks) > 0 {
+		fmt.Println("names   ", strings.Join(in.Bookmarks, ", "))
+	}
+}
+
+// compactCommand squashes the abandoned branches of the histories of files
+func compactCommand(o *options) cli.Command {
+	var age time.Duration
+	return apputil.Command(
+		"compact",
+		"squash the branches of the history of files that were left longer ago than an age",
+		func(c *cli.Context) (e error) {
+			if c.NArg() == 0 {
+				return cli.NewExitError("compact needs a file or journal", 2)
+			}
+			for _, name := range c.Args() {
+				path, _ := export.Locate(name, o.journals())
+				if _, e = os.Stat(path); e != nil {
+					return fmt.Errorf("%s has no journal: %w", name, e)
+				}
+				var st journal.Stats
+				if st, e = journal.CompactFile(path, age, time.Now()); e != nil {
+					return fmt.Errorf("%s: %w", name, e)
+				}
+				fmt.Printf(
+					"%s: %d to %d nodes, %d to %d bytes, %d nodes squashed\n",
+					name, st.Nodes[0], st.Nodes[1], st.Size[0], st.Size[1], st.Squashed,
+				)
+			}
+			return
+		},
+		nil,
+		[]cli.Flag{
+			apputil.Duration("age", "how long ago a branch must have been left to be squashed", 30*24*time.Hour, &age),
+		},
+	)
+}
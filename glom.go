@@ -1,35 +1,689 @@
 package main
 
 import (
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/clipboard"
+	"gioui.org/io/key"
+	"gioui.org/io/pointer"
 	l "gioui.org/layout"
+	"gioui.org/unit"
 	"github.com/p9c/gel"
 	"github.com/p9c/interrupt"
 	"github.com/p9c/qu"
+	
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/edit"
+	"github.com/p9c/glom/pkg/fold"
+	"github.com/p9c/glom/pkg/grammar"
+	"github.com/p9c/glom/pkg/highlight"
+	"github.com/p9c/glom/pkg/input"
+	"github.com/p9c/glom/pkg/keymap"
+	"github.com/p9c/glom/pkg/settings"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/ui"
+	"github.com/p9c/glom/pkg/workspace"
 )
 
 type State struct {
 	*gel.Window
+	// Buffer is the file shown in the editor, or an empty document when no file is open
+	*workspace.Buffer
+	Workspace *workspace.Workspace
+	Files     *ui.FileTree
+	Tabs      *ui.Tabs
+	Graph     *ui.UndoGraph
+	Text      *ui.TextView
+	Notes     *ui.NoteColumn
+	Input     *input.Editor
+	Keys      *keymap.Keymap
+	Settings  settings.Settings
+	view      *fold.View
+	// projected is what the view was made from, so that it is only made again when that changes
+	projected projection
+	hover     hover
+	drag      drag
+	// noting is the range of the segment a new note is being written for
+	noting [2]int
+	// focus takes the keys back from the note editor
+	focus bool
+	// follow scrolls the primary cursor into the view on the next frame
+	follow bool
+	// copied writes the register to the clipboard of the system, and pasting reads it from there on the next frame for
+	// the paste action it names, which paste keeps until the text arrives
+	copied         bool
+	pasting, paste string
 }
 
-func NewState() *State {
-	return &State{}
+// projection is a buffer with the length of the log of its document and the count of changes to its folds
+type projection struct {
+	buffer *workspace.Buffer
+	events int
+	folds  *fold.Set
+	change int
 }
 
-func main() {
-	state := NewState()
-	quit := qu.T()
+// hover is the segment highlighted under the pointer, level counts the segments outward from the innermost
+type hover struct {
+	on    bool
+	at    int
+	level int
+}
+
+// drag is a segment being dragged and the drop nearest the pointer
+type drag struct {
+	seg   *structure.Segment
+	drops []edit.Drop
+	drop  int
+}
+
+// NewState creates the editor of a workspace, showing an empty document until a file is opened
+func NewState(quit qu.C, w *workspace.Workspace) (s *State) {
+	s = &State{
+		Window:    ui.NewWindow(quit),
+		Buffer:    workspace.NewBuffer(),
+		Workspace: w,
+		focus:     true,
+	}
+	s.Graph = ui.NewUndoGraph(s.Window, s.History)
+	s.Text = ui.NewTextView(s.Window)
+	s.Input = input.NewEditor(s.Buffer)
+	s.Notes = ui.NewNoteColumn(s.Window).SetSubmit(s.annotate)
+	s.Files = ui.NewFileTree(s.Window).SetOpen(
+		func(path string) {
+			if e := s.Open(path); E.Chk(e) {
+			}
+		},
+	)
+	s.Tabs = ui.NewTabs(s.Window).SetSelect(s.selectTab).SetClose(s.closeTab)
+	s.Apply(settings.Default())
+	s.refresh()
+	return
+}
+
+// Apply changes the editor to the settings
+func (s *State) Apply(st settings.Settings) {
+	s.Settings = st
+	s.Workspace.Options.Fold = st.Fold
+	s.Colors.SetDarkTheme(st.Theme == "dark")
+	s.Input.TabWidth = st.TabWidth
+	s.Input.Paredit = st.Paredit
+	s.Text.Font(st.Font.Name).FontSize(unit.Sp(st.Font.Size)).TabWidth(st.TabWidth).Wrap(st.Wrap).Gutter(st.LineNumbers)
+	// bindings that cannot be used are left out of the keymap
 	var e error
+	if s.Keys, e = keymap.New(st); E.Chk(e) {
+	}
+}
+
+// Open shows a file in the editor, opening it in the workspace if it is not open yet
+func (s *State) Open(path string) (e error) {
+	var b *workspace.Buffer
+	if b, e = s.Workspace.Open(path); E.Chk(e) {
+		return
+	}
+	s.use(b)
+	s.refresh()
+	return
+}
+
+// use shows a buffer in the editor
+func (s *State) use(b *workspace.Buffer) {
+	s.Buffer = b
+	s.Input.Use(b)
+	s.Graph.Tree(b.History)
+	s.hover, s.drag, s.noting = hover{}, drag{}, [2]int{}
+	s.focus, s.follow = true, true
+}
+
+// refresh reads the files of the workspace again for the file tree
+func (s *State) refresh() {
+	root, e := s.Workspace.Tree()
+	if E.Chk(e) {
+		return
+	}
+	s.Files.Root(root)
+}
+
+// selectTab shows the buffer of a tab
+func (s *State) selectTab(i int) {
+	if buffers := s.Workspace.Buffers(); i < len(buffers) {
+		s.use(buffers[i])
+	}
+}
+
+// closeTab closes the buffer of a tab and shows the one before it, or an empty document after the last one
+func (s *State) closeTab(i int) {
+	buffers := s.Workspace.Buffers()
+	if i >= len(buffers) {
+		return
+	}
+	if e := buffers[i].SaveNotes(); E.Chk(e) {
+	}
+	if e := s.Workspace.Close(buffers[i]); E.Chk(e) {
+	}
+	if buffers[i] != s.Buffer {
+		return
+	}
+	if buffers = s.Workspace.Buffers(); len(buffers) == 0 {
+		s.use(workspace.NewBuffer())
+		return
+	}
+	if i > 0 {
+		i--
+	}
+	s.use(buffers[i])
+}
+
+// saveFolds stores the folds of the file the document was opened from
+func (s *State) saveFolds() {
+	if e := s.SaveFolds(s.Workspace.Options.FoldDir); E.Chk(e) {
+	}
+}
+
+// Fn renders the file tree beside the tabs of the open files, and under them the editor with the notes and the undo
+// graph beside it
+func (s *State) Fn(gtx l.Context) l.Dimensions {
+	// the keys are handled and the view is projected first as the rigid columns are laid out before the editor
+	s.keys(gtx)
+	if p := (projection{s.Buffer, s.Doc.Log().Len(), s.Folds, s.Folds.Changes()}); p != s.projected || s.view == nil {
+		s.view, s.projected = s.Folds.Project(s.Doc, s.Structure), p
+	}
+	var names []string
+	active := -1
+	for i, b := range s.Workspace.Buffers() {
+		names = append(names, filepath.Base(b.Path))
+		if b == s.Buffer {
+			active = i
+		}
+	}
+	s.Tabs.Tabs(names, active)
+	s.Files.Active(s.Path)
+	return s.Flex().
+		Rigid(s.Files.Fn).
+		Flexed(
+			1,
+			s.Flex().Vertical().
+				Rigid(s.Tabs.Fn).
+				Rigid(s.offer).
+				Flexed(
+					1,
+					s.Flex().
+						Flexed(1, s.editor).
+						Rigid(s.notes).
+						Rigid(s.Graph.Fn).
+						Fn,
+				).
+				Fn,
+		).
+		Fn(gtx)
+}
+
+// keys runs the actions bound to the keys pressed while the editor has the focus and types the text that is input
+func (s *State) keys(gtx l.Context) {
+	for _, ev := range gtx.Events(s) {
+		var handled bool
+		var e error
+		if ce, ok := ev.(clipboard.Event); ok {
+			s.Input.Register, handled = ce.Text, true
+			e = s.Input.Do(s.paste, false)
+		} else {
+			handled, e = s.Keys.Event(s, ev)
+		}
+		if e != nil {
+			D.Ln(e)
+		}
+		s.follow = s.follow || handled
+	}
+	if s.copied {
+		clipboard.WriteOp{Text: s.Input.Register}.Add(gtx.Ops)
+		s.copied = false
+	}
+	if s.pasting != "" {
+		clipboard.ReadOp{Tag: s}.Add(gtx.Ops)
+		s.paste, s.pasting = s.pasting, ""
+	}
+	key.InputOp{Tag: s}.Add(gtx.Ops)
+	if s.focus {
+		key.FocusOp{Tag: s}.Add(gtx.Ops)
+		s.focus = false
+	}
+}
+
+// Do runs an action of the editor for the keymap. Pasting waits for the text of the clipboard of the system, and text
+// that is copied or cut is put on it.
+func (s *State) Do(action string, extend bool) (e error) {
+	if strings.HasPrefix(action, "paste") {
+		s.pasting = action
+		return
+	}
+	register := s.Input.Register
+	e = s.Input.Do(action, extend)
+	s.copied = s.copied || s.Input.Register != register
+	return
+}
+
+// Type types text into the editor for the keymap
+func (s *State) Type(txt string) error {
+	return s.Input.Type(txt)
+}
+
+// editor renders the document, or the text of the node of the undo graph under the pointer
+func (s *State) editor(gtx l.Context) l.Dimensions {
+	txt, color := s.view.Text, "DocText"
+	preview, ok := s.Graph.Preview()
+	if ok {
+		txt, color = preview, "DocTextDim"
+	}
+	s.Text.Text(txt).Color(color)
+	if rows := s.Text.Rows(); rows > 1 {
+		s.Input.Page = rows - 1
+	}
+	s.pointer(gtx)
+	if !ok {
+		s.tint()
+		s.highlight()
+		s.indicate()
+		s.cursors()
+	}
+	return s.Inset(0.5, s.Text.Fn).Fn(gtx)
+}
+
+// tint colors the tokens of the document in the rows in the view in the colors of the theme for their classes
+func (s *State) tint() {
+	start, end := s.Text.Visible()
+	colors := make(map[highlight.Class]color.NRGBA)
+	for _, t := range s.Highlight.Tokens(s.view.Source(start), s.view.Source(end)) {
+		if t.Class == highlight.Plain || s.view.Hidden(t.Start) {
+			continue
+		}
+		c, ok := colors[t.Class]
+		if !ok {
+			c = s.Colors.GetNRGBAFromName(t.Class.Color())
+			colors[t.Class] = c
+		}
+		s.Text.Tint(s.view.Display(t.Start), s.view.Display(t.End), c)
+	}
+}
+
+// cursors shades the selected text and marks the carets, and scrolls the primary caret into the view after it moved
+func (s *State) cursors() {
+	shade, bar := s.Colors.GetNRGBAFromName("Secondary"), s.Colors.GetNRGBAFromName("DocText")
+	shade.A /= 3
+	for _, r := range s.Selection.Ranges() {
+		if !r.Empty() {
+			s.Text.Highlight(s.view.Display(r.Start()), s.view.Display(r.End()), shade)
+		}
+		if at := s.view.Display(r.Caret); s.Keys.Mode().Insert {
+			s.Text.Bar(at, bar)
+		} else {
+			// in modes that do not take text the caret is a block on the character it is on
+			block := bar
+			block.A /= 2
+			s.Text.Highlight(at, at+1, block)
+		}
+	}
+	if s.follow {
+		s.Text.ScrollTo(s.view.Display(s.Selection.Primary().Caret))
+		s.follow = false
+	}
+}
+
+// offer lays out the ways the register can be pasted, when the last paste was unbalanced and pasted nothing
+func (s *State) offer(gtx l.Context) l.Dimensions {
+	o := s.Input.Offer
+	if o == nil {
+		return l.Dimensions{}
+	}
+	txt := "The pasted text is unbalanced:"
+	if o.Extended != "" {
+		txt += fmt.Sprintf(" paste-extended pastes %q,", o.Extended)
+	}
+	if o.Wrapped != "" {
+		txt += fmt.Sprintf(" paste-wrapped pastes %q,", o.Wrapped)
+	}
+	txt += " paste-raw pastes it as it is"
+	return s.Inset(0.25, s.Body2(txt).Color("Warning").MaxLines(1).Fn).Fn(gtx)
+}
+
+// notes renders the notes of the document beside their segments, when there are any
+func (s *State) notes(gtx l.Context) l.Dimensions {
+	var notes []ui.Note
+	for _, a := range annotate.Resolve(s.Doc, s.Structure) {
+		notes = append(notes, ui.Note{ID: a.ID, Text: a.Text, Y: s.Text.Caret(s.view.Display(a.Segment.Start())).Y})
+	}
+	if _, editing := s.Notes.Editing(); len(notes) == 0 && !editing {
+		return l.Dimensions{}
+	}
+	return s.Inset(0.5, s.Notes.Notes(notes).Fn).Fn(gtx)
+}
+
+// note opens the note of the highlighted segment for editing, or starts a new one
+func (s *State) note() {
+	seg := s.selected()
+	if seg == nil {
+		return
+	}
+	y := s.Text.Caret(s.view.Display(seg.Start())).Y
+	if n, ok := annotate.Find(s.Doc, seg); ok {
+		s.Notes.Edit(n.ID, n.Text, y)
+		return
+	}
+	s.noting = [2]int{seg.Start(), seg.Len}
+	s.Notes.Edit(annotate.NewID(s.Doc), "", y)
+}
+
+// annotate records the text of a note from the note editor, and writes the notes to the sidecar of the file
+func (s *State) annotate(id, txt string) {
+	var e error
+	defer func() {
+		if e = s.SaveNotes(); E.Chk(e) {
+		}
+	}()
+	if _, ok := s.Doc.Note(id); ok {
+		if e = annotate.Change(s.History, id, txt); E.Chk(e) {
+		}
+		return
+	}
+	if txt == "" {
+		return
+	}
+	seg := s.Structure.EnclosingRange(s.noting[0], s.noting[0]+s.noting[1])
+	for _, sg := range s.Structure.Path(s.noting[0])[1:] {
+		if sg.Start() == s.noting[0] && sg.Len == s.noting[1] {
+			seg = sg
+			break
+		}
+	}
+	if e = annotate.Set(s.History, seg, id, txt); E.Chk(e) {
+	}
+}
+
+// pointer tracks the position of the pointer over the text and the level the scroll wheel has selected
+func (s *State) pointer(gtx l.Context) {
+	for _, ev := range gtx.Events(s.Text) {
+		pe, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch pe.Type {
+		case pointer.Leave:
+			s.hover.on = false
+		case pointer.Cancel:
+			s.hover.on = false
+			s.drag = drag{}
+		case pointer.Press:
+			switch {
+			case pe.Buttons.Contain(pointer.ButtonSecondary):
+				s.focus = true
+				s.fold(pe.Modifiers.Contain(key.ModShortcut))
+			case pe.Buttons.Contain(pointer.ButtonPrimary) && pe.Modifiers.Contain(key.ModShortcut):
+				s.note()
+			case pe.Buttons.Contain(pointer.ButtonPrimary):
+				s.focus = true
+				s.click(s.at(pe.Position), pe.Modifiers)
+				s.press()
+			}
+		case pointer.Drag:
+			s.dragTo(s.at(pe.Position), pe.Position)
+		case pointer.Release:
+			s.release()
+		case pointer.Move, pointer.Enter:
+			if at := s.at(pe.Position); at != s.hover.at || !s.hover.on {
+				s.hover = hover{on: true, at: at}
+			}
+		case pointer.Scroll:
+			if !pe.Modifiers.Contain(key.ModShortcut) {
+				s.Text.ScrollBy(int(pe.Scroll.Y))
+				s.hover.at = s.at(pe.Position)
+				break
+			}
+			// scrolling up with the shortcut key widens the highlight to the enclosing segment and scrolling down
+			// narrows it again
+			switch {
+			case pe.Scroll.Y < 0:
+				s.hover.level++
+			case pe.Scroll.Y > 0 && s.hover.level > 0:
+				s.hover.level--
+			}
+		}
+	}
+}
+
+// click places the cursor at the offset, or with shift moves the caret of the primary range there and with alt adds a
+// cursor there
+func (s *State) click(at int, mods key.Modifiers) {
+	switch {
+	case mods.Contain(key.ModShift):
+		p := s.Selection.Primary()
+		s.Selection.Map(
+			func(_ int, r doc.Range) doc.Range {
+				if r == p {
+					r.Caret = at
+				}
+				return r
+			},
+		)
+	case mods.Contain(key.ModAlt):
+		s.Selection.Add(doc.Cursor(at))
+	default:
+		s.Selection.Set(doc.Cursor(at))
+	}
+}
+
+// at returns the offset of the document under a position in the text view
+func (s *State) at(p f32.Point) int {
+	return s.view.Source(s.Text.OffsetAt(p))
+}
+
+// fold folds or unfolds the highlighted segment. With the shortcut modifier everything below the level of the
+// segment is folded instead, or everything is unfolded if no segment is highlighted.
+func (s *State) fold(all bool) {
+	seg := s.selected()
+	switch {
+	case all && seg == nil:
+		s.Folds.UnfoldAll()
+	case all:
+		s.Folds.FoldTo(s.Doc, s.Structure, seg.Depth()-1)
+	case seg == nil:
+		return
+	default:
+		s.Folds.Toggle(seg)
+	}
+	s.saveFolds()
+}
+
+// press picks up the highlighted segment if it has anywhere to go
+func (s *State) press() {
+	seg := s.selected()
+	if seg == nil {
+		return
+	}
+	all, e := edit.Drops(s.Doc, seg)
+	var drops []edit.Drop
+	for _, d := range all {
+		// drops inside folded segments are out of sight
+		if !s.view.Hidden(d.At) {
+			drops = append(drops, d)
+		}
+	}
+	if e != nil || len(drops) == 0 {
+		D.Ln("segment cannot be dragged:", e)
+		return
+	}
+	s.drag = drag{seg: seg, drops: drops, drop: -1}
+}
+
+// dragTo picks the drop closest to the pointer
+func (s *State) dragTo(at int, p f32.Point) {
+	if s.drag.seg == nil {
+		return
+	}
+	s.drag.drop = -1
+	if at >= s.drag.seg.Start() && at < s.drag.seg.End() {
+		// over the segment itself it stays where it is
+		return
+	}
+	best := 0
+	for i, d := range s.drag.drops {
+		c := s.Text.Caret(s.view.Display(d.At))
+		dx, dy := int(p.X)-c.X, int(p.Y)-c.Y
+		// a line away is further than anything on the same line
+		dist := dx*dx + dy*dy*64
+		if s.drag.drop < 0 || dist < best {
+			s.drag.drop, best = i, dist
+		}
+	}
+}
+
+// release drops the dragged segment at the chosen drop
+func (s *State) release() {
+	d := s.drag
+	s.drag = drag{}
+	if d.seg == nil || d.drop < 0 {
+		return
+	}
+	var e error
+	if e = edit.Move(s.History, d.seg, d.drops[d.drop]); E.Chk(e) {
+	}
+}
+
+// enforced returns the segments that a drag at the offset keeps intact, from the outermost to the innermost. The
+// segments inside a folded segment are out of sight.
+func (s *State) enforced(at int) (segs []*structure.Segment) {
+	for _, seg := range s.Structure.Path(at)[1:] {
+		if seg.Container() {
+			segs = append(segs, seg)
+		}
+		if s.Folds.Folded(seg) {
+			break
+		}
+	}
+	return
+}
+
+// selected returns the segment under the pointer at the selected level
+func (s *State) selected() *structure.Segment {
+	if !s.hover.on {
+		return nil
+	}
+	segs := s.enforced(s.hover.at)
+	if len(segs) == 0 {
+		return nil
+	}
+	if s.hover.level >= len(segs) {
+		s.hover.level = len(segs) - 1
+	}
+	return segs[len(segs)-1-s.hover.level]
+}
+
+// highlight shades the segment under the pointer at the selected level, and fainter the segments nested inside it
+func (s *State) highlight() {
+	sel := s.selected()
+	if s.drag.seg != nil {
+		sel = s.drag.seg
+	}
+	if sel == nil {
+		return
+	}
+	base := s.Colors.GetNRGBAFromName("Primary")
+	var shade func(seg *structure.Segment, alpha float32)
+	shade = func(seg *structure.Segment, alpha float32) {
+		if alpha < 1.0/64 {
+			return
+		}
+		c := base
+		c.A = uint8(float32(c.A) * alpha)
+		s.Text.Highlight(s.view.Display(seg.Start()), s.view.Display(seg.End()), c)
+		if s.Folds.Folded(seg) {
+			return
+		}
+		for _, ch := range seg.Children {
+			if ch.Container() {
+				shade(ch, alpha/2)
+			}
+		}
+	}
+	shade(sel, 0.25)
+}
+
+// indicate draws a bar where the dragged segment would be dropped
+func (s *State) indicate() {
+	if s.drag.seg == nil || s.drag.drop < 0 {
+		return
+	}
+	s.Text.Bar(s.view.Display(s.drag.drops[s.drag.drop].At), s.Colors.GetNRGBAFromName("Secondary"))
+}
+
+// run opens the editor window on the workspace a path is in, showing the file if the path is one
+func run(path string, o *options) (e error) {
+	if path == "" {
+		path = "."
+	}
+	var info os.FileInfo
+	if info, e = os.Stat(path); e != nil {
+		return
+	}
+	root := workspace.Root(path)
+	// grammar files that cannot be used are left out of the languages
+	languages, le := grammar.Load(o.grammars())
+	if E.Chk(le) {
+	}
+	var w *workspace.Workspace
+	if w, e = workspace.Open(
+		root, workspace.Options{
+			JournalDir: o.journals(), FoldDir: o.folds(), Fold: settings.Default().Fold, Languages: languages,
+		},
+	); E.Chk(e) {
+		return
+	}
+	defer func() {
+		for _, b := range w.Buffers() {
+			if se := b.SaveNotes(); E.Chk(se) {
+			}
+		}
+		if ce := w.CloseAll(); E.Chk(ce) {
+		}
+	}()
+	watcher := settings.NewWatcher(o.data, settings.Workspace(root))
+	st := watcher.Start()
+	quit := qu.T()
+	state := NewState(quit, w)
+	state.Apply(o.override(st))
+	if !info.IsDir() {
+		if e = state.Open(path); E.Chk(e) {
+			return
+		}
+	}
+	watcher.Watch(time.Second, quit, func(st settings.Settings) {
+		state.Runner <- func() error {
+			state.Apply(o.override(st))
+			state.Window.Window.Invalidate()
+			return nil
+		}
+	})
 	if e = state.Window.
-		Size(20, 20).
+		Size(float32(st.Window.Width), float32(st.Window.Height)).
 		Title("glom, the visual code editor").
 		Open().
-		Run(func(gtx l.Context) l.Dimensions {
-			return l.Dimensions{}
-		},
+		Run(state.Fn,
 			nil, func() {
 				interrupt.Request()
 			}, quit,
 		); E.Chk(e) {
 		
 	}
+	return
+}
+
+func main() {
+	if e := app().Run(os.Args); E.Chk(e) {
+		os.Exit(1)
+	}
 }
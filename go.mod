@@ -8,7 +8,9 @@ require (
 	github.com/p9c/gel v0.1.9
 	github.com/p9c/interrupt v0.0.1
 	github.com/p9c/log v0.0.6
+	github.com/p9c/opts v0.0.5
 	github.com/p9c/qu v0.0.3
 	github.com/urfave/cli v1.22.5
+	golang.org/x/image v0.0.0-20200927104501-e162460cd6b5
 	gopkg.in/src-d/go-git.v4 v4.13.1
 )
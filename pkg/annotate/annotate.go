@@ -0,0 +1,96 @@
+// Package annotate attaches notes to the segments of a document. A note is anchored to the range of its segment, so it
+// follows the segment wherever it is moved, and every change to a note is an event in the history of the document
+// that can be undone like any edit of the code.
+package annotate
+
+import (
+	"strconv"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// Anchored is a note with the segment it is attached to
+type Anchored struct {
+	doc.Note
+	Segment *structure.Segment
+}
+
+// NewID returns an identifier for a new note on the document
+func NewID(d *doc.Document) string {
+	id := strconv.FormatInt(d.Clock().UnixNano(), 36)
+	for {
+		if _, ok := d.Note(id); !ok {
+			return id
+		}
+		id += "x"
+	}
+}
+
+// Set gives the segment a note with the body as a single step of the history. A note that was anchored elsewhere is
+// anchored to the segment, and an empty body removes the note.
+func Set(h *undo.Tree, seg *structure.Segment, id, body string) (e error) {
+	_, e = h.Edit(func(d *doc.Document) error { return d.Annotate(id, seg.Start(), seg.Len, body) })
+	return
+}
+
+// Change sets the body of an existing note without moving it, as a single step of the history. An empty body removes
+// the note.
+func Change(h *undo.Tree, id, body string) (e error) {
+	n, ok := h.Doc().Note(id)
+	if !ok || n.Text == body {
+		return
+	}
+	_, e = h.Edit(func(d *doc.Document) error { return d.Annotate(id, n.Offset, n.Length, body) })
+	return
+}
+
+// Remove deletes a note as a single step of the history
+func Remove(h *undo.Tree, id string) (e error) {
+	return Change(h, id, "")
+}
+
+// Find returns the note anchored to the segment
+func Find(d *doc.Document, seg *structure.Segment) (n doc.Note, ok bool) {
+	for _, n = range d.Notes() {
+		if n.Offset == seg.Start() && n.Length == seg.Len {
+			return n, true
+		}
+	}
+	return doc.Note{}, false
+}
+
+// Resolve returns the notes of the document in order with the segments they are attached to. A note whose range is no
+// longer a segment, after edits inside it, is attached to the innermost segment containing it.
+func Resolve(d *doc.Document, t *structure.Tree) (out []Anchored) {
+	for _, n := range d.Notes() {
+		a := Anchored{Note: n}
+		for _, seg := range t.Path(n.Offset)[1:] {
+			if seg.Start() == n.Offset && seg.Len == n.Length {
+				a.Segment = seg
+				break
+			}
+		}
+		if a.Segment == nil {
+			a.Segment = t.EnclosingRange(n.Offset, n.Offset+n.Length)
+		}
+		out = append(out, a)
+	}
+	return
+}
+
+// Stack places boxes of the given heights in order at the wanted positions, moving each down as far as it needs to not
+// overlap the one before it with a gap between them
+func Stack(want, heights []int, gap int) (ys []int) {
+	ys = make([]int, len(want))
+	next := 0
+	for i := range want {
+		ys[i] = want[i]
+		if i > 0 && ys[i] < next {
+			ys[i] = next
+		}
+		next = ys[i] + heights[i] + gap
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package annotate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/edit"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/structure/golang"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+const src = `package main
+
+func f() {
+	a := 1
+	b(a, 2)
+	c()
+}
+`
+
+// statement returns the statement segment starting with the prefix
+func statement(t *testing.T, d *doc.Document, tr *structure.Tree, prefix string) *structure.Segment {
+	at := len([]rune(d.Text()[:strings.Index(d.Text(), prefix)]))
+	for _, s := range tr.Path(at) {
+		if s.Start() == at && s.Parent != nil && s.Parent.Label == "block" {
+			return s
+		}
+	}
+	t.Fatalf("no statement at %q", prefix)
+	return nil
+}
+
+func TestNotesFollowMoves(t *testing.T) {
+	d := doc.New()
+	h := undo.New(d)
+	if _, e := h.Commit(doc.Event{Kind: doc.Insert, Text: src}); e != nil {
+		t.Fatal(e)
+	}
+	tr := golang.Parse(d)
+	d.Watch(func(ev doc.Event) { tr.Apply(d, ev) })
+	id := annotate.NewID(d)
+	if e := annotate.Set(h, statement(t, d, tr, "b(a"), id, "calls b"); e != nil {
+		t.Fatal(e)
+	}
+	seg := statement(t, d, tr, "b(a")
+	if n, ok := annotate.Find(d, seg); !ok || n.Text != "calls b" {
+		t.Fatalf("the note is not on its segment: %v", d.Notes())
+	}
+	drops, e := edit.Drops(d, seg)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = edit.Move(h, seg, drops[len(drops)-1]); e != nil {
+		t.Fatal(e)
+	}
+	notes := annotate.Resolve(d, tr)
+	if len(notes) != 1 || notes[0].Segment != statement(t, d, tr, "b(a") {
+		t.Fatalf("the note did not follow its segment to %q: %v", d.Text(), notes)
+	}
+	// the move and then the note are undone step by step
+	if e = h.Undo(); e != nil {
+		t.Fatal(e)
+	}
+	if n, ok := annotate.Find(d, statement(t, d, tr, "b(a")); !ok || n.ID != id {
+		t.Errorf("the note did not return with its segment: %v", d.Notes())
+	}
+	if e = h.Undo(); e != nil {
+		t.Fatal(e)
+	}
+	if len(d.Notes()) != 0 {
+		t.Errorf("undoing the note left %v", d.Notes())
+	}
+	if e = h.Redo(); e != nil {
+		t.Fatal(e)
+	}
+	if e = annotate.Set(h, statement(t, d, tr, "c()"), id, "calls c"); e != nil {
+		t.Fatal(e)
+	}
+	if n, ok := annotate.Find(d, statement(t, d, tr, "c()")); !ok || n.Text != "calls c" || len(d.Notes()) != 1 {
+		t.Errorf("the note was not anchored again: %v", d.Notes())
+	}
+	if e = annotate.Change(h, id, "calls c()"); e != nil {
+		t.Fatal(e)
+	}
+	if n, _ := d.Note(id); n.Text != "calls c()" || n.Offset != statement(t, d, tr, "c()").Start() {
+		t.Errorf("the note was not changed in place: %v", n)
+	}
+	if e = annotate.Remove(h, id); e != nil || len(d.Notes()) != 0 {
+		t.Errorf("removing the note left %v, %v", d.Notes(), e)
+	}
+}
+
+func TestStack(t *testing.T) {
+	got := annotate.Stack([]int{0, 5, 40, 41}, []int{20, 10, 10, 10}, 2)
+	for i, want := range []int{0, 22, 40, 52} {
+		if got[i] != want {
+			t.Fatalf("stacked at %v", got)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package annotate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/fold"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// SidecarVersion is the version of the sidecar format written by this package
+const SidecarVersion = 1
+
+// Sidecar is the notes of a source file in a form that can be stored next to it and read without glom
+type Sidecar struct {
+	Version int        `json:"version"`
+	Notes   []Exported `json:"notes"`
+}
+
+// Exported is a note with enough of its segment to find it again after the source was changed
+type Exported struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+	// Offset and Length are the range of the segment in runes when the notes were exported
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Label  string `json:"label"`
+	// Anchor is the text of the segment and Summary its folded form, which still matches when only the inside of the
+	// segment was changed
+	Anchor  string `json:"anchor"`
+	Summary string `json:"summary"`
+}
+
+// SidecarPath returns the path of the sidecar file of a source file
+func SidecarPath(file string) string {
+	return file + ".notes.json"
+}
+
+// Export returns the sidecar of the notes of the document
+func Export(d *doc.Document, t *structure.Tree) (sc Sidecar) {
+	sc.Version = SidecarVersion
+	for _, a := range Resolve(d, t) {
+		sc.Notes = append(
+			sc.Notes, Exported{
+				ID:      a.ID,
+				Text:    a.Text,
+				Offset:  a.Offset,
+				Length:  a.Length,
+				Label:   a.Segment.Label,
+				Anchor:  d.Slice(a.Offset, a.Offset+a.Length),
+				Summary: fold.Summary(d, a.Segment),
+			},
+		)
+	}
+	return
+}
+
+// WriteSidecar writes the notes of the document to a sidecar file
+func WriteSidecar(path string, d *doc.Document, t *structure.Tree) (e error) {
+	var b []byte
+	if b, e = json.MarshalIndent(Export(d, t), "", "\t"); E.Chk(e) {
+		return
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// ReadSidecar reads a sidecar file. A missing file has no notes.
+func ReadSidecar(path string) (sc Sidecar, e error) {
+	var b []byte
+	if b, e = ioutil.ReadFile(path); e != nil {
+		if os.IsNotExist(e) {
+			return Sidecar{Version: SidecarVersion}, nil
+		}
+		return
+	}
+	if e = json.Unmarshal(b, &sc); e != nil {
+		return
+	}
+	if sc.Version > SidecarVersion {
+		e = fmt.Errorf("sidecar version %d is newer than %d", sc.Version, SidecarVersion)
+	}
+	return
+}
+
+// Import anchors the notes of a sidecar to the document as a single step of the history. Each note goes to the
+// segment nearest to where it was with the same label and text, or failing that the same summary, or to the segment
+// around the first place its text is found. Notes that cannot be placed are returned as lost.
+func Import(h *undo.Tree, t *structure.Tree, sc Sidecar) (lost []Exported, e error) {
+	d := h.Doc()
+	type placed struct {
+		ex  Exported
+		seg *structure.Segment
+	}
+	var found []placed
+	for _, ex := range sc.Notes {
+		if seg := reanchor(d, t, ex); seg != nil {
+			found = append(found, placed{ex, seg})
+		} else {
+			lost = append(lost, ex)
+		}
+	}
+	_, e = h.Edit(
+		func(d *doc.Document) (e error) {
+			for _, p := range found {
+				if e = d.Annotate(p.ex.ID, p.seg.Start(), p.seg.Len, p.ex.Text); e != nil {
+					return
+				}
+			}
+			return
+		},
+	)
+	return
+}
+
+// reanchor finds the segment an exported note belongs to in the document
+func reanchor(d *doc.Document, t *structure.Tree, ex Exported) (seg *structure.Segment) {
+	for _, match := range []func(s *structure.Segment) bool{
+		func(s *structure.Segment) bool { return d.Slice(s.Start(), s.End()) == ex.Anchor },
+		func(s *structure.Segment) bool { return fold.Summary(d, s) == ex.Summary },
+	} {
+		best := -1
+		t.Walk(
+			func(s *structure.Segment) bool {
+				if s.Parent == nil || s.Label != ex.Label || !match(s) {
+					return true
+				}
+				if dist := abs(s.Start() - ex.Offset); best < 0 || dist < best {
+					seg, best = s, dist
+				}
+				return true
+			},
+		)
+		if seg != nil {
+			return
+		}
+	}
+	if ex.Anchor == "" {
+		return
+	}
+	txt := d.Text()
+	if i := strings.Index(txt, ex.Anchor); i >= 0 {
+		start := len([]rune(txt[:i]))
+		if seg = t.EnclosingRange(start, start+len([]rune(ex.Anchor))); seg.Parent == nil {
+			seg = nil
+		}
+	}
+	return
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// Markdown writes the document as fenced code blocks with its notes between them. Each note follows the code up to
+// the line its segment starts on, headed by the summary of the segment as inline code. The fences and the quotes of
+// the summaries are runs of backticks longer than any in what they hold, so the code and the summaries come out as
+// they are whatever they contain, and the notes are written as the Markdown they are.
+func Markdown(w io.Writer, d *doc.Document, t *structure.Tree, lang string) (e error) {
+	txt := []rune(d.Text())
+	var sb strings.Builder
+	at := 0
+	code := func(end int) {
+		if block := strings.Trim(string(txt[at:end]), "\n"); block != "" {
+			f := ticks(block, 3)
+			fmt.Fprintf(&sb, "%s%s\n%s\n%s\n\n", f, lang, block, f)
+		}
+		at = end
+	}
+	for _, a := range Resolve(d, t) {
+		line := a.Segment.Start()
+		for line > 0 && txt[line-1] != '\n' {
+			line--
+		}
+		if line > at {
+			code(line)
+		}
+		summary := strings.ReplaceAll(fold.Summary(d, a.Segment), "\n", " ")
+		q := ticks(summary, 1)
+		if strings.HasPrefix(summary, "`") || strings.HasSuffix(summary, "`") {
+			// a code span drops one space from each side, which keeps the backticks apart from its quotes
+			summary = " " + summary + " "
+		}
+		fmt.Fprintf(&sb, "> %s%s%s\n>\n", q, summary, q)
+		for _, l := range strings.Split(a.Text, "\n") {
+			sb.WriteString(strings.TrimRight("> "+l, " ") + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	code(len(txt))
+	_, e = io.WriteString(w, strings.TrimRight(sb.String(), "\n")+"\n")
+	return
+}
+
+// ticks returns a run of backticks longer than any in the text and at least min long
+func ticks(txt string, min int) string {
+	n, run := min, 0
+	for _, r := range txt {
+		if r != '`' {
+			run = 0
+			continue
+		}
+		if run++; run >= n {
+			n = run + 1
+		}
+	}
+	return strings.Repeat("`", n)
+}
@@ -0,0 +1,113 @@
+package annotate_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/structure/golang"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// open loads a text into a new document with its history and structure
+func open(t *testing.T, txt string) (h *undo.Tree, tr *structure.Tree) {
+	d := doc.New()
+	h = undo.New(d)
+	if _, e := h.Commit(doc.Event{Kind: doc.Insert, Text: txt}); e != nil {
+		t.Fatal(e)
+	}
+	tr = golang.Parse(d)
+	d.Watch(func(ev doc.Event) { tr.Apply(d, ev) })
+	return
+}
+
+func TestMarkdown(t *testing.T) {
+	h, tr := open(t, src)
+	if e := annotate.Set(h, statement(t, h.Doc(), tr, "b(a"), "n1", "calls b\n\ntwice"); e != nil {
+		t.Fatal(e)
+	}
+	var buf bytes.Buffer
+	if e := annotate.Markdown(&buf, h.Doc(), tr, "go"); e != nil {
+		t.Fatal(e)
+	}
+	want := "```go\npackage main\n\nfunc f() {\n\ta := 1\n```\n\n" +
+		"> `b(...)`\n>\n> calls b\n>\n> twice\n\n" +
+		"```go\n\tb(a, 2)\n\tc()\n}\n```\n"
+	if buf.String() != want {
+		t.Errorf("markdown is\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestSidecar(t *testing.T) {
+	h, tr := open(t, src)
+	for id, prefix := range map[string]string{"n1": "b(a", "n2": "c()", "n3": "a := 1"} {
+		if e := annotate.Set(h, statement(t, h.Doc(), tr, prefix), id, "about "+prefix); e != nil {
+			t.Fatal(e)
+		}
+	}
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	path := annotate.SidecarPath(filepath.Join(dir, "main.go"))
+	if e = annotate.WriteSidecar(path, h.Doc(), tr); e != nil {
+		t.Fatal(e)
+	}
+	var sc annotate.Sidecar
+	if sc, e = annotate.ReadSidecar(path); e != nil || len(sc.Notes) != 3 {
+		t.Fatalf("read %v, %v", sc, e)
+	}
+	// the source is changed outside glom: a line is added in front, a call gets a new argument and a statement is
+	// removed
+	edited := strings.Replace(src, "func f", "// f does things\nfunc f", 1)
+	edited = strings.Replace(edited, "b(a, 2)", "b(a, 3)", 1)
+	edited = strings.Replace(edited, "\ta := 1\n", "", 1)
+	h, tr = open(t, edited)
+	lost, e := annotate.Import(h, tr, sc)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(lost) != 1 || lost[0].ID != "n3" {
+		t.Errorf("lost notes are %v", lost)
+	}
+	for id, prefix := range map[string]string{"n1": "b(a", "n2": "c()"} {
+		if n, ok := annotate.Find(h.Doc(), statement(t, h.Doc(), tr, prefix)); !ok || n.ID != id {
+			t.Errorf("%s was not anchored to %q: %v", id, prefix, h.Doc().Notes())
+		}
+	}
+	if e = h.Undo(); e != nil || len(h.Doc().Notes()) != 0 {
+		t.Errorf("the import is not a single step: %v, %v", h.Doc().Notes(), e)
+	}
+}
+
+// TestMarkdownBackticks checks that backticks in the code and in the summaries of segments, even at their ends, do not
+// end their fences and quotes
+func TestMarkdownBackticks(t *testing.T) {
+	h, tr := open(t, "package main\n\n// ``` is a fence\nfunc f() {\n\ta := \"`\"\n\tb := \"x``y\"\n\tc := `x`\n}\n")
+	for id, prefix := range map[string]string{"n1": "a :=", "n2": "b :=", "n3": "c :="} {
+		if e := annotate.Set(h, statement(t, h.Doc(), tr, prefix), id, "about "+prefix); e != nil {
+			t.Fatal(e)
+		}
+	}
+	var buf bytes.Buffer
+	if e := annotate.Markdown(&buf, h.Doc(), tr, "go"); e != nil {
+		t.Fatal(e)
+	}
+	want := "````go\npackage main\n\n// ``` is a fence\nfunc f() {\n````\n\n" +
+		"> ``a := \"`\"``\n>\n> about a :=\n\n" +
+		"```go\n\ta := \"`\"\n```\n\n" +
+		"> ```b := \"x``y\"```\n>\n> about b :=\n\n" +
+		"```go\n\tb := \"x``y\"\n```\n\n" +
+		"> `` c := `x` ``\n>\n> about c :=\n\n" +
+		"```go\n\tc := `x`\n}\n```\n"
+	if buf.String() != want {
+		t.Errorf("markdown is\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,185 @@
+// Package diff computes the differences between two texts line by line using the Myers algorithm.
+package diff
+
+import (
+	"strings"
+)
+
+// Op is the kind of change a chunk represents
+type Op uint8
+
+const (
+	// Equal lines are present in both texts
+	Equal Op = iota
+	// Insert lines are only present in the second text
+	Insert
+	// Delete lines are only present in the first text
+	Delete
+)
+
+// Chunk is a run of lines with the same operation
+type Chunk struct {
+	Op    Op
+	Lines []string
+}
+
+// Lines splits both texts into lines and returns the chunks that turn a into b. Each line keeps its line ending so the
+// chunks concatenate back into the original texts.
+func Lines(a, b string) []Chunk {
+	return Strings(split(a), split(b))
+}
+
+// Strings returns the chunks that turn the sequence a into b
+func Strings(a, b []string) []Chunk {
+	return myers(nil, a, b)
+}
+
+// Format renders the chunks with a leading space, + or - on every line
+func Format(chunks []Chunk) string {
+	var sb strings.Builder
+	for _, c := range chunks {
+		prefix := " "
+		switch c.Op {
+		case Insert:
+			prefix = "+"
+		case Delete:
+			prefix = "-"
+		}
+		for _, line := range c.Lines {
+			sb.WriteString(prefix)
+			sb.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// Text joins the lines of a chunk
+func (c Chunk) Text() string {
+	return strings.Join(c.Lines, "")
+}
+
+func split(s string) (out []string) {
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			out = append(out, s)
+			break
+		}
+		out = append(out, s[:i+1])
+		s = s[i+1:]
+	}
+	return
+}
+
+func appendChunk(out []Chunk, op Op, lines ...string) []Chunk {
+	if len(lines) == 0 {
+		return out
+	}
+	if len(out) > 0 && out[len(out)-1].Op == op {
+		out[len(out)-1].Lines = append(out[len(out)-1].Lines, lines...)
+		return out
+	}
+	return append(out, Chunk{Op: op, Lines: append([]string{}, lines...)})
+}
+
+// myers appends the chunks of a shortest edit script between a and b. It splits them where a shortest script crosses
+// the middle of its edits and recurses on either side, so that it needs memory linear in the lengths of the sequences
+// rather than in the number of edits times their lengths.
+func myers(out []Chunk, a, b []string) []Chunk {
+	// strip the common prefix and suffix, which is the common case for small edits to large files
+	var pre int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	var suf int
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	out = appendChunk(out, Equal, a[:pre]...)
+	same := a[len(a)-suf:]
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+	x, y := -1, -1
+	if len(a) > 0 && len(b) > 0 {
+		x, y = middle(a, b)
+	}
+	if x < 0 {
+		out = appendChunk(out, Delete, a...)
+		out = appendChunk(out, Insert, b...)
+	} else {
+		out = myers(out, a[:x], b[:y])
+		out = myers(out, a[x:], b[y:])
+	}
+	return appendChunk(out, Equal, same...)
+}
+
+// middle returns a point that a shortest edit script between a and b passes through with about half of its edits on
+// either side, found by searching from both ends at once until the searches meet, or -1, -1 if a and b have nothing in
+// common. Neither may be empty and their first and last lines must differ, so that the point is neither end.
+func middle(a, b []string) (x, y int) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	offset, size := max, 2*max+2
+	// fwd and back hold the furthest x reached on each diagonal from the start, and from the end counting backwards
+	fwd, back := make([]int, size), make([]int, size)
+	for i := range fwd {
+		fwd[i], back[i] = -1, -1
+	}
+	fwd[offset+1], back[offset+1] = 0, 0
+	delta := n - m
+	// the searches meet going forwards when the difference of the lengths is odd, and going backwards when it is even
+	odd := delta%2 != 0
+	// diagonals that have run off the bottom or the right of the grid are not searched again
+	var fwdStart, fwdEnd, backStart, backEnd int
+	for d := 0; d < max; d++ {
+		for k := -d + fwdStart; k <= d-fwdEnd; k += 2 {
+			i := offset + k
+			if k == -d || k != d && fwd[i-1] < fwd[i+1] {
+				x = fwd[i+1]
+			} else {
+				x = fwd[i-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			fwd[i] = x
+			switch j := offset + delta - k; {
+			case x > n:
+				fwdEnd += 2
+			case y > m:
+				fwdStart += 2
+			case odd && j >= 0 && j < size && back[j] != -1 && x >= n-back[j]:
+				return
+			}
+		}
+		for k := -d + backStart; k <= d-backEnd; k += 2 {
+			i := offset + k
+			var bx int
+			if k == -d || k != d && back[i-1] < back[i+1] {
+				bx = back[i+1]
+			} else {
+				bx = back[i-1] + 1
+			}
+			by := bx - k
+			for bx < n && by < m && a[n-1-bx] == b[m-1-by] {
+				bx++
+				by++
+			}
+			back[i] = bx
+			switch j := offset + delta - k; {
+			case bx > n:
+				backEnd += 2
+			case by > m:
+				backStart += 2
+			case !odd && j >= 0 && j < size && fwd[j] != -1 && fwd[j] >= n-bx:
+				x = fwd[j]
+				return x, x - (delta - k)
+			}
+		}
+	}
+	return -1, -1
+}
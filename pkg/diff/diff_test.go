@@ -0,0 +1,103 @@
+package diff_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/diff"
+)
+
+// TestRoundTrip checks the chunks of random edits rebuild both texts and are minimal for simple cases
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	words := []string{"a\n", "b\n", "c\n", "d\n", "e"}
+	gen := func() string {
+		var sb strings.Builder
+		for i := rnd.Intn(20); i > 0; i-- {
+			sb.WriteString(words[rnd.Intn(len(words)-1)])
+		}
+		if rnd.Intn(2) == 0 {
+			sb.WriteString(words[len(words)-1])
+		}
+		return sb.String()
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := gen(), gen()
+		var ra, rb strings.Builder
+		for _, c := range diff.Lines(a, b) {
+			if c.Op != diff.Insert {
+				ra.WriteString(c.Text())
+			}
+			if c.Op != diff.Delete {
+				rb.WriteString(c.Text())
+			}
+		}
+		if ra.String() != a || rb.String() != b {
+			t.Fatalf("chunks of %q -> %q do not rebuild the texts", a, b)
+		}
+	}
+	chunks := diff.Lines("a\nb\nc\n", "a\nc\nd\n")
+	if got := diff.Format(chunks); got != " a\n-b\n c\n+d\n" {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+// TestShortest checks that the chunks of random edits have as few changed lines as a longest common subsequence allows,
+// also for long texts that differ throughout
+func TestShortest(t *testing.T) {
+	rnd := rand.New(rand.NewSource(11))
+	gen := func(n int) (out []string) {
+		for i := rnd.Intn(n); i > 0; i-- {
+			out = append(out, string(rune('a'+rnd.Intn(4))))
+		}
+		return
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := gen(40), gen(40)
+		// the lengths of the longest common subsequences of the ends of a and b
+		lcs := make([][]int, len(a)+1)
+		for x := range lcs {
+			lcs[x] = make([]int, len(b)+1)
+		}
+		for x := len(a) - 1; x >= 0; x-- {
+			for y := len(b) - 1; y >= 0; y-- {
+				switch {
+				case a[x] == b[y]:
+					lcs[x][y] = lcs[x+1][y+1] + 1
+				case lcs[x+1][y] > lcs[x][y+1]:
+					lcs[x][y] = lcs[x+1][y]
+				default:
+					lcs[x][y] = lcs[x][y+1]
+				}
+			}
+		}
+		var equal int
+		for _, c := range diff.Strings(a, b) {
+			if c.Op == diff.Equal {
+				equal += len(c.Lines)
+			}
+		}
+		if equal != lcs[0][0] {
+			t.Fatalf("%q -> %q kept %d lines, want %d", a, b, equal, lcs[0][0])
+		}
+	}
+	var a, b []string
+	for i := 0; i < 5000; i++ {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+		if i%3 == 0 {
+			b[i] = a[i]
+		}
+	}
+	var kept int
+	for _, c := range diff.Strings(a, b) {
+		if c.Op == diff.Equal {
+			kept += len(c.Lines)
+		}
+	}
+	if kept != 1667 {
+		t.Fatalf("kept %d lines of %d", kept, len(a))
+	}
+}
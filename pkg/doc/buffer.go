@@ -0,0 +1,100 @@
+package doc
+
+// Buffer is a gap buffer of runes. Edits close to the previous edit only move the runes between the two positions,
+// which keeps replaying long runs of typing cheap.
+type Buffer struct {
+	b        []rune
+	gapStart int
+	gapEnd   int
+}
+
+// NewBuffer creates a buffer holding the given text
+func NewBuffer(s string) (b *Buffer) {
+	r := []rune(s)
+	b = &Buffer{}
+	b.b = make([]rune, len(r)+64)
+	copy(b.b, r)
+	b.gapStart = len(r)
+	b.gapEnd = len(b.b)
+	return
+}
+
+// Len returns the number of runes in the buffer
+func (b *Buffer) Len() int {
+	return len(b.b) - (b.gapEnd - b.gapStart)
+}
+
+// At returns the rune at the given offset
+func (b *Buffer) At(i int) rune {
+	if i < b.gapStart {
+		return b.b[i]
+	}
+	return b.b[i+b.gapEnd-b.gapStart]
+}
+
+// Slice returns a copy of the runes in the range from start to end
+func (b *Buffer) Slice(start, end int) (out []rune) {
+	out = make([]rune, 0, end-start)
+	if start < b.gapStart {
+		e := end
+		if e > b.gapStart {
+			e = b.gapStart
+		}
+		out = append(out, b.b[start:e]...)
+	}
+	if end > b.gapStart {
+		s := start
+		if s < b.gapStart {
+			s = b.gapStart
+		}
+		gap := b.gapEnd - b.gapStart
+		out = append(out, b.b[s+gap:end+gap]...)
+	}
+	return
+}
+
+// String returns the whole content of the buffer
+func (b *Buffer) String() string {
+	return string(b.Slice(0, b.Len()))
+}
+
+// Insert places the runes at the offset
+func (b *Buffer) Insert(at int, r []rune) {
+	b.moveGap(at)
+	if b.gapEnd-b.gapStart < len(r) {
+		b.grow(len(r))
+	}
+	copy(b.b[b.gapStart:], r)
+	b.gapStart += len(r)
+}
+
+// Delete removes n runes from the offset
+func (b *Buffer) Delete(at, n int) {
+	b.moveGap(at)
+	b.gapEnd += n
+}
+
+func (b *Buffer) moveGap(at int) {
+	switch {
+	case at < b.gapStart:
+		n := b.gapStart - at
+		copy(b.b[b.gapEnd-n:b.gapEnd], b.b[at:b.gapStart])
+		b.gapStart -= n
+		b.gapEnd -= n
+	case at > b.gapStart:
+		n := at - b.gapStart
+		copy(b.b[b.gapStart:b.gapStart+n], b.b[b.gapEnd:b.gapEnd+n])
+		b.gapStart += n
+		b.gapEnd += n
+	}
+}
+
+func (b *Buffer) grow(need int) {
+	size := len(b.b)*2 + need
+	nb := make([]rune, size)
+	copy(nb, b.b[:b.gapStart])
+	tail := len(b.b) - b.gapEnd
+	copy(nb[size-tail:], b.b[b.gapEnd:])
+	b.gapEnd = size - tail
+	b.b = nb
+}
@@ -0,0 +1,324 @@
+// Package doc is the document model of glom. A document is never stored as formatted text, it is the result of
+// replaying a log of edit events, and every change to it is made by appending an event to that log.
+package doc
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrRange is returned when an event refers to a position outside of the document
+	ErrRange = errors.New("offset out of range")
+	// ErrMismatch is returned when the text an event expects to remove is not what is in the document
+	ErrMismatch = errors.New("event does not match document")
+	// ErrKind is returned for events of an unknown kind
+	ErrKind = errors.New("unknown event kind")
+)
+
+// Note is an annotation attached to a range of the document
+type Note struct {
+	ID     string
+	Offset int
+	Length int
+	Text   string
+}
+
+// Document is a text materialized from its event log
+type Document struct {
+	// Author is stamped onto events created through the editing methods
+	Author string
+	// Clock provides the timestamp for new events
+	Clock func() time.Time
+	log      *Log
+	buf      *Buffer
+	notes    map[string]*Note
+	watchers []func(ev Event)
+}
+
+// New creates an empty document
+func New() *Document {
+	return &Document{
+		Clock: time.Now,
+		log:   &Log{},
+		buf:   NewBuffer(""),
+		notes: make(map[string]*Note),
+	}
+}
+
+// Log returns the event log of the document
+func (d *Document) Log() *Log {
+	return d.log
+}
+
+// Len returns the length of the document in runes
+func (d *Document) Len() int {
+	return d.buf.Len()
+}
+
+// Text returns the current text of the document
+func (d *Document) Text() string {
+	return d.buf.String()
+}
+
+// Slice returns the text between two rune offsets
+func (d *Document) Slice(start, end int) string {
+	if start < 0 {
+		start = 0
+	}
+	if end > d.buf.Len() {
+		end = d.buf.Len()
+	}
+	if start >= end {
+		return ""
+	}
+	return string(d.buf.Slice(start, end))
+}
+
+// RuneAt returns the rune at the offset
+func (d *Document) RuneAt(i int) rune {
+	return d.buf.At(i)
+}
+
+// Notes returns the annotations on the document ordered by their position
+func (d *Document) Notes() (out []Note) {
+	for _, n := range d.notes {
+		out = append(out, *n)
+	}
+	sort.Slice(
+		out, func(i, j int) bool {
+			if out[i].Offset != out[j].Offset {
+				return out[i].Offset < out[j].Offset
+			}
+			return out[i].ID < out[j].ID
+		},
+	)
+	return
+}
+
+// Note returns the annotation with the given ID
+func (d *Document) Note(id string) (n Note, ok bool) {
+	var np *Note
+	if np, ok = d.notes[id]; ok {
+		n = *np
+	}
+	return
+}
+
+// Apply validates an event, applies it to the text and records it in the log. Events without a timestamp or author
+// are stamped from the document.
+func (d *Document) Apply(ev Event) (e error) {
+	if ev.Time.IsZero() {
+		ev.Time = d.Clock()
+	}
+	if ev.Author == "" {
+		ev.Author = d.Author
+	}
+	if e = d.apply(ev); e != nil {
+		return
+	}
+	d.log.Append(ev)
+	for _, fn := range d.watchers {
+		fn(ev)
+	}
+	return
+}
+
+// Watch registers a function to be called with every event after it has been applied to the document, so that
+// things derived from the text can follow its changes
+func (d *Document) Watch(fn func(ev Event)) {
+	d.watchers = append(d.watchers, fn)
+}
+
+// Insert places text at the offset
+func (d *Document) Insert(at int, s string) (e error) {
+	return d.Apply(Event{Kind: Insert, Offset: at, Text: s})
+}
+
+// Delete removes n runes from the offset
+func (d *Document) Delete(at, n int) (e error) {
+	if at < 0 || n < 0 || at+n > d.Len() {
+		return ErrRange
+	}
+	return d.Apply(Event{Kind: Delete, Offset: at, Old: d.Slice(at, at+n)})
+}
+
+// Move relocates n runes at the offset to the position to, given in the coordinates of the text before the move
+func (d *Document) Move(at, n, to int) (e error) {
+	if at < 0 || n < 0 || at+n > d.Len() {
+		return ErrRange
+	}
+	s := d.Slice(at, at+n)
+	return d.Apply(Event{Kind: Move, Offset: at, Old: s, To: to, Text: s})
+}
+
+// Annotate sets the body of a note anchored to n runes at the offset. An empty body removes the note. Moving an
+// existing note to a new anchor is recorded as its removal followed by adding it again, so that every annotate event
+// can be reversed.
+func (d *Document) Annotate(id string, at, n int, body string) (e error) {
+	np, ok := d.notes[id]
+	if !ok {
+		return d.Apply(Event{Kind: Annotate, Note: id, Offset: at, Length: n, Text: body})
+	}
+	if body != "" && np.Offset == at && np.Length == n {
+		return d.Apply(Event{Kind: Annotate, Note: id, Offset: at, Length: n, Text: body, Old: np.Text})
+	}
+	if e = d.Apply(Event{Kind: Annotate, Note: id, Offset: np.Offset, Length: np.Length, Old: np.Text}); e != nil {
+		return
+	}
+	if body == "" {
+		return
+	}
+	return d.Apply(Event{Kind: Annotate, Note: id, Offset: at, Length: n, Text: body})
+}
+
+// apply changes the text and notes according to the event without recording it
+func (d *Document) apply(ev Event) (e error) {
+	size := d.buf.Len()
+	switch ev.Kind {
+	case Insert:
+		if ev.Offset < 0 || ev.Offset > size {
+			return ErrRange
+		}
+		r := []rune(ev.Text)
+		d.buf.Insert(ev.Offset, r)
+		d.followNotes(ev)
+	case Delete:
+		n := runeLen(ev.Old)
+		if ev.Offset < 0 || ev.Offset+n > size {
+			return ErrRange
+		}
+		if string(d.buf.Slice(ev.Offset, ev.Offset+n)) != ev.Old {
+			return ErrMismatch
+		}
+		d.buf.Delete(ev.Offset, n)
+		d.followNotes(ev)
+	case Move:
+		n := runeLen(ev.Old)
+		if ev.Offset < 0 || ev.Offset+n > size || ev.To < 0 || ev.To > size {
+			return ErrRange
+		}
+		if ev.To > ev.Offset && ev.To < ev.Offset+n {
+			return ErrRange
+		}
+		if string(d.buf.Slice(ev.Offset, ev.Offset+n)) != ev.Old {
+			return ErrMismatch
+		}
+		r := []rune(ev.Text)
+		dest := MoveDest(ev)
+		d.buf.Delete(ev.Offset, n)
+		d.buf.Insert(dest, r)
+		d.followNotes(ev)
+	case Annotate:
+		if ev.Offset < 0 || ev.Length < 0 || ev.Offset+ev.Length > size {
+			return ErrRange
+		}
+		np, ok := d.notes[ev.Note]
+		var old string
+		if ok {
+			old = np.Text
+		}
+		if old != ev.Old {
+			return ErrMismatch
+		}
+		switch {
+		case ev.Text == "":
+			delete(d.notes, ev.Note)
+		case ok:
+			// a note keeps its anchor for as long as it exists, the anchor of the event only places new notes
+			np.Text = ev.Text
+		default:
+			d.notes[ev.Note] = &Note{ID: ev.Note, Offset: ev.Offset, Length: ev.Length, Text: ev.Text}
+		}
+	default:
+		return ErrKind
+	}
+	return
+}
+
+// followNotes keeps the notes anchored to their text after the event was applied
+func (d *Document) followNotes(ev Event) {
+	for _, np := range d.notes {
+		np.Offset, np.Length = Follow(ev, np.Offset, np.Length)
+	}
+}
+
+// Follow maps a range of the text before an event to where that text is after it. A range inside the text of a move
+// is carried along with it, otherwise a move is treated as a deletion followed by an insertion. Text inserted exactly
+// at the end of a range does not extend it.
+func Follow(ev Event, offset, length int) (start, n int) {
+	var end int
+	switch ev.Kind {
+	case Insert:
+		ins := runeLen(ev.Text)
+		start, end = mapInsert(offset, false, ev.Offset, ins), mapInsert(offset+length, true, ev.Offset, ins)
+	case Delete:
+		del := runeLen(ev.Old)
+		start, end = mapDelete(offset, ev.Offset, del), mapDelete(offset+length, ev.Offset, del)
+	case Move:
+		del, ins, dest := runeLen(ev.Old), runeLen(ev.Text), MoveDest(ev)
+		if offset >= ev.Offset && offset+length <= ev.Offset+del {
+			rel := offset - ev.Offset
+			if ev.Text != ev.Old {
+				rel = relocate(ev.Old, ev.Text, rel, length)
+			}
+			if rel >= 0 {
+				return dest + rel, length
+			}
+		}
+		start = mapInsert(mapDelete(offset, ev.Offset, del), false, dest, ins)
+		end = mapInsert(mapDelete(offset+length, ev.Offset, del), true, dest, ins)
+	default:
+		return offset, length
+	}
+	if end < start {
+		end = start
+	}
+	return start, end - start
+}
+
+// relocate finds where the n runes at rel in old ended up in the replacement text, preferring the occurrence closest
+// to the original position. It returns -1 if the runes are not in the replacement.
+func relocate(old, replacement string, rel, n int) int {
+	o := []rune(old)
+	want := string(o[rel : rel+n])
+	r := []rune(replacement)
+	best := -1
+	for i := 0; i+n <= len(r); i++ {
+		if string(r[i:i+n]) != want {
+			continue
+		}
+		if best < 0 || abs(i-rel) < abs(best-rel) {
+			best = i
+		}
+	}
+	return best
+}
+
+// mapInsert moves a position to account for n runes inserted at the offset. An insertion exactly at the end of a
+// range does not extend it.
+func mapInsert(x int, end bool, at, n int) int {
+	if at < x || (at == x && !end) {
+		return x + n
+	}
+	return x
+}
+
+// mapDelete moves a position to account for n runes removed at the offset
+func mapDelete(x, at, n int) int {
+	switch {
+	case x <= at:
+		return x
+	case x >= at+n:
+		return x - n
+	}
+	return at
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,245 @@
+package doc_test
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/p9c/glom/pkg/doc"
+)
+
+func newDoc() *doc.Document {
+	d := doc.New()
+	d.Author = "tester"
+	var tick int64
+	d.Clock = func() time.Time {
+		tick++
+		return time.Unix(tick, 0)
+	}
+	return d
+}
+
+// TestEditing checks each kind of event changes the text as expected and is recorded in the log
+func TestEditing(t *testing.T) {
+	d := newDoc()
+	steps := []struct {
+		fn   func() error
+		want string
+	}{
+		{func() error { return d.Insert(0, "hello world") }, "hello world"},
+		{func() error { return d.Insert(5, ",") }, "hello, world"},
+		{func() error { return d.Delete(0, 1) }, "ello, world"},
+		{func() error { return d.Move(0, 4, 11) }, ", worldello"},
+		{func() error { return d.Move(7, 4, 0) }, "ello, world"},
+		{func() error { return d.Annotate("n1", 6, 5, "greeting") }, "ello, world"},
+	}
+	for i, s := range steps {
+		if e := s.fn(); e != nil {
+			t.Fatalf("step %d: %v", i, e)
+		}
+		if got := d.Text(); got != s.want {
+			t.Fatalf("step %d: got %q, want %q", i, got, s.want)
+		}
+	}
+	if d.Log().Len() != len(steps) {
+		t.Fatalf("log has %d events, want %d", d.Log().Len(), len(steps))
+	}
+	for i, ev := range d.Log().Events() {
+		if ev.Author != "tester" || ev.Time.IsZero() {
+			t.Errorf("event %d not stamped: %+v", i, ev)
+		}
+	}
+}
+
+// TestInvalidEvents checks that events which do not fit the document are refused and not recorded
+func TestInvalidEvents(t *testing.T) {
+	d := newDoc()
+	if e := d.Insert(0, "abc"); e != nil {
+		t.Fatal(e)
+	}
+	bad := []doc.Event{
+		{Kind: doc.Insert, Offset: 4, Text: "x"},
+		{Kind: doc.Delete, Offset: 1, Old: "x"},
+		{Kind: doc.Delete, Offset: 2, Old: "cd"},
+		{Kind: doc.Move, Offset: 0, Old: "ab", To: 1, Text: "ab"},
+		{Kind: doc.Annotate, Note: "n", Offset: 0, Length: 1, Text: "x", Old: "y"},
+		{Kind: 99},
+	}
+	for i, ev := range bad {
+		if e := d.Apply(ev); e == nil {
+			t.Errorf("event %d (%s) was accepted", i, ev)
+		}
+	}
+	if d.Log().Len() != 1 || d.Text() != "abc" {
+		t.Fatalf("rejected events changed the document: %q, %d events", d.Text(), d.Log().Len())
+	}
+}
+
+// TestMaterialize checks the text can be recovered at every point of the log
+func TestMaterialize(t *testing.T) {
+	d := newDoc()
+	rnd := rand.New(rand.NewSource(1))
+	var states []string
+	states = append(states, d.Text())
+	for i := 0; i < 500; i++ {
+		var e error
+		switch n := d.Len(); {
+		case n == 0 || rnd.Intn(3) == 0:
+			e = d.Insert(rnd.Intn(n+1), string(rune('a'+rnd.Intn(26)))+"é")
+		case rnd.Intn(2) == 0:
+			at := rnd.Intn(n)
+			e = d.Delete(at, rnd.Intn(n-at)/2+1)
+		default:
+			at := rnd.Intn(n)
+			l := rnd.Intn(n-at) + 1
+			to := rnd.Intn(n + 1)
+			if to > at && to < at+l {
+				to = at
+			}
+			e = d.Move(at, l, to)
+		}
+		if e != nil {
+			t.Fatalf("edit %d: %v", i, e)
+		}
+		states = append(states, d.Text())
+	}
+	for i, want := range states {
+		got, e := d.Log().Materialize(i)
+		if e != nil {
+			t.Fatalf("materialize %d: %v", i, e)
+		}
+		if got != want {
+			t.Fatalf("materialize %d: got %q, want %q", i, got, want)
+		}
+	}
+	if _, e := d.Log().Materialize(len(states)); e == nil {
+		t.Fatal("materialize past the end of the log succeeded")
+	}
+}
+
+// TestNotesFollowEdits checks annotation anchors are carried along by edits around and over them
+func TestNotesFollowEdits(t *testing.T) {
+	d := newDoc()
+	if e := d.Insert(0, "alpha beta gamma"); e != nil {
+		t.Fatal(e)
+	}
+	if e := d.Annotate("b", 6, 4, "second word"); e != nil {
+		t.Fatal(e)
+	}
+	check := func(want string) {
+		t.Helper()
+		n, ok := d.Note("b")
+		if !ok {
+			t.Fatal("note lost")
+		}
+		if got := d.Slice(n.Offset, n.Offset+n.Length); got != want {
+			t.Fatalf("note anchored to %q, want %q", got, want)
+		}
+	}
+	if e := d.Insert(0, ">> "); e != nil {
+		t.Fatal(e)
+	}
+	check("beta")
+	if e := d.Move(9, 5, 0); e != nil {
+		t.Fatal(e)
+	}
+	check("beta")
+	if d.Text() != "beta >> alpha gamma" {
+		t.Fatalf("unexpected text %q", d.Text())
+	}
+	if e := d.Delete(1, 2); e != nil {
+		t.Fatal(e)
+	}
+	check("ba")
+	if e := d.Annotate("b", 0, 2, ""); e != nil {
+		t.Fatal(e)
+	}
+	if _, ok := d.Note("b"); ok {
+		t.Fatal("note not removed")
+	}
+}
+
+// TestInverse checks that applying the inverse of every event restores the text, including moves that change the
+// moved text on the way
+func TestInverse(t *testing.T) {
+	d := newDoc()
+	if e := d.Insert(0, "f(a, b, c)"); e != nil {
+		t.Fatal(e)
+	}
+	events := []doc.Event{
+		{Kind: doc.Insert, Offset: 2, Text: "x, "},
+		{Kind: doc.Delete, Offset: 0, Old: "f("},
+		{Kind: doc.Move, Offset: 3, Old: "a, ", To: 0, Text: "a, "},
+		{Kind: doc.Move, Offset: 3, Old: "x, ", To: 10, Text: ", x"},
+		{Kind: doc.Annotate, Note: "n", Offset: 0, Length: 1, Text: "first"},
+		{Kind: doc.Annotate, Note: "n", Offset: 0, Length: 1, Text: "changed", Old: "first"},
+	}
+	for i, ev := range events {
+		before := d.Text()
+		if e := d.Apply(ev); e != nil {
+			t.Fatalf("event %d: %v", i, e)
+		}
+		after := d.Text()
+		if e := d.Apply(doc.Inverse(ev)); e != nil {
+			t.Fatalf("inverse of event %d: %v", i, e)
+		}
+		if d.Text() != before {
+			t.Fatalf("inverse of event %d gave %q, want %q", i, d.Text(), before)
+		}
+		if e := d.Apply(ev); e != nil {
+			t.Fatalf("event %d again: %v", i, e)
+		}
+		if d.Text() != after {
+			t.Fatalf("event %d replayed gave %q, want %q", i, d.Text(), after)
+		}
+	}
+	if d.Text() != "a, b, c, x)" {
+		t.Fatalf("unexpected text %q", d.Text())
+	}
+}
+
+// TestSelection checks that overlapping ranges are merged and that the ranges follow the edits of the document
+func TestSelection(t *testing.T) {
+	s := doc.NewSelection()
+	s.Set(doc.Range{Anchor: 8, Caret: 4}, doc.Cursor(1), doc.Range{Anchor: 6, Caret: 10}, doc.Cursor(1))
+	want := []doc.Range{doc.Cursor(1), {Anchor: 10, Caret: 4}}
+	got := s.Ranges()
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("ranges are %v, want %v", got, want)
+	}
+	if s.Primary() != doc.Cursor(1) {
+		t.Fatalf("primary is %v", s.Primary())
+	}
+	s.Add(doc.Range{Anchor: 12, Caret: 14})
+	d := newDoc()
+	d.Watch(s.Follow)
+	if e := d.Insert(0, "0123456789abcdef"); e != nil {
+		t.Fatal(e)
+	}
+	s.Set(doc.Cursor(1), doc.Range{Anchor: 10, Caret: 4}, doc.Range{Anchor: 12, Caret: 14})
+	steps := []struct {
+		fn   func() error
+		want []doc.Range
+	}{
+		{func() error { return d.Insert(1, "xx") }, []doc.Range{doc.Cursor(3), {12, 6}, {14, 16}}},
+		{func() error { return d.Delete(5, 3) }, []doc.Range{doc.Cursor(3), {9, 5}, {11, 13}}},
+		{func() error { return d.Move(11, 2, 0) }, []doc.Range{{0, 2}, doc.Cursor(5), {11, 7}}},
+	}
+	for i, st := range steps {
+		if e := st.fn(); e != nil {
+			t.Fatalf("step %d: %v", i, e)
+		}
+		got := s.Ranges()
+		if len(got) != len(st.want) {
+			t.Fatalf("step %d: ranges are %v, want %v", i, got, st.want)
+		}
+		for j := range got {
+			if got[j] != st.want[j] {
+				t.Fatalf("step %d: ranges are %v, want %v", i, got, st.want)
+			}
+		}
+	}
+	if s.Primary() != (doc.Range{Anchor: 0, Caret: 2}) {
+		t.Fatalf("primary is %v", s.Primary())
+	}
+}
@@ -0,0 +1,105 @@
+package doc
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kind is the type of an edit event
+type Kind uint8
+
+const (
+	// Insert places Text at Offset
+	Insert Kind = iota + 1
+	// Delete removes Old from Offset
+	Delete
+	// Move removes Old from Offset and places Text at To, where To is expressed in the coordinates of the text before
+	// the removal. For a plain move Text and Old are the same, but a move may also adjust separators on the way.
+	Move
+	// Annotate sets the body of the note Note to Text, anchored to the Length runes at Offset. An empty Text removes
+	// the note. Old holds the previous body so the event can be reversed.
+	Annotate
+)
+
+var kindNames = map[Kind]string{
+	Insert:   "insert",
+	Delete:   "delete",
+	Move:     "move",
+	Annotate: "annotate",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Event is a single recorded edit. All offsets are counted in runes.
+type Event struct {
+	Kind   Kind
+	Offset int
+	Length int
+	To     int
+	Text   string
+	Old    string
+	Note   string
+	Author string
+	Time   time.Time
+}
+
+func (ev Event) String() string {
+	switch ev.Kind {
+	case Insert:
+		return fmt.Sprintf("insert %d %q", ev.Offset, ev.Text)
+	case Delete:
+		return fmt.Sprintf("delete %d %q", ev.Offset, ev.Old)
+	case Move:
+		return fmt.Sprintf("move %d %q -> %d %q", ev.Offset, ev.Old, ev.To, ev.Text)
+	case Annotate:
+		return fmt.Sprintf("annotate %s %d+%d %q", ev.Note, ev.Offset, ev.Length, ev.Text)
+	}
+	return ev.Kind.String()
+}
+
+// Inverse returns the event that reverses ev when applied directly after it. The inverse has no timestamp or author,
+// it is a new edit and is stamped by the document it is applied to.
+func Inverse(ev Event) (inv Event) {
+	inv = Event{Kind: ev.Kind, Offset: ev.Offset, Length: ev.Length, Note: ev.Note}
+	switch ev.Kind {
+	case Insert:
+		inv.Kind = Delete
+		inv.Old = ev.Text
+	case Delete:
+		inv.Kind = Insert
+		inv.Text = ev.Old
+	case Move:
+		inv.Offset = MoveDest(ev)
+		inv.Old, inv.Text = ev.Text, ev.Old
+		if ev.To > ev.Offset {
+			inv.To = ev.Offset
+		} else {
+			inv.To = ev.Offset + runeLen(ev.Text)
+		}
+	case Annotate:
+		inv.Old, inv.Text = ev.Text, ev.Old
+	}
+	return
+}
+
+// MoveDest returns where the text of a move event lands in the document after the moved text was removed
+func MoveDest(ev Event) int {
+	if ev.To > ev.Offset {
+		return ev.To - runeLen(ev.Old)
+	}
+	return ev.To
+}
+
+// runeLen is the number of runes in a string
+func runeLen(s string) int {
+	var n int
+	for range s {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,40 @@
+package doc
+
+// Log is the append-only record of every event applied to a document. Events are never removed or rewritten, undoing
+// an edit appends its inverse.
+type Log struct {
+	events []Event
+}
+
+// Append adds an event to the end of the log and returns its index
+func (l *Log) Append(ev Event) int {
+	l.events = append(l.events, ev)
+	return len(l.events) - 1
+}
+
+// Len returns the number of events in the log
+func (l *Log) Len() int {
+	return len(l.events)
+}
+
+// At returns the event at index i
+func (l *Log) At(i int) Event {
+	return l.events[i]
+}
+
+// Events returns the events in the log. The slice must not be modified.
+func (l *Log) Events() []Event {
+	return l.events
+}
+
+// Materialize returns the text of the document as it was after the first n events were applied
+func (l *Log) Materialize(n int) (s string, e error) {
+	if n < 0 || n > len(l.events) {
+		return "", ErrRange
+	}
+	var d *Document
+	if d, e = Replay(l.events[:n]); e != nil {
+		return
+	}
+	return d.Text(), nil
+}
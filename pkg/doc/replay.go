@@ -0,0 +1,18 @@
+package doc
+
+import (
+	"fmt"
+)
+
+// Replay builds a document by applying the events in order to an empty text. The events are copied into the log of
+// the new document unchanged, so the result is the same every time the same events are replayed.
+func Replay(events []Event) (d *Document, e error) {
+	d = New()
+	for i := range events {
+		if e = d.apply(events[i]); e != nil {
+			return nil, fmt.Errorf("event %d (%s): %w", i, events[i], e)
+		}
+		d.log.Append(events[i])
+	}
+	return
+}
@@ -0,0 +1,173 @@
+package doc
+
+import (
+	"sort"
+)
+
+// Range is a selected stretch of the text. Anchor is where the selection was started and Caret is the end that
+// moves, so a range whose two ends are at the same offset is a plain cursor.
+type Range struct {
+	Anchor int
+	Caret  int
+}
+
+// Cursor returns an empty range at the offset
+func Cursor(at int) Range {
+	return Range{Anchor: at, Caret: at}
+}
+
+// Start returns the lower end of the range
+func (r Range) Start() int {
+	if r.Anchor < r.Caret {
+		return r.Anchor
+	}
+	return r.Caret
+}
+
+// End returns the upper end of the range
+func (r Range) End() int {
+	if r.Anchor > r.Caret {
+		return r.Anchor
+	}
+	return r.Caret
+}
+
+// Len returns the number of runes in the range
+func (r Range) Len() int {
+	return r.End() - r.Start()
+}
+
+// Empty reports whether the range is a plain cursor
+func (r Range) Empty() bool {
+	return r.Anchor == r.Caret
+}
+
+// Backward reports whether the caret is in front of the anchor
+func (r Range) Backward() bool {
+	return r.Caret < r.Anchor
+}
+
+// Selection is a set of ranges ordered by their position that never overlap. One of them is the primary range, the
+// one the last action was aimed at and the view follows.
+type Selection struct {
+	ranges  []Range
+	primary int
+}
+
+// NewSelection creates a selection with a cursor at the start of the text
+func NewSelection() *Selection {
+	return &Selection{ranges: []Range{Cursor(0)}}
+}
+
+// Ranges returns a copy of the ranges in order
+func (s *Selection) Ranges() []Range {
+	return append([]Range{}, s.ranges...)
+}
+
+// Len returns the number of ranges
+func (s *Selection) Len() int {
+	return len(s.ranges)
+}
+
+// Primary returns the primary range
+func (s *Selection) Primary() Range {
+	return s.ranges[s.primary]
+}
+
+// PrimaryIndex returns the position of the primary range among the ranges
+func (s *Selection) PrimaryIndex() int {
+	return s.primary
+}
+
+// Set replaces the ranges, making the last of them the primary one. Ranges that overlap are merged.
+func (s *Selection) Set(ranges ...Range) {
+	if len(ranges) == 0 {
+		ranges = []Range{Cursor(0)}
+	}
+	s.ranges = append(s.ranges[:0], ranges...)
+	s.primary = len(s.ranges) - 1
+	s.normalize()
+}
+
+// Add adds a range and makes it the primary one
+func (s *Selection) Add(r Range) {
+	s.ranges = append(s.ranges, r)
+	s.primary = len(s.ranges) - 1
+	s.normalize()
+}
+
+// Collapse drops every range but the primary one
+func (s *Selection) Collapse() {
+	s.ranges = []Range{s.Primary()}
+	s.primary = 0
+}
+
+// Map replaces every range with the result of a function, given the range and its position
+func (s *Selection) Map(fn func(i int, r Range) Range) {
+	for i := range s.ranges {
+		s.ranges[i] = fn(i, s.ranges[i])
+	}
+	s.normalize()
+}
+
+// Clamp keeps the ranges inside a text of n runes
+func (s *Selection) Clamp(n int) {
+	clamp := func(x int) int {
+		switch {
+		case x < 0:
+			return 0
+		case x > n:
+			return n
+		}
+		return x
+	}
+	s.Map(func(_ int, r Range) Range { return Range{Anchor: clamp(r.Anchor), Caret: clamp(r.Caret)} })
+}
+
+// Follow keeps the ranges on their text after an event was applied to the document. Both ends move like cursors, so
+// text inserted at a cursor ends up in front of it.
+func (s *Selection) Follow(ev Event) {
+	if ev.Kind == Annotate {
+		return
+	}
+	s.Map(
+		func(_ int, r Range) Range {
+			r.Anchor, _ = Follow(ev, r.Anchor, 0)
+			r.Caret, _ = Follow(ev, r.Caret, 0)
+			return r
+		},
+	)
+}
+
+// normalize orders the ranges and merges the ones that overlap, keeping track of the primary range. Cursors at the
+// same offset are one cursor.
+func (s *Selection) normalize() {
+	primary := s.ranges[s.primary]
+	sort.SliceStable(s.ranges, func(i, j int) bool { return s.ranges[i].Start() < s.ranges[j].Start() })
+	out := s.ranges[:1]
+	s.primary = 0
+	for _, r := range s.ranges[1:] {
+		last := &out[len(out)-1]
+		if r.Start() < last.End() || r.Start() == last.Start() {
+			merged := Range{Anchor: last.Start(), Caret: r.End()}
+			if last.End() > merged.Caret {
+				merged.Caret = last.End()
+			}
+			if last.Backward() || r.Backward() {
+				merged.Anchor, merged.Caret = merged.Caret, merged.Anchor
+			}
+			if *last == primary || r == primary {
+				primary = merged
+			}
+			*last = merged
+			continue
+		}
+		out = append(out, r)
+	}
+	s.ranges = out
+	for i, r := range s.ranges {
+		if r == primary {
+			s.primary = i
+		}
+	}
+}
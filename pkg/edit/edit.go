@@ -0,0 +1,66 @@
+// Package edit contains the structural editing operations of glom. They work on the segments of a structure tree and
+// produce document events that keep every segment balanced, so that an edit can never leave a bracket without its
+// partner.
+package edit
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/p9c/glom/pkg/structure"
+)
+
+var (
+	// ErrBroken is returned for segments that are missing their closing delimiter
+	ErrBroken = errors.New("segment is not balanced")
+	// ErrRoot is returned for operations that cannot be applied to the whole document
+	ErrRoot = errors.New("operation needs a segment inside the document")
+	// ErrFixed is returned for segments that are not in a sequence they can be moved along
+	ErrFixed = errors.New("segment cannot be moved")
+	// ErrDrop is returned when a segment is moved to a place that is not one of its drops
+	ErrDrop = errors.New("segment cannot be dropped there")
+)
+
+// text returns the runes of the source between two offsets
+func text(src structure.Source, start, end int) string {
+	var sb strings.Builder
+	for i := start; i < end; i++ {
+		sb.WriteRune(src.RuneAt(i))
+	}
+	return sb.String()
+}
+
+// lineStart returns the offset of the start of the line containing the offset
+func lineStart(src structure.Source, at int) int {
+	for at > 0 && src.RuneAt(at-1) != '\n' {
+		at--
+	}
+	return at
+}
+
+// indentation returns the white space at the start of the line containing the offset
+func indentation(src structure.Source, at int) string {
+	var sb strings.Builder
+	for i := lineStart(src, at); i < src.Len(); i++ {
+		r := src.RuneAt(i)
+		if r != ' ' && r != '\t' {
+			break
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// reindent replaces the indentation prefix of every line of the text after the first
+func reindent(txt, from, to string) string {
+	if from == to || !strings.Contains(txt, "\n") {
+		return txt
+	}
+	lines := strings.Split(txt, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], from) {
+			lines[i] = to + lines[i][len(from):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,359 @@
+package edit
+
+import (
+	"strings"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// Drop is a place a segment can be moved to, between two children of a container
+type Drop struct {
+	// Container is the segment the moved segment becomes a child of
+	Container *structure.Segment
+	// Index is the position among the children of the container the segment is moved to
+	Index int
+	// At is the offset the drop indicator is drawn at
+	At int
+	// before is set when the segment goes in front of the member at the index rather than after the one before it
+	before bool
+	lo     layout
+}
+
+// layout is how the members of a container are separated from each other
+type layout struct {
+	// known is set when the separator was found between two members
+	known   bool
+	comma   bool
+	newline bool
+	// gap is the separator with the white space around it
+	gap string
+}
+
+// members returns the children of a container that lie between its delimiters. Children that start before the inner
+// range, like the function being called in a call, are part of its opening and never move.
+func members(c *structure.Segment) []*structure.Segment {
+	start, _ := c.Inner()
+	ch := c.Children
+	for len(ch) > 0 && ch[0].Start() < start {
+		ch = ch[1:]
+	}
+	return ch
+}
+
+// run is a stretch of members of a container that are separated from each other by separators, which segments can be
+// moved along. first and last are the indices of its first and last member.
+type run struct {
+	first, last int
+	lo          layout
+}
+
+// separated reports whether the text between two members of a container is nothing but a separator. Containers found
+// by a language parser are only sequences if the parser gave them a separator, which must be the one between them.
+func separated(c *structure.Segment, txt string) bool {
+	trimmed := strings.TrimSpace(txt)
+	switch {
+	case c.Separator != "":
+		return trimmed == c.Separator || c.Separator == ";" && trimmed == "" && strings.Contains(txt, "\n")
+	case c.Kind == structure.Node:
+		return false
+	}
+	switch trimmed {
+	case ",", ";":
+		return true
+	case "":
+		return strings.Contains(txt, "\n")
+	}
+	return false
+}
+
+// runs splits the members of a container into runs. A container without members has a single empty run.
+func runs(src structure.Source, c *structure.Segment, ms []*structure.Segment, like layout) (rs []run) {
+	if len(ms) == 0 {
+		return []run{{first: 0, last: -1, lo: infer(src, c, nil, like)}}
+	}
+	r := run{}
+	for i := 1; i <= len(ms); i++ {
+		if i < len(ms) {
+			if txt := text(src, ms[i-1].End(), ms[i].Start()); separated(c, txt) {
+				if !r.lo.known {
+					r.lo = layout{
+						known:   true,
+						comma:   strings.Contains(txt, ","),
+						newline: strings.Contains(txt, "\n"),
+						gap:     txt,
+					}
+				}
+				continue
+			}
+		}
+		r.last = i - 1
+		if !r.lo.known {
+			r.lo = infer(src, c, ms[r.first], like)
+		}
+		rs = append(rs, r)
+		r = run{first: i}
+	}
+	return
+}
+
+// infer makes up the layout of a run with a single member, or of an empty container. The separator is the one the
+// language gives the container, or failing that the one of the run the segment comes from or the one its bracket
+// suggests.
+func infer(src structure.Source, c, member *structure.Segment, like layout) (lo layout) {
+	start, end := c.Inner()
+	switch {
+	case c.Separator != "":
+		lo.comma = c.Separator == ","
+	case like.known:
+		lo.comma = like.comma
+	case c.Open > 0:
+		switch src.RuneAt(start - 1) {
+		case '(', '[':
+			lo.comma = true
+		}
+	}
+	lo.newline = strings.Contains(text(src, start, end), "\n") || c.Separator == ";"
+	if member != nil && !strings.Contains(text(src, lineStart(src, member.Start()), member.Start()), "\n") {
+		// a member on a line with text before it keeps the list on one line
+		ls := lineStart(src, member.Start())
+		lo.newline = ls > start && strings.TrimSpace(text(src, ls, member.Start())) == "" || lo.newline && !lo.comma
+	}
+	switch {
+	case lo.newline:
+		ind := indentation(src, c.Start()) + "\t"
+		if member != nil {
+			ind = indentation(src, member.Start())
+		}
+		lo.gap = "\n" + ind
+		if lo.comma {
+			lo.gap = "," + lo.gap
+		}
+	case lo.comma:
+		lo.gap = ", "
+	default:
+		lo.gap = "; "
+	}
+	return
+}
+
+// position returns the index of the segment among the members of its parent, and the members
+func position(seg *structure.Segment) (idx int, ms []*structure.Segment) {
+	ms = members(seg.Parent)
+	for i, m := range ms {
+		if m == seg {
+			return i, ms
+		}
+	}
+	return -1, ms
+}
+
+// runOf returns the run containing the member with the index
+func runOf(rs []run, idx int) run {
+	for _, r := range rs {
+		if idx >= r.first && idx <= r.last {
+			return r
+		}
+	}
+	return run{first: idx, last: idx}
+}
+
+// Drops returns the places the segment can be moved to. These are the positions along the run of siblings it is in,
+// and along the runs of other containers of the same kind that have a member like one of its run, outside of the
+// segment itself and after any fixed members.
+//
+// Only segments that are separated from a sibling by a separator, or that are the only member of a bracketed
+// container, can be moved, so that moving them never leaves behind a dangling operator or keyword.
+func Drops(src structure.Source, seg *structure.Segment) (drops []Drop, e error) {
+	if seg.Parent == nil {
+		return nil, ErrRoot
+	}
+	if seg.Broken {
+		return nil, ErrBroken
+	}
+	if seg.Fixed {
+		return nil, ErrFixed
+	}
+	parent := seg.Parent
+	idx, ms := position(seg)
+	if idx < 0 {
+		return nil, ErrFixed
+	}
+	own := runOf(runs(src, parent, ms, layout{}), idx)
+	if own.first == own.last && (len(ms) > 1 || parent.Open == 0 && parent.Parent != nil) {
+		return nil, ErrFixed
+	}
+	lines := endsInLineComment(seg)
+	labels := make(map[string]bool)
+	for _, m := range ms[own.first : own.last+1] {
+		labels[m.Label] = true
+	}
+	root := parent
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	root.Walk(
+		func(c *structure.Segment) bool {
+			if c == seg || !c.Container() || c.Broken {
+				return false
+			}
+			if c != parent && (c.Kind != parent.Kind || c.Label != parent.Label) {
+				return true
+			}
+			cms := members(c)
+			fixed := -1
+			for i, m := range cms {
+				if m.Fixed {
+					fixed = i
+				}
+			}
+			for _, r := range runs(src, c, cms, own.lo) {
+				if !accepts(c, parent, cms[r.first:r.last+1], labels, r.first == own.first) ||
+					lines && !r.lo.newline {
+					continue
+				}
+				for i := r.first; i <= r.last+1; i++ {
+					if i <= fixed || c == parent && (i == idx || i == idx+1) {
+						// nothing goes in front of a fixed member, and dropping beside itself would not move the
+						// segment
+						continue
+					}
+					d := Drop{Container: c, Index: i, before: i == r.first && len(cms) > 0, lo: r.lo}
+					switch {
+					case len(cms) == 0:
+						d.At, _ = c.Inner()
+					case d.before:
+						d.At = cms[i].Start()
+					default:
+						d.At = cms[i-1].End()
+					}
+					drops = append(drops, d)
+				}
+			}
+			return true
+		},
+	)
+	return
+}
+
+// endsInLineComment reports whether the segment ends with a comment that runs to the end of the line, which would
+// swallow anything put after it on the same line
+func endsInLineComment(seg *structure.Segment) bool {
+	for {
+		if seg.Kind == structure.Comment && seg.Close == 0 {
+			return true
+		}
+		n := len(seg.Children)
+		if n == 0 || seg.Children[n-1].End() != seg.End() {
+			return false
+		}
+		seg = seg.Children[n-1]
+	}
+}
+
+// accepts reports whether a run of a container can take a member of the run of the parent the segment is in. An
+// empty container can take anything that fits between its delimiters, other runs must have a member like one of the
+// segment's run.
+func accepts(c, parent *structure.Segment, ms []*structure.Segment, labels map[string]bool, same bool) bool {
+	if c == parent && same {
+		return true
+	}
+	if len(ms) == 0 {
+		return c.Open > 0
+	}
+	for _, m := range ms {
+		if labels[m.Label] {
+			return true
+		}
+	}
+	return false
+}
+
+// MoveEvent makes the event that moves a segment to one of its drops. The separator that went with the segment is
+// removed from where it was and a separator matching the run it joins is added where it lands, with the lines of the
+// segment indented to their new place.
+func MoveEvent(src structure.Source, seg *structure.Segment, drop Drop) (ev doc.Event, e error) {
+	var drops []Drop
+	if drops, e = Drops(src, seg); e != nil {
+		return
+	}
+	valid := false
+	for _, d := range drops {
+		if d.Container == drop.Container && d.Index == drop.Index && d.At == drop.At {
+			drop, valid = d, true
+			break
+		}
+	}
+	if !valid {
+		return ev, ErrDrop
+	}
+	start, end := seg.Start(), seg.End()
+	rs, re := start, end
+	idx, ms := position(seg)
+	own := runOf(runs(src, seg.Parent, ms, layout{}), idx)
+	switch {
+	case idx > own.first:
+		rs = ms[idx-1].End()
+	case idx < own.last:
+		re = ms[idx+1].Start()
+	case len(ms) == 1:
+		// an only member leaves its container empty, along with the white space and separator around it
+		is, ie := seg.Parent.Inner()
+		if strings.Trim(text(src, is, start)+text(src, end, ie), " \t\r\n,;") == "" {
+			rs, re = is, ie
+		}
+	}
+	to := drop.lo
+	ind := indentation(src, drop.At)
+	if to.newline {
+		ind = to.gap[strings.LastIndex(to.gap, "\n")+1:]
+	}
+	moved := reindent(text(src, start, end), indentation(src, start), ind)
+	var txt string
+	switch {
+	case len(members(drop.Container)) == 0 && to.newline:
+		if to.comma {
+			// a list spread over lines needs a comma after its last element
+			moved += ","
+		}
+		txt = to.gap + moved + "\n" + indentation(src, drop.Container.Start())
+	case len(members(drop.Container)) == 0:
+		txt = moved
+	case drop.before:
+		txt = moved + to.gap
+	default:
+		txt = to.gap + moved
+	}
+	return doc.Event{Kind: doc.Move, Offset: rs, Old: text(src, rs, re), To: drop.At, Text: txt}, nil
+}
+
+// Move moves a segment of the document of the history to one of its drops as a single undoable event
+func Move(h *undo.Tree, seg *structure.Segment, drop Drop) (e error) {
+	var ev doc.Event
+	if ev, e = MoveEvent(h.Doc(), seg, drop); e != nil {
+		return
+	}
+	_, e = h.Commit(ev)
+	return
+}
+
+// Step returns the drop that moves a segment past the sibling before it, or past the one after it for a positive
+// direction, which is how a segment is moved up and down with the keys
+func Step(src structure.Source, seg *structure.Segment, dir int) (drop Drop, e error) {
+	var drops []Drop
+	if drops, e = Drops(src, seg); e != nil {
+		return
+	}
+	idx, _ := position(seg)
+	want := idx - 1
+	if dir > 0 {
+		want = idx + 2
+	}
+	for _, d := range drops {
+		if d.Container == seg.Parent && d.Index == want {
+			return d, nil
+		}
+	}
+	return drop, ErrDrop
+}
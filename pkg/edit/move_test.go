@@ -0,0 +1,235 @@
+package edit_test
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/edit"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/structure/golang"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+const src = `package main
+
+func f() {
+	a := 1
+	b(a, 2, "x")
+	if a > 0 {
+		c()
+	}
+}
+
+var v = []int{1, 2, 3}
+
+var w = []int{
+	4,
+	5,
+}
+`
+
+// find returns the segment with the label whose text starts with the prefix
+func find(t *testing.T, tr *structure.Tree, txt, label, prefix string) (found *structure.Segment) {
+	tr.Walk(
+		func(s *structure.Segment) bool {
+			if found == nil && s.Label == label && strings.HasPrefix(string([]rune(txt)[s.Start():]), prefix) {
+				found = s
+			}
+			return found == nil
+		},
+	)
+	if found == nil {
+		t.Fatalf("no %s segment starting with %q", label, prefix)
+	}
+	return
+}
+
+// drop returns the drop of the segment into the container at the index
+func drop(t *testing.T, seg, container *structure.Segment, index int) edit.Drop {
+	drops, e := edit.Drops(structure.Runes(src), seg)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, d := range drops {
+		if d.Container == container && d.Index == index {
+			return d
+		}
+	}
+	t.Fatalf("%s cannot be dropped at %d in %s", seg, index, container)
+	return edit.Drop{}
+}
+
+func TestMove(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		label     string
+		prefix    string
+		container func(tr *structure.Tree, txt string) *structure.Segment
+		index     int
+		from, to  string
+	}{
+		{
+			"statement", "assign", "a := 1",
+			func(tr *structure.Tree, txt string) *structure.Segment { return find(t, tr, txt, "block", "{\n\ta") },
+			3,
+			"{\n\ta := 1\n\tb(a, 2, \"x\")\n\tif a > 0 {\n\t\tc()\n\t}\n}",
+			"{\n\tb(a, 2, \"x\")\n\tif a > 0 {\n\t\tc()\n\t}\n\ta := 1\n}",
+		},
+		{
+			"argument", "arg", "2",
+			func(tr *structure.Tree, txt string) *structure.Segment { return find(t, tr, txt, "call", "b(") },
+			0,
+			`b(a, 2, "x")`, `b(2, a, "x")`,
+		},
+		{
+			"element", "element", "3",
+			func(tr *structure.Tree, txt string) *structure.Segment {
+				return find(t, tr, txt, "composite", "[]int{\n")
+			},
+			2,
+			"{1, 2, 3}\n\nvar w = []int{\n\t4,\n\t5,\n}", "{1, 2}\n\nvar w = []int{\n\t4,\n\t5,\n\t3,\n}",
+		},
+		{
+			"only child", "call", "c()",
+			func(tr *structure.Tree, txt string) *structure.Segment { return find(t, tr, txt, "block", "{\n\ta") },
+			3,
+			"if a > 0 {\n\t\tc()\n\t}\n}", "if a > 0 {}\n\tc()\n}",
+		},
+	} {
+		d := doc.New()
+		if e := d.Insert(0, src); e != nil {
+			t.Fatal(e)
+		}
+		h := undo.New(d)
+		tr := golang.Parse(d)
+		d.Watch(func(ev doc.Event) { tr.Apply(d, ev) })
+		seg := find(t, tr, src, c.label, c.prefix)
+		if e := edit.Move(h, seg, drop(t, seg, c.container(tr, src), c.index)); e != nil {
+			t.Fatalf("%s: %v", c.name, e)
+		}
+		got := d.Text()
+		if want := strings.Replace(src, c.from, c.to, 1); got != want {
+			t.Errorf("%s: moved to\n%s\nwant\n%s", c.name, got, want)
+		}
+		if n := h.Current(); len(n.Events) != 1 || n.Events[0].Kind != doc.Move {
+			t.Errorf("%s: the move was recorded as %d events", c.name, len(n.Events))
+		}
+		if e := h.Undo(); e != nil || d.Text() != src {
+			t.Errorf("%s: undo gave %v\n%s", c.name, e, d.Text())
+		}
+	}
+}
+
+func TestDrops(t *testing.T) {
+	tr := golang.Parse(structure.Runes(src))
+	ifStmt := find(t, tr, src, "if", "if")
+	drops, e := edit.Drops(structure.Runes(src), ifStmt)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, d := range drops {
+		if d.At > ifStmt.Start() && d.At < ifStmt.End() {
+			t.Errorf("%s can be dropped inside itself at %d", ifStmt, d.At)
+		}
+		if d.Container != ifStmt.Parent {
+			t.Errorf("%s can be dropped into %s", ifStmt, d.Container)
+		}
+	}
+	if len(drops) != 2 {
+		t.Errorf("expected 2 drops for %s, found %d", ifStmt, len(drops))
+	}
+	if _, e = edit.Drops(structure.Runes(src), tr.Root()); e != edit.ErrRoot {
+		t.Errorf("the root can be dragged")
+	}
+	seg := find(t, tr, src, "arg", "a")
+	if _, e = edit.MoveEvent(structure.Runes(src), seg, edit.Drop{Container: tr.Root()}); e != edit.ErrDrop {
+		t.Errorf("an argument can be dropped at the top level")
+	}
+}
+
+// TestMovesParse moves every statement, argument and element of a file to each of its drops and checks that the
+// result is still valid Go
+func TestMovesParse(t *testing.T) {
+	tr := golang.Parse(structure.Runes(src))
+	var segs []*structure.Segment
+	tr.Walk(
+		func(s *structure.Segment) bool {
+			switch s.Label {
+			case "assign", "expr", "if", "arg", "element", "block", "call", "var":
+				segs = append(segs, s)
+			}
+			return true
+		},
+	)
+	moves := 0
+	for _, seg := range segs {
+		drops, e := edit.Drops(structure.Runes(src), seg)
+		if e == edit.ErrFixed {
+			continue
+		}
+		if e != nil {
+			t.Fatal(e)
+		}
+		for _, dr := range drops {
+			ev, e := edit.MoveEvent(structure.Runes(src), seg, dr)
+			if e != nil {
+				t.Fatal(e)
+			}
+			d := doc.New()
+			if e = d.Insert(0, src); e != nil {
+				t.Fatal(e)
+			}
+			if e = d.Apply(ev); e != nil {
+				t.Fatalf("moving %s to %d: %v", seg, dr.At, e)
+			}
+			if _, e = parser.ParseFile(token.NewFileSet(), "", d.Text(), 0); e != nil {
+				t.Errorf("moving %s to %d gave invalid code: %v\n%s", seg, dr.At, e, d.Text())
+			}
+			moves++
+		}
+	}
+	if moves < 20 {
+		t.Errorf("only %d moves were tried", moves)
+	}
+}
+
+// TestStep checks that a segment steps past the siblings beside it and no further
+func TestStep(t *testing.T) {
+	for _, c := range []struct {
+		prefix string
+		dir    int
+		want   string
+	}{
+		{"2", -1, `b(2, a, "x")`},
+		{"2", 1, `b(a, "x", 2)`},
+		{"a,", -1, ""},
+	} {
+		d := doc.New()
+		if e := d.Insert(0, src); e != nil {
+			t.Fatal(e)
+		}
+		h := undo.New(d)
+		tr := golang.Parse(d)
+		d.Watch(func(ev doc.Event) { tr.Apply(d, ev) })
+		seg := find(t, tr, src, "arg", c.prefix)
+		dr, e := edit.Step(d, seg, c.dir)
+		if c.want == "" {
+			if e != edit.ErrDrop {
+				t.Errorf("%s stepped %d past the end: %v", c.prefix, c.dir, e)
+			}
+			continue
+		}
+		if e != nil {
+			t.Fatalf("%s: %v", c.prefix, e)
+		}
+		if e = edit.Move(h, seg, dr); e != nil {
+			t.Fatal(e)
+		}
+		if want := strings.Replace(src, `b(a, 2, "x")`, c.want, 1); d.Text() != want {
+			t.Errorf("%s stepped %d to\n%s", c.prefix, c.dir, d.Text())
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Package export assembles documents from their journals into plain files, for the people and tools that do not read
+// glom journals.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/grammar"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// ErrNoFile is returned for a journal that does not name its source file when no output file is given
+var ErrNoFile = errors.New("journal does not name its file")
+
+// Options controls how documents are exported
+type Options struct {
+	// Node is the ID or bookmark name of the node of the history to export, the current node if empty
+	Node string
+	// Gofmt formats Go files before they are written
+	Gofmt bool
+	// Out is the directory files are written to. Relative file names are kept below it and absolute ones are written
+	// by their base name. Without it files are written back where they came from.
+	Out string
+	// JournalDir is where the journals of source files are found
+	JournalDir string
+	// Notes writes each file as Markdown with its notes between its code, to the file with NotesExt added to its name
+	Notes bool
+	// Languages is what the language of a file is detected among for its notes, the built in ones if it is nil
+	Languages *grammar.Languages
+}
+
+// NotesExt is added to the name of a file for the Markdown of its notes
+const NotesExt = ".notes.md"
+
+// History restores the history in a journal file and moves it to a node given by its ID or bookmark name. An empty
+// node leaves the history at its current node. The file the journal is for is returned with it.
+func History(path, node string) (t *undo.Tree, file string, e error) {
+	var j *journal.Journal
+	var records []journal.Record
+	if j, records, e = journal.Open(path); e != nil {
+		return
+	}
+	if e = j.Close(); E.Chk(e) {
+		return
+	}
+	t = undo.New(doc.New())
+	if e = journal.Restore(t, records); e != nil {
+		return
+	}
+	file = journal.File(records)
+	if node == "" {
+		return
+	}
+	var n *undo.Node
+	if id, ae := strconv.Atoi(node); ae == nil {
+		if n, e = t.Node(id); e != nil {
+			return
+		}
+	} else {
+		var ok bool
+		if n, ok = t.Lookup(node); !ok {
+			return nil, file, fmt.Errorf("no node is named %q", node)
+		}
+	}
+	e = t.Switch(n.ID)
+	return
+}
+
+// Format runs gofmt on the text of Go files and returns other files unchanged
+func Format(file, text string) (string, error) {
+	if filepath.Ext(file) != ".go" {
+		return text, nil
+	}
+	b, e := format.Source([]byte(text))
+	if e != nil {
+		return text, fmt.Errorf("gofmt %s: %w", file, e)
+	}
+	return string(b), nil
+}
+
+// Notes renders a document as Markdown with its notes, segmented by the language detected for its file among the
+// languages, or the built in ones if they are nil
+func Notes(file string, d *doc.Document, languages *grammar.Languages) (md string, e error) {
+	if languages == nil {
+		languages = grammar.Builtin()
+	}
+	l := languages.Detect(file, d.Text())
+	var sb strings.Builder
+	if e = annotate.Markdown(&sb, d, l.Parse(d), l.Name()); E.Chk(e) {
+		return
+	}
+	return sb.String(), nil
+}
+
+// Target returns the path a file is exported to
+func (o Options) Target(file string) string {
+	switch {
+	case o.Out == "":
+		return file
+	case filepath.IsAbs(file):
+		return filepath.Join(o.Out, filepath.Base(file))
+	}
+	return filepath.Join(o.Out, file)
+}
+
+// Locate returns the journal of a name given on the command line, with the source file it is for if that is known
+// from the name. A name ending in .journal is the path of a journal, anything else is a source file whose journal is
+// in the directory.
+func Locate(name, dir string) (path, file string) {
+	if strings.HasSuffix(name, ".journal") {
+		return name, ""
+	}
+	return journal.Path(dir, name), name
+}
+
+// Export materializes each named file at the node of its history and writes it out. A name ending in .journal is a
+// journal file and is written to the file it names, anything else is a source file whose journal is looked up in the
+// journal directory. It returns the paths written.
+func Export(names []string, o Options) (written []string, e error) {
+	if o.JournalDir == "" {
+		o.JournalDir = journal.Dir()
+	}
+	for _, name := range names {
+		path, file := Locate(name, o.JournalDir)
+		if _, e = os.Stat(path); e != nil {
+			return written, fmt.Errorf("%s has no journal: %w", name, e)
+		}
+		var t *undo.Tree
+		var named string
+		if t, named, e = History(path, o.Node); e != nil {
+			return written, fmt.Errorf("%s: %w", name, e)
+		}
+		if file == "" {
+			if file = named; file == "" {
+				return written, fmt.Errorf("%s: %w", name, ErrNoFile)
+			}
+		}
+		text, target := t.Doc().Text(), o.Target(file)
+		switch {
+		case o.Notes:
+			// the notes are anchored in the document as it is, so it is not formatted
+			if text, e = Notes(file, t.Doc(), o.Languages); e != nil {
+				return
+			}
+			target += NotesExt
+		case o.Gofmt:
+			if text, e = Format(file, text); e != nil {
+				return
+			}
+		}
+		if e = os.MkdirAll(filepath.Dir(target), 0755); E.Chk(e) {
+			return
+		}
+		if e = ioutil.WriteFile(target, []byte(text), 0644); E.Chk(e) {
+			return
+		}
+		D.Ln("exported", name, "to", target)
+		written = append(written, target)
+	}
+	return
+}
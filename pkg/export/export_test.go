@@ -0,0 +1,134 @@
+package export_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/export"
+	"github.com/p9c/glom/pkg/grammar"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// record writes the journal of a file with two versions of it, the first of them bookmarked
+func record(t *testing.T, dir, file string, versions ...string) {
+	j, _, e := journal.Open(journal.Path(dir, file))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer j.Close()
+	if e = j.Append(journal.Record{Kind: journal.FileRecord, Name: file}); e != nil {
+		t.Fatal(e)
+	}
+	h := undo.New(doc.New())
+	journal.Attach(j, h)
+	for i, v := range versions {
+		if _, e = h.Edit(
+			func(d *doc.Document) (e error) {
+				if e = d.Delete(0, d.Len()); e != nil {
+					return
+				}
+				return d.Insert(0, v)
+			},
+		); e != nil {
+			t.Fatal(e)
+		}
+		if i == 0 {
+			if e = h.Name(h.Current().ID, "first"); e != nil {
+				t.Fatal(e)
+			}
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	journals, out := filepath.Join(dir, "journals"), filepath.Join(dir, "out")
+	src := filepath.Join(dir, "main.go")
+	record(t, journals, src, "package main\nfunc main(){}\n", "package main\nfunc main() { println() }\n")
+	for _, c := range []struct {
+		name string
+		o    export.Options
+		want string
+	}{
+		{src, export.Options{}, "package main\nfunc main() { println() }\n"},
+		{src, export.Options{Node: "first", Gofmt: true}, "package main\n\nfunc main() {}\n"},
+		{src, export.Options{Node: "1"}, "package main\nfunc main(){}\n"},
+		{journal.Path(journals, src), export.Options{Gofmt: true}, "package main\n\nfunc main() { println() }\n"},
+	} {
+		c.o.Out, c.o.JournalDir = out, journals
+		written, e := export.Export([]string{c.name}, c.o)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if len(written) != 1 || written[0] != filepath.Join(out, "main.go") {
+			t.Fatalf("wrote %v", written)
+		}
+		b, _ := ioutil.ReadFile(written[0])
+		if string(b) != c.want {
+			t.Errorf("exported %q with %+v, want %q", b, c.o, c.want)
+		}
+	}
+	if _, e = export.Export([]string{src}, export.Options{Node: "missing", JournalDir: journals, Out: out}); e == nil {
+		t.Error("exporting a missing bookmark worked")
+	}
+	if _, e = export.Export([]string{filepath.Join(dir, "other.go")}, export.Options{JournalDir: journals}); e == nil {
+		t.Error("exporting a file without a journal worked")
+	}
+	// without an output directory the file itself is written
+	if _, e = export.Export([]string{src}, export.Options{JournalDir: journals}); e != nil {
+		t.Fatal(e)
+	}
+	if b, _ := ioutil.ReadFile(src); string(b) != "package main\nfunc main() { println() }\n" {
+		t.Errorf("the file was written as %q", b)
+	}
+}
+
+// TestExportNotes checks that the notes of a file are exported as Markdown beside where the file would go
+func TestExportNotes(t *testing.T) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	journals, out := filepath.Join(dir, "journals"), filepath.Join(dir, "out")
+	src := filepath.Join(dir, "main.go")
+	record(t, journals, src, "package main\n\nfunc main() {}\n")
+	j, records, e := journal.Open(journal.Path(journals, src))
+	if e != nil {
+		t.Fatal(e)
+	}
+	h := undo.New(doc.New())
+	if e = journal.Restore(h, records); e != nil {
+		t.Fatal(e)
+	}
+	journal.Attach(j, h)
+	seg := grammar.Go.Parse(h.Doc()).EnclosingRange(14, 28)
+	if e = annotate.Set(h, seg, "n1", "starts here"); e != nil {
+		t.Fatal(e)
+	}
+	if e = j.Close(); e != nil {
+		t.Fatal(e)
+	}
+	written, e := export.Export([]string{src}, export.Options{JournalDir: journals, Out: out, Notes: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(written) != 1 || written[0] != filepath.Join(out, "main.go"+export.NotesExt) {
+		t.Fatalf("wrote %v", written)
+	}
+	b, _ := ioutil.ReadFile(written[0])
+	if want := "```go\npackage main\n```\n\n"; !strings.HasPrefix(string(b), want) ||
+		!strings.Contains(string(b), "> starts here\n") {
+		t.Errorf("exported notes\n%s", b)
+	}
+}
@@ -0,0 +1,264 @@
+// Package fold keeps track of the segments of a document that are folded in, showing a one line summary in place of
+// their text. Folds follow the edits made to the document and can be stored so that they survive a restart.
+package fold
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// MaxSummary is the number of runes a summary is cut to
+const MaxSummary = 80
+
+// Fold is a folded segment, identified by its range and label
+type Fold struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Label  string `json:"label"`
+}
+
+// matches reports whether the fold is for the segment
+func (f Fold) matches(seg *structure.Segment) bool {
+	return seg.Start() == f.Offset && seg.Len == f.Length && seg.Label == f.Label
+}
+
+// Set is the folds of one document
+type Set struct {
+	folds []Fold
+	// changes counts the changes made to the folds
+	changes int
+}
+
+// New creates a set without any folds
+func New() *Set {
+	return &Set{}
+}
+
+// Folds returns the folds in the order of their position in the document
+func (s *Set) Folds() []Fold {
+	return append([]Fold(nil), s.folds...)
+}
+
+// Changes returns a count of the changes made to the folds, which differs from an earlier count when they may be
+// different
+func (s *Set) Changes() int {
+	return s.changes
+}
+
+// Apply moves the folds along with an event applied to the document. Folds whose text was removed are dropped.
+func (s *Set) Apply(ev doc.Event) {
+	out := s.folds[:0]
+	for _, f := range s.folds {
+		if f.Offset, f.Length = doc.Follow(ev, f.Offset, f.Length); f.Length > 0 {
+			out = append(out, f)
+		}
+	}
+	s.folds = out
+	s.sort()
+}
+
+func (s *Set) sort() {
+	s.changes++
+	sort.Slice(
+		s.folds, func(i, j int) bool {
+			if s.folds[i].Offset != s.folds[j].Offset {
+				return s.folds[i].Offset < s.folds[j].Offset
+			}
+			return s.folds[i].Length > s.folds[j].Length
+		},
+	)
+}
+
+// Folded reports whether the segment is folded in
+func (s *Set) Folded(seg *structure.Segment) bool {
+	for _, f := range s.folds {
+		if f.matches(seg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fold folds the segment in. The root and segments that cannot hold others are not folded.
+func (s *Set) Fold(seg *structure.Segment) {
+	if seg.Parent == nil || !seg.Container() || seg.Len == 0 || s.Folded(seg) {
+		return
+	}
+	s.folds = append(s.folds, Fold{Offset: seg.Start(), Length: seg.Len, Label: seg.Label})
+	s.sort()
+}
+
+// Unfold shows the text of the segment again
+func (s *Set) Unfold(seg *structure.Segment) {
+	out := s.folds[:0]
+	for _, f := range s.folds {
+		if !f.matches(seg) {
+			out = append(out, f)
+		}
+	}
+	s.folds = out
+	s.changes++
+}
+
+// Toggle folds the segment if it is open and unfolds it otherwise, and reports whether it is now folded
+func (s *Set) Toggle(seg *structure.Segment) (folded bool) {
+	if s.Folded(seg) {
+		s.Unfold(seg)
+		return false
+	}
+	s.Fold(seg)
+	return s.Folded(seg)
+}
+
+// UnfoldAll removes every fold
+func (s *Set) UnfoldAll() {
+	s.folds = s.folds[:0]
+	s.changes++
+}
+
+// FoldTo unfolds everything and then folds the outermost segments below the given depth that span more than one
+// line, so that only the first depth levels of the document stay open
+func (s *Set) FoldTo(src structure.Source, t *structure.Tree, depth int) {
+	s.UnfoldAll()
+	t.Walk(
+		func(seg *structure.Segment) bool {
+			if seg.Depth() <= depth || !seg.Container() {
+				return true
+			}
+			if !multiline(src, seg) {
+				return true
+			}
+			s.folds = append(s.folds, Fold{Offset: seg.Start(), Length: seg.Len, Label: seg.Label})
+			return false
+		},
+	)
+	s.sort()
+}
+
+// multiline reports whether the segment contains a line break
+func multiline(src structure.Source, seg *structure.Segment) bool {
+	for i := seg.Start(); i < seg.End(); i++ {
+		if src.RuneAt(i) == '\n' {
+			return true
+		}
+	}
+	return false
+}
+
+// Segments returns the folded segments of the tree that are not inside another folded segment, in document order.
+// Folds that no longer match a segment are left out.
+func (s *Set) Segments(t *structure.Tree) (segs []*structure.Segment) {
+	end := -1
+	for _, f := range s.folds {
+		if f.Offset < end {
+			continue
+		}
+		for _, seg := range t.Path(f.Offset) {
+			if f.matches(seg) {
+				segs = append(segs, seg)
+				end = seg.End()
+				break
+			}
+		}
+	}
+	return
+}
+
+// Summary returns the text shown in place of a folded segment. The contents of its bracketed parts are replaced by an
+// ellipsis, like func(...) {…}, and line breaks are joined into single spaces.
+func Summary(src structure.Source, seg *structure.Segment) string {
+	var sb strings.Builder
+	summarize(&sb, src, seg, true)
+	out := []rune(joinLines(sb.String()))
+	if len(out) > MaxSummary {
+		out = append(out[:MaxSummary-1], '…')
+	}
+	return string(out)
+}
+
+// summarize writes the summary of a segment. The outermost segment keeps the text of its opening so that the summary
+// still shows what it is, bracketed parts inside it are reduced to their delimiters.
+func summarize(sb *strings.Builder, src structure.Source, seg *structure.Segment, top bool) {
+	start, end := seg.Inner()
+	if seg.Open > 0 && seg.Close > 0 && !seg.Broken {
+		if top {
+			// the children in the opening, such as the function of a call, are summarized themselves
+			at := seg.Start()
+			for _, ch := range seg.Children {
+				if ch.Start() >= start {
+					break
+				}
+				write(sb, src, at, ch.Start())
+				summarize(sb, src, ch, false)
+				at = ch.End()
+			}
+			write(sb, src, at, start)
+		} else {
+			write(sb, src, seg.Start(), start)
+		}
+		switch {
+		case strings.TrimSpace(text(src, start, end)) == "":
+			write(sb, src, start, end)
+		case src.RuneAt(start-1) == '{':
+			sb.WriteString("…")
+		default:
+			sb.WriteString("...")
+		}
+		write(sb, src, end, seg.End())
+		return
+	}
+	at := seg.Start()
+	for _, ch := range seg.Children {
+		write(sb, src, at, ch.Start())
+		if ch.Container() {
+			summarize(sb, src, ch, false)
+		} else {
+			write(sb, src, ch.Start(), ch.End())
+		}
+		at = ch.End()
+	}
+	write(sb, src, at, seg.End())
+}
+
+// text returns the runes of the source between two offsets
+func text(src structure.Source, start, end int) string {
+	var sb strings.Builder
+	write(&sb, src, start, end)
+	return sb.String()
+}
+
+func write(sb *strings.Builder, src structure.Source, start, end int) {
+	for i := start; i < end; i++ {
+		sb.WriteRune(src.RuneAt(i))
+	}
+}
+
+// joinLines replaces each stretch of white space containing a line break with a single space
+func joinLines(s string) string {
+	var sb strings.Builder
+	var space []rune
+	broken := false
+	flush := func() {
+		if broken {
+			sb.WriteRune(' ')
+		} else {
+			sb.WriteString(string(space))
+		}
+		space, broken = space[:0], false
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = append(space, r)
+			broken = broken || r == '\n'
+			continue
+		}
+		flush()
+		sb.WriteRune(r)
+	}
+	flush()
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,140 @@
+package fold_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/fold"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/structure/golang"
+)
+
+const src = `package main
+
+func (s *State) Fn(gtx l.Context) l.Dimensions {
+	return s.Flex().Rigid(func(gtx l.Context) l.Dimensions {
+		return l.Dimensions{}
+	}).Fn(gtx)
+}
+
+var names = []string{
+	"a",
+	"b",
+}
+`
+
+// find returns the innermost segment with the label containing the first occurrence of a text
+func find(t *testing.T, tr *structure.Tree, txt, label string) *structure.Segment {
+	path := tr.Path(len([]rune(src[:strings.Index(src, txt)])))
+	for i := len(path) - 1; i >= 0; i-- {
+		if path[i].Label == label {
+			return path[i]
+		}
+	}
+	t.Fatalf("no %s at %q", label, txt)
+	return nil
+}
+
+func TestSummary(t *testing.T) {
+	tr := golang.Parse(structure.Runes(src))
+	for _, c := range []struct {
+		at, label, want string
+	}{
+		{"func (s", "func", "func (...) Fn(...) l.Dimensions {…}"},
+		{"func(gtx", "funclit", "func(...) l.Dimensions {…}"},
+		{"Rigid(func", "call", "s.Flex().Rigid(...)"},
+		{`"a"`, "composite", "[]string{…}"},
+	} {
+		if got := fold.Summary(structure.Runes(src), find(t, tr, c.at, c.label)); got != c.want {
+			t.Errorf("summary of %s is %q, want %q", c.label, got, c.want)
+		}
+	}
+}
+
+func TestView(t *testing.T) {
+	d := doc.New()
+	if e := d.Insert(0, src); e != nil {
+		t.Fatal(e)
+	}
+	tr := golang.Parse(d)
+	s := fold.New()
+	d.Watch(
+		func(ev doc.Event) {
+			tr.Apply(d, ev)
+			s.Apply(ev)
+		},
+	)
+	fn := find(t, tr, "func (s", "func")
+	if !s.Toggle(fn) || !s.Folded(fn) {
+		t.Fatal("the function did not fold")
+	}
+	s.Fold(find(t, tr, "func(gtx", "funclit"))
+	s.Fold(find(t, tr, `"a"`, "composite"))
+	v := s.Project(d, tr)
+	want := "package main\n\nfunc (...) Fn(...) l.Dimensions {…}\n\nvar names = []string{…}\n"
+	if v.Text != want {
+		t.Fatalf("view is %q, want %q", v.Text, want)
+	}
+	at := strings.Index(src, "var")
+	shown := len([]rune(want[:strings.Index(want, "var")]))
+	if got := v.Display(at); got != shown {
+		t.Errorf("offset %d is shown at %d, want %d", at, got, shown)
+	}
+	if got := v.Source(shown); got != at {
+		t.Errorf("offset %d of the view is %d of the document, want %d", shown, got, at)
+	}
+	if got := v.Source(strings.Index(want, "Fn(")); got != fn.Start() || v.Folded(strings.Index(want, "Fn(")) != fn {
+		t.Errorf("offset in the summary maps to %d", got)
+	}
+	// folds follow edits in front of them
+	if e := d.Insert(len("package main\n"), "\n// comment\n"); e != nil {
+		t.Fatal(e)
+	}
+	if got := s.Project(d, tr).Text; got != "package main\n\n// comment\n"+want[len("package main\n"):] {
+		t.Errorf("view after an insertion is %q", got)
+	}
+	s.Unfold(s.Segments(tr)[0])
+	if got := s.Segments(tr); len(got) != 2 || got[0].Label != "funclit" {
+		t.Errorf("the fold inside the function did not survive it being unfolded: %v", got)
+	}
+}
+
+func TestFoldTo(t *testing.T) {
+	tr := golang.Parse(structure.Runes(src))
+	s := fold.New()
+	s.FoldTo(structure.Runes(src), tr, 1)
+	var labels []string
+	for _, seg := range s.Segments(tr) {
+		labels = append(labels, seg.Label)
+	}
+	if got := strings.Join(labels, " "); got != "block spec" {
+		t.Errorf("folded to depth 1 are %q", got)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	tr := golang.Parse(structure.Runes(src))
+	s := fold.New()
+	s.Fold(find(t, tr, "func (s", "func"))
+	if e = s.Save(dir, "main.go"); e != nil {
+		t.Fatal(e)
+	}
+	var loaded *fold.Set
+	if loaded, e = fold.Load(dir, "main.go"); e != nil {
+		t.Fatal(e)
+	}
+	if got := loaded.Segments(tr); len(got) != 1 || got[0].Label != "func" {
+		t.Errorf("loaded folds are %v", got)
+	}
+	if loaded, e = fold.Load(dir, "other.go"); e != nil || len(loaded.Folds()) != 0 {
+		t.Errorf("a file without folds loaded %v, %v", loaded.Folds(), e)
+	}
+}
@@ -0,0 +1,9 @@
+package fold
+
+import (
+	"github.com/p9c/glom/version"
+	"github.com/p9c/log"
+)
+
+var subsystem = log.AddLoggerSubsystem(version.PathBase)
+var F, E, W, I, D, T log.LevelPrinter = log.GetLogPrinterSet(subsystem)
@@ -0,0 +1,73 @@
+package fold
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/p9c/glom/pkg/appdata"
+)
+
+// state is the stored form of the folds of a file
+type state struct {
+	File  string `json:"file"`
+	Folds []Fold `json:"folds"`
+}
+
+// DirName is the name of the directory in the data directory of glom that fold states are stored in
+const DirName = "folds"
+
+// Dir returns the directory the fold states of files are stored in
+func Dir() string {
+	return filepath.Join(appdata.Dir("glom", false), DirName)
+}
+
+// StatePath returns the path of the fold state of a file in a directory. The name is derived from the absolute path
+// of the file so that files with the same name in different places do not share their folds.
+func StatePath(dir, file string) string {
+	if abs, e := filepath.Abs(file); !E.Chk(e) {
+		file = abs
+	}
+	sum := sha256.Sum256([]byte(file))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// Save writes the folds of a file to its state in the directory
+func (s *Set) Save(dir, file string) (e error) {
+	var b []byte
+	if b, e = json.MarshalIndent(state{File: file, Folds: s.folds}, "", "\t"); E.Chk(e) {
+		return
+	}
+	if e = os.MkdirAll(dir, 0700); E.Chk(e) {
+		return
+	}
+	path := StatePath(dir, file)
+	tmp := path + ".tmp"
+	if e = ioutil.WriteFile(tmp, b, 0600); E.Chk(e) {
+		return
+	}
+	// the state is replaced in one step so that a crash never leaves half of it behind
+	return os.Rename(tmp, path)
+}
+
+// Load reads the folds of a file from its state in the directory. A file without a stored state has no folds.
+func Load(dir, file string) (s *Set, e error) {
+	s = New()
+	var b []byte
+	if b, e = ioutil.ReadFile(StatePath(dir, file)); e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	var st state
+	if e = json.Unmarshal(b, &st); E.Chk(e) {
+		return
+	}
+	s.folds = st.Folds
+	s.sort()
+	return
+}
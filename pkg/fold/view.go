@@ -0,0 +1,92 @@
+package fold
+
+import (
+	"strings"
+
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// View is the text of a document as it is shown with its folded segments replaced by their summaries, and maps
+// offsets between the document and the shown text
+type View struct {
+	Text  string
+	spans []span
+}
+
+// span is a folded segment, at the range start to end of the document and at to at+length of the view
+type span struct {
+	seg        *structure.Segment
+	start, end int
+	at, length int
+}
+
+// Project builds the view of the source with the folded segments of the set
+func (s *Set) Project(src structure.Source, t *structure.Tree) (v *View) {
+	v = &View{}
+	var sb strings.Builder
+	at, shown := 0, 0
+	for _, seg := range s.Segments(t) {
+		write(&sb, src, at, seg.Start())
+		shown += seg.Start() - at
+		sum := []rune(Summary(src, seg))
+		sb.WriteString(string(sum))
+		v.spans = append(v.spans, span{seg: seg, start: seg.Start(), end: seg.End(), at: shown, length: len(sum)})
+		shown += len(sum)
+		at = seg.End()
+	}
+	write(&sb, src, at, src.Len())
+	v.Text = sb.String()
+	return
+}
+
+// Display returns the offset in the view of an offset of the document. Offsets inside a folded segment give the
+// start of its summary.
+func (v *View) Display(at int) int {
+	shift := 0
+	for _, sp := range v.spans {
+		switch {
+		case at < sp.start:
+			return at + shift
+		case at < sp.end:
+			return sp.at
+		}
+		shift = sp.at + sp.length - sp.end
+	}
+	return at + shift
+}
+
+// Source returns the offset in the document of an offset in the view. Offsets inside a summary give the start of the
+// folded segment.
+func (v *View) Source(at int) int {
+	shift := 0
+	for _, sp := range v.spans {
+		switch {
+		case at < sp.at:
+			return at - shift
+		case at < sp.at+sp.length:
+			return sp.start
+		}
+		shift = sp.at + sp.length - sp.end
+	}
+	return at - shift
+}
+
+// Folded returns the folded segment whose summary is shown at an offset of the view
+func (v *View) Folded(at int) *structure.Segment {
+	for _, sp := range v.spans {
+		if at >= sp.at && at < sp.at+sp.length {
+			return sp.seg
+		}
+	}
+	return nil
+}
+
+// Hidden reports whether an offset of the document lies inside a folded segment, after its first rune
+func (v *View) Hidden(at int) bool {
+	for _, sp := range v.spans {
+		if at > sp.start && at < sp.end {
+			return true
+		}
+	}
+	return false
+}
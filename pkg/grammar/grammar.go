@@ -0,0 +1,225 @@
+// Package grammar loads the languages glom knows from grammar files, which describe the brackets, literals and
+// comments a language is segmented by and the rules it is highlighted with, so that a language can be added without
+// building glom again. Go is built in, along with grammars for some of the languages found next to it in
+// repositories, and grammar files in the data directory are added to them or replace them.
+package grammar
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/p9c/glom/pkg/highlight"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// Start is the name of the state the lexer of a grammar starts in
+const Start = "main"
+
+// Grammar is the contents of a grammar file
+type Grammar struct {
+	Name string `json:"name"`
+	// Aliases are other names of the language, which modelines can name it by
+	Aliases []string `json:"aliases"`
+	// Extensions are the extensions of the files of the language, with their dot
+	Extensions []string `json:"extensions"`
+	// Files are names of files of the language that have no extension of it, like Makefile
+	Files []string `json:"files"`
+	// Interpreters are the programs a #! line names for scripts in the language
+	Interpreters  []string    `json:"interpreters"`
+	Brackets      [][2]string `json:"brackets"`
+	Strings       []Quote     `json:"strings"`
+	LineComments  []string    `json:"lineComments"`
+	BlockComments [][2]string `json:"blockComments"`
+	// Indent makes the blocks of lines that are indented further than the line before them segments
+	Indent   bool `json:"indent"`
+	TabWidth int  `json:"tabWidth"`
+	// States are the rules of the lexer in each of its states, starting in the main state
+	States map[string][]Rule `json:"states"`
+}
+
+// Quote is a literal such as a string, ended by its closing delimiter or else the end of the line if it is not
+// multiline
+type Quote struct {
+	Open      string `json:"open"`
+	Close     string `json:"close"`
+	Escape    string `json:"escape"`
+	Multiline bool   `json:"multiline"`
+}
+
+// Rule is a regular expression matched at the position of the lexer, the class of the token it matches and the state
+// the lexer goes to after it, or stays in if Next is empty. An expression starting with ^ only matches at the start of
+// a line.
+type Rule struct {
+	Match string `json:"match"`
+	Class string `json:"class"`
+	Next  string `json:"next"`
+}
+
+// Parse decodes a grammar file, rejecting fields it does not know
+func Parse(b []byte) (g *Grammar, e error) {
+	g = &Grammar{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if e = dec.Decode(g); e != nil {
+		return nil, e
+	}
+	if g.Name == "" {
+		return nil, fmt.Errorf("grammar has no name")
+	}
+	return
+}
+
+// Syntax returns the syntax the documents of the grammar are segmented by
+func (g *Grammar) Syntax() (syn *structure.Syntax, e error) {
+	syn = &structure.Syntax{Indent: g.Indent, TabWidth: g.TabWidth, LineComments: g.LineComments}
+	if syn.TabWidth <= 0 {
+		syn.TabWidth = structure.Default.TabWidth
+	}
+	for _, b := range g.Brackets {
+		if b[0] == "" || b[1] == "" {
+			return nil, fmt.Errorf("bracket %q has an empty delimiter", b)
+		}
+		syn.Brackets = append(syn.Brackets, structure.Pair{Open: b[0], Close: b[1]})
+	}
+	for _, b := range g.BlockComments {
+		if b[0] == "" || b[1] == "" {
+			return nil, fmt.Errorf("block comment %q has an empty delimiter", b)
+		}
+		syn.BlockComments = append(syn.BlockComments, structure.Pair{Open: b[0], Close: b[1]})
+	}
+	for _, q := range g.Strings {
+		if q.Open == "" || q.Close == "" {
+			return nil, fmt.Errorf("string %q has an empty delimiter", q.Open+q.Close)
+		}
+		esc, n := utf8.DecodeRuneInString(q.Escape)
+		if n != len(q.Escape) {
+			return nil, fmt.Errorf("escape %q of string %q is not a single rune", q.Escape, q.Open)
+		}
+		if n == 0 {
+			esc = 0
+		}
+		syn.Strings = append(
+			syn.Strings, structure.Quote{Open: q.Open, Close: q.Close, Escape: esc, Multiline: q.Multiline},
+		)
+	}
+	return
+}
+
+// rule is a compiled rule, next is the index of its state or -1 to stay
+type rule struct {
+	re    *regexp.Regexp
+	class highlight.Class
+	next  int
+	// bol is set for rules that only match at the start of a line
+	bol bool
+}
+
+// lexer highlights a line with the rules of the state it is in. At each position the first rule that matches a
+// token there is taken, and where none does a word or another rune is left plain.
+type lexer struct {
+	states [][]rule
+}
+
+// Lexer compiles the rules of the grammar into its lexer
+func (g *Grammar) Lexer() (lx highlight.Lexer, e error) {
+	if _, ok := g.States[Start]; !ok && len(g.States) > 0 {
+		return nil, fmt.Errorf("grammar has no %s state", Start)
+	}
+	// the main state is state zero, which the first line starts in
+	names := []string{Start}
+	for name := range g.States {
+		if name != Start {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	index := make(map[string]int)
+	for i, name := range names {
+		index[name] = i
+	}
+	l := &lexer{states: make([][]rule, len(names))}
+	for i, name := range names {
+		for _, r := range g.States[name] {
+			cr := rule{bol: strings.HasPrefix(r.Match, "^")}
+			if cr.re, e = regexp.Compile(`\A(?:` + strings.TrimPrefix(r.Match, "^") + `)`); e != nil {
+				return nil, fmt.Errorf("state %s: %w", name, e)
+			}
+			var ok bool
+			if cr.class, ok = highlight.ClassNamed(r.Class); !ok {
+				return nil, fmt.Errorf("state %s: no class %q", name, r.Class)
+			}
+			cr.next = -1
+			if r.Next != "" {
+				if cr.next, ok = index[r.Next]; !ok {
+					return nil, fmt.Errorf("state %s: no state %q", name, r.Next)
+				}
+			}
+			l.states[i] = append(l.states[i], cr)
+		}
+	}
+	return l, nil
+}
+
+// Lex splits a line into tokens with the rules of the grammar
+func (l *lexer) Lex(line []rune, state int) (tokens []highlight.Token, end int) {
+	if state < 0 || state >= len(l.states) {
+		state = 0
+	}
+	s := string(line)
+	// at is the byte offset in the line and pos the rune offset
+	at, pos := 0, 0
+	for at < len(s) {
+		n := 0
+		for _, r := range l.states[state] {
+			if r.bol && at > 0 {
+				continue
+			}
+			loc := r.re.FindStringIndex(s[at:])
+			if loc == nil || loc[1] == 0 {
+				continue
+			}
+			n = loc[1]
+			runes := utf8.RuneCountInString(s[at : at+n])
+			if r.class != highlight.Plain {
+				tokens = append(tokens, highlight.Token{Start: pos, End: pos + runes, Class: r.class})
+			}
+			if r.next >= 0 {
+				state = r.next
+			}
+			pos += runes
+			break
+		}
+		if n > 0 {
+			at += n
+			continue
+		}
+		// a word is skipped whole, so that rules for words never match inside of one
+		for first := true; at < len(s); first = false {
+			c, size := utf8.DecodeRuneInString(s[at:])
+			word := c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+			if !first && !word {
+				break
+			}
+			at += size
+			pos++
+			if !word {
+				break
+			}
+		}
+	}
+	return tokens, state
+}
+
+// names returns the name and the aliases of the grammar in lower case
+func (g *Grammar) names() (out []string) {
+	for _, n := range append([]string{g.Name}, g.Aliases...) {
+		out = append(out, strings.ToLower(n))
+	}
+	return
+}
@@ -0,0 +1,155 @@
+package grammar_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/grammar"
+)
+
+// spans lexes a text in a language and lists its tokens as their class and text, one line of the text to a line
+func spans(l *grammar.Language, txt string) string {
+	d := doc.New()
+	if e := d.Insert(0, txt); e != nil {
+		panic(e)
+	}
+	var out, ln []string
+	prev := 0
+	for _, t := range l.Highlight(d).Tokens(0, d.Len()) {
+		if strings.Contains(d.Slice(prev, t.Start), "\n") {
+			out, ln = append(out, strings.Join(ln, " ")), nil
+		}
+		ln = append(ln, fmt.Sprintf("%s:%s", t.Class, d.Slice(t.Start, t.End)))
+		prev = t.End
+	}
+	return strings.Join(append(out, strings.Join(ln, " ")), "\n")
+}
+
+// TestDetect checks that files are detected by their modeline before their name and their name before their #! line
+func TestDetect(t *testing.T) {
+	ls := grammar.Builtin()
+	for _, c := range []struct{ path, txt, want string }{
+		{"main.go", "package main", "go"},
+		{"ci.YML", "a: 1", "yaml"},
+		{"/home/me/.bashrc", "alias ll='ls -l'", "shell"},
+		{"Cargo.toml", "[package]", "toml"},
+		{"README.md", "# glom", "markdown"},
+		{"run", "#!/bin/sh\necho hi", "shell"},
+		{"run", "#!/usr/bin/env -S LANG=C bash -e\necho hi", "shell"},
+		{"run", "#!/usr/bin/python3\nprint()", "text"},
+		{"notes.txt", "some text\n\n# vim: set ts=2 ft=yaml :\n", "yaml"},
+		{"notes.txt", "#!/bin/sh\n# -*- mode: markdown; fill-column: 80 -*-\n", "markdown"},
+		{"x.json", "// -*- toml -*-\n", "toml"},
+		{"x.json", strings.Repeat("line\n", 100) + "vim:ft=sh\n", "shell"},
+		{"x.json", strings.Repeat("line\n", 6) + "vim:ft=sh\n" + strings.Repeat("line\n", 100), "json"},
+		{"notes.txt", "nothing", "text"},
+	} {
+		if got := ls.Detect(c.path, c.txt).Name(); got != c.want {
+			t.Errorf("%s %q was detected as %s, want %s", c.path, c.txt, got, c.want)
+		}
+	}
+}
+
+// TestBuiltin checks the tokens of the built in grammars, including those of literals that span lines
+func TestBuiltin(t *testing.T) {
+	ls := grammar.Builtin()
+	for _, c := range []struct{ lang, src, want string }{
+		{
+			"json",
+			`{"a": [1.5e3, true, "x\"y"]}`,
+			`operator:{ keyword:"a": operator:[ number:1.5e3 operator:, builtin:true operator:, string:"x\"y" ` +
+				`operator:] operator:}`,
+		},
+		{
+			"yaml",
+			"key: &anchor 'it''s' # note\n- name: x:y\n  truthy: trueish",
+			"keyword:key:  builtin:&anchor string:'it''s' comment:# note\n" +
+				"operator:- keyword:name:  operator::\n" +
+				"keyword:truthy: ",
+		},
+		{
+			"toml",
+			"[server]\nname = \"\"\"multi\nline\"\"\" # c\nport = 0x1F",
+			"keyword:[server]\nkeyword:name = string:\"\"\" string:multi\nstring:line string:\"\"\" comment:# c\n" +
+				"keyword:port = number:0x1F",
+		},
+		{
+			"shell",
+			"if [ \"$1\" = x ]; then echo \"a\n$HOME b\" 'c' # d; fi\nfi",
+			"keyword:if operator:[ string:\" builtin:$1 string:\" operator:= operator:]; keyword:then " +
+				"builtin:echo string:\" string:a\nbuiltin:$HOME string: b string:\" string:'c' comment:# d; fi\n" +
+				"keyword:fi",
+		},
+		{
+			"markdown",
+			"# Title\nSome `code` and **bold**.\n```go\n# not a title\n```\n- [link](url)",
+			"keyword:# Title\nstring:`code` number:**bold**\nstring:```go\nstring:# not a title\nstring:```\n" +
+				"operator:-  builtin:[link](url)",
+		},
+	} {
+		l := ls.Named(c.lang)
+		if l == nil {
+			t.Fatalf("no language %s", c.lang)
+		}
+		if got := spans(l, c.src); got != c.want {
+			t.Errorf("%s %q lexed to\n%s\nwant\n%s", c.lang, c.src, got, c.want)
+		}
+	}
+}
+
+// TestLoad checks that grammar files add languages and replace the built in ones, and that broken files are left out
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"ini.json": `{
+			"name": "ini", "extensions": [".ini"], "brackets": [["[", "]"]], "lineComments": [";"],
+			"states": {"main": [
+				{"match": ";.*", "class": "comment"},
+				{"match": "^\\[", "class": "operator", "next": "section"},
+				{"match": "[\\w.]+\\s*=", "class": "keyword"}
+			], "section": [
+				{"match": "[^\\]]+", "class": "identifier"},
+				{"match": "\\]", "class": "operator", "next": "main"}
+			]}
+		}`,
+		"json.json":  `{"name": "json", "extensions": [".json5"]}`,
+		"bad.json":   `{"name": "bad", "states": {"main": [{"match": "(", "class": "comment"}]}}`,
+		"worse.json": `{"name": "worse", "colour": "red"}`,
+		"notes.txt":  "not a grammar",
+	}
+	for name, content := range files {
+		if e := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	ls, e := grammar.Load(dir)
+	if e == nil || !strings.Contains(e.Error(), "bad.json") || !strings.Contains(e.Error(), "worse.json") {
+		t.Errorf("broken grammars gave %v", e)
+	}
+	if got, want := strings.Join(ls.Names(), " "), "go ini json markdown shell toml yaml"; got != want {
+		t.Errorf("languages are %s, want %s", got, want)
+	}
+	if got := ls.Detect("a.json", "").Name(); got != "text" {
+		t.Errorf("the replaced json grammar still detects a.json as %s", got)
+	}
+	ini := ls.Detect("setup.ini", "")
+	src := "; c\n[core]\nname = x ; y"
+	want := "comment:; c\noperator:[ identifier:core operator:]\nkeyword:name = comment:; y"
+	if got := spans(ini, src); got != want {
+		t.Errorf("ini lexed to\n%s\nwant\n%s", got, want)
+	}
+	d := doc.New()
+	if e = d.Insert(0, src); e != nil {
+		t.Fatal(e)
+	}
+	if seg := ini.Parse(d).Enclosing(strings.Index(src, "core")); seg == nil || seg.Label != "[" {
+		t.Errorf("the section is in %v", seg)
+	}
+	if ls, e = grammar.Load(filepath.Join(dir, "missing")); e != nil || ls.Named("yaml") == nil {
+		t.Errorf("a missing directory gave %v", e)
+	}
+}
@@ -0,0 +1,295 @@
+package grammar
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/p9c/glom/pkg/appdata"
+	"github.com/p9c/glom/pkg/highlight"
+	golex "github.com/p9c/glom/pkg/highlight/golang"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/structure/golang"
+)
+
+// DirName is the name of the directory in the data directory of glom that grammar files are kept in
+const DirName = "grammars"
+
+// Dir returns the directory grammar files are kept in
+func Dir() string {
+	return filepath.Join(appdata.Dir("glom", false), DirName)
+}
+
+// builtin is the grammars glom comes with
+//
+//go:embed grammars/*.json
+var builtin embed.FS
+
+// Language is how the documents of a language are segmented and highlighted
+type Language struct {
+	Grammar *Grammar
+	Syntax  *structure.Syntax
+	// Parser segments the documents of languages that have a parser of their own, the others are segmented by their
+	// syntax
+	Parser structure.Parser
+	Lexer  highlight.Lexer
+}
+
+// Name returns the name of the language
+func (l *Language) Name() string {
+	return l.Grammar.Name
+}
+
+// Parse builds the segment tree of a document of the language
+func (l *Language) Parse(src structure.Source) *structure.Tree {
+	if l.Parser != nil {
+		return structure.ParseWith(src, l.Syntax, l.Parser)
+	}
+	return structure.Parse(src, l.Syntax)
+}
+
+// Highlight lexes a document of the language
+func (l *Language) Highlight(src structure.Source) *highlight.Highlighter {
+	return highlight.New(src, l.Lexer)
+}
+
+// Go is the language of Go source, which has a parser and lexer of its own
+var Go = &Language{
+	Grammar: &Grammar{Name: "go", Aliases: []string{"golang"}, Extensions: []string{".go"}},
+	Syntax:  structure.Default,
+	Parser:  golang.Segment,
+	Lexer:   golex.New(),
+}
+
+// Plain is the language of documents in no language glom knows, which are segmented by their brackets and not
+// highlighted
+var Plain = &Language{
+	Grammar: &Grammar{Name: "text"},
+	Syntax:  structure.Default,
+	Lexer:   &lexer{states: [][]rule{nil}},
+}
+
+// Compile builds the language of a grammar
+func Compile(g *Grammar) (l *Language, e error) {
+	l = &Language{Grammar: g}
+	if l.Syntax, e = g.Syntax(); e != nil {
+		return nil, fmt.Errorf("%s: %w", g.Name, e)
+	}
+	if l.Lexer, e = g.Lexer(); e != nil {
+		return nil, fmt.Errorf("%s: %w", g.Name, e)
+	}
+	return
+}
+
+// Languages is the languages documents are detected as
+type Languages struct {
+	list []*Language
+}
+
+var (
+	builtins     []*Language
+	builtinsOnce sync.Once
+)
+
+// Builtin returns the languages glom comes with
+func Builtin() *Languages {
+	builtinsOnce.Do(
+		func() {
+			ls := &Languages{list: []*Language{Go}}
+			entries, e := builtin.ReadDir("grammars")
+			if E.Chk(e) {
+				return
+			}
+			for _, entry := range entries {
+				var b []byte
+				if b, e = builtin.ReadFile("grammars/" + entry.Name()); E.Chk(e) {
+					continue
+				}
+				if e = ls.add(b); E.Chk(e) {
+				}
+			}
+			builtins = ls.list
+		},
+	)
+	return &Languages{list: append([]*Language{}, builtins...)}
+}
+
+// Load returns the built in languages with the grammar files in a directory, which may be missing, added to them. A
+// grammar file replaces the language with the same name. Files that cannot be used are left out and described by the
+// error, the languages are complete otherwise.
+func Load(dir string) (ls *Languages, e error) {
+	ls = Builtin()
+	var infos []os.FileInfo
+	if infos, e = ioutil.ReadDir(dir); e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	var problems []string
+	for _, info := range infos {
+		if info.IsDir() || filepath.Ext(info.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		var b []byte
+		if b, e = ioutil.ReadFile(path); e == nil {
+			e = ls.add(b)
+		}
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", path, e))
+		}
+	}
+	e = nil
+	if len(problems) > 0 {
+		e = errors.New(strings.Join(problems, "; "))
+	}
+	return
+}
+
+// add compiles a grammar file into a language, replacing the language of the same name
+func (ls *Languages) add(b []byte) (e error) {
+	var g *Grammar
+	if g, e = Parse(b); e != nil {
+		return
+	}
+	var l *Language
+	if l, e = Compile(g); e != nil {
+		return
+	}
+	for i, old := range ls.list {
+		if strings.EqualFold(old.Name(), g.Name) {
+			ls.list[i] = l
+			return
+		}
+	}
+	ls.list = append(ls.list, l)
+	return
+}
+
+// Names returns the names of the languages in order
+func (ls *Languages) Names() (names []string) {
+	for _, l := range ls.list {
+		names = append(names, l.Name())
+	}
+	sort.Strings(names)
+	return
+}
+
+// Named returns the language with a name or alias
+func (ls *Languages) Named(name string) *Language {
+	name = strings.ToLower(name)
+	for _, l := range ls.list {
+		for _, n := range l.Grammar.names() {
+			if n == name {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// Detect returns the language of a file from its text and path. A modeline in the first or last lines of the text
+// naming the language comes first, then the name and extension of the file, then the interpreter on its #! line.
+// Files that are none of these are Plain.
+func (ls *Languages) Detect(path, txt string) *Language {
+	if l := ls.Named(Modeline(txt)); l != nil {
+		return l
+	}
+	base := filepath.Base(path)
+	for _, l := range ls.list {
+		for _, f := range l.Grammar.Files {
+			if f == base {
+				return l
+			}
+		}
+	}
+	ext := strings.ToLower(filepath.Ext(base))
+	for _, l := range ls.list {
+		for _, x := range l.Grammar.Extensions {
+			if ext != "" && strings.ToLower(x) == ext {
+				return l
+			}
+		}
+	}
+	if interp := Interpreter(txt); interp != "" {
+		for _, l := range ls.list {
+			for _, i := range l.Grammar.Interpreters {
+				if i == interp {
+					return l
+				}
+			}
+		}
+	}
+	return Plain
+}
+
+// modelineLines is the number of lines at the start and end of a text that modelines are looked for in
+const modelineLines = 5
+
+var (
+	vimModeline   = regexp.MustCompile(`(?:^|\s)(?:vim?|ex):(?:.*[\s:])?(?:ft|filetype|syntax)=([\w+.-]+)`)
+	emacsModeline = regexp.MustCompile(`-\*-(.*?)-\*-`)
+	emacsMode     = regexp.MustCompile(`(?i)(?:^|;)\s*mode:\s*([\w+.-]+)`)
+)
+
+// Modeline returns the language named by a Vim or Emacs modeline in the first or last lines of a text, or an empty
+// string if there is none
+func Modeline(txt string) string {
+	// only the lines at the ends are split off, as the text can be long
+	lines := strings.SplitN(txt, "\n", modelineLines+1)
+	if len(lines) > modelineLines {
+		rest := lines[modelineLines]
+		at := len(rest)
+		for i := 0; i < modelineLines; i++ {
+			if at = strings.LastIndexByte(rest[:at], '\n'); at < 0 {
+				break
+			}
+		}
+		lines = append(lines[:modelineLines], strings.Split(rest[at+1:], "\n")...)
+	}
+	for _, ln := range lines {
+		if m := vimModeline.FindStringSubmatch(ln); m != nil {
+			return m[1]
+		}
+		m := emacsModeline.FindStringSubmatch(ln)
+		if m == nil {
+			continue
+		}
+		if mode := emacsMode.FindStringSubmatch(m[1]); mode != nil {
+			return mode[1]
+		}
+		if vars := strings.TrimSpace(m[1]); !strings.Contains(vars, ":") {
+			return vars
+		}
+	}
+	return ""
+}
+
+// Interpreter returns the name of the program the #! line of a text runs it with, looking past env and its options
+func Interpreter(txt string) string {
+	if !strings.HasPrefix(txt, "#!") {
+		return ""
+	}
+	if i := strings.IndexByte(txt, '\n'); i >= 0 {
+		txt = txt[:i]
+	}
+	fields := strings.Fields(txt[2:])
+	if len(fields) > 0 && filepath.Base(fields[0]) == "env" {
+		fields = fields[1:]
+		for len(fields) > 0 && (strings.HasPrefix(fields[0], "-") || strings.Contains(fields[0], "=")) {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return filepath.Base(fields[0])
+}
@@ -0,0 +1,193 @@
+// Package golang lexes Go source a line at a time for highlighting. Raw strings and general comments can span lines,
+// which is what the state between lines records.
+package golang
+
+import (
+	"unicode"
+
+	"github.com/p9c/glom/pkg/highlight"
+)
+
+// the states a line can start in
+const (
+	code = iota
+	comment
+	raw
+)
+
+var keywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true, "defer": true,
+	"else": true, "fallthrough": true, "for": true, "func": true, "go": true, "goto": true, "if": true,
+	"import": true, "interface": true, "map": true, "package": true, "range": true, "return": true, "select": true,
+	"struct": true, "switch": true, "type": true, "var": true,
+}
+
+var builtins = map[string]bool{
+	"bool": true, "byte": true, "complex64": true, "complex128": true, "error": true, "float32": true,
+	"float64": true, "int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true,
+	"string": true, "uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"true": true, "false": true, "iota": true, "nil": true, "append": true, "cap": true, "close": true,
+	"complex": true, "copy": true, "delete": true, "imag": true, "len": true, "make": true, "new": true,
+	"panic": true, "print": true, "println": true, "real": true, "recover": true,
+}
+
+// Lexer is the lexer of Go
+type Lexer struct{}
+
+// New returns the lexer of Go
+func New() highlight.Lexer {
+	return Lexer{}
+}
+
+// Lex splits a line of Go into tokens
+func (Lexer) Lex(line []rune, state int) (tokens []highlight.Token, end int) {
+	i := 0
+	add := func(start int, class highlight.Class) {
+		tokens = append(tokens, highlight.Token{Start: start, End: i, Class: class})
+	}
+	switch state {
+	case comment:
+		if i, state = closing(line, 0, "*/", comment); state == comment {
+			i = len(line)
+		}
+		add(0, highlight.Comment)
+	case raw:
+		if i, state = closing(line, 0, "`", raw); state == raw {
+			i = len(line)
+		}
+		add(0, highlight.String)
+	}
+	for i < len(line) {
+		start, r := i, line[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\r':
+			i++
+		case r == '/' && at(line, i+1) == '/':
+			i = len(line)
+			add(start, highlight.Comment)
+		case r == '/' && at(line, i+1) == '*':
+			if i, state = closing(line, i+2, "*/", comment); state == comment {
+				i = len(line)
+			}
+			add(start, highlight.Comment)
+		case r == '`':
+			if i, state = closing(line, i+1, "`", raw); state == raw {
+				i = len(line)
+			}
+			add(start, highlight.String)
+		case r == '"':
+			i = quoted(line, i+1, '"')
+			add(start, highlight.String)
+		case r == '\'':
+			i = quoted(line, i+1, '\'')
+			add(start, highlight.Rune)
+		case unicode.IsDigit(r) || r == '.' && unicode.IsDigit(at(line, i+1)):
+			i = number(line, i)
+			add(start, highlight.Number)
+		case r == '_' || unicode.IsLetter(r):
+			for i < len(line) && (line[i] == '_' || unicode.IsLetter(line[i]) || unicode.IsDigit(line[i])) {
+				i++
+			}
+			class := highlight.Identifier
+			switch word := string(line[start:i]); {
+			case keywords[word]:
+				class = highlight.Keyword
+			case builtins[word]:
+				class = highlight.Builtin
+			}
+			add(start, class)
+		case operator(r):
+			// a run of operators and punctuation, up to a comment or a number
+			for i < len(line) && operator(line[i]) && !starts(line, i) {
+				i++
+			}
+			add(start, highlight.Operator)
+		default:
+			i++
+		}
+	}
+	return tokens, state
+}
+
+// at returns the rune at an index of the line, or zero past its end
+func at(line []rune, i int) rune {
+	if i < len(line) {
+		return line[i]
+	}
+	return 0
+}
+
+// closing returns the index after the delimiter that closes a comment or raw string from an index and the code state,
+// or the state it is still in if the line ends first
+func closing(line []rune, i int, delim string, open int) (int, int) {
+	d := []rune(delim)
+	for ; i+len(d) <= len(line); i++ {
+		if string(line[i:i+len(d)]) == delim {
+			return i + len(d), code
+		}
+	}
+	return len(line), open
+}
+
+// quoted returns the index after the quote that closes a string or rune from an index, skipping escaped runes. A
+// literal that is not closed ends with the line.
+func quoted(line []rune, i int, quote rune) int {
+	for ; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(line)
+}
+
+// number returns the index after a number literal, with its base prefix, digit separators, fraction, exponent and
+// imaginary suffix
+func number(line []rune, i int) int {
+	start := i
+	hex := line[i] == '0' && (at(line, i+1) == 'x' || at(line, i+1) == 'X')
+	for i < len(line) {
+		r := line[i]
+		switch {
+		case r == '_' || r == '.' || unicode.IsDigit(r) || unicode.IsLetter(r):
+			i++
+		case (r == '+' || r == '-') && i > start && exponent(line[i-1], hex):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// exponent reports whether a rune of a number starts its exponent, which a sign can follow. Hexadecimal numbers have
+// p exponents, as e is one of their digits.
+func exponent(r rune, hex bool) bool {
+	if hex {
+		return r == 'p' || r == 'P'
+	}
+	return r == 'e' || r == 'E'
+}
+
+// starts reports whether a comment or a number starting with its decimal point starts at an index of the line
+func starts(line []rune, i int) bool {
+	switch line[i] {
+	case '/':
+		return at(line, i+1) == '/' || at(line, i+1) == '*'
+	case '.':
+		return unicode.IsDigit(at(line, i+1))
+	}
+	return false
+}
+
+// operator reports whether a rune is one of the operators or punctuation of Go
+func operator(r rune) bool {
+	switch r {
+	case '+', '-', '*', '/', '%', '&', '|', '^', '<', '>', '=', '!', ':', '.', ',', ';', '(', ')', '[', ']', '{', '}',
+		'~':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package golang_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/highlight"
+	"github.com/p9c/glom/pkg/highlight/golang"
+)
+
+// spans lexes a text and lists its tokens as their class and text, one line of the text to a line
+func spans(txt string) string {
+	d := doc.New()
+	if e := d.Insert(0, txt); e != nil {
+		panic(e)
+	}
+	h := highlight.New(d, golang.New())
+	var out []string
+	var ln []string
+	prev := 0
+	for _, t := range h.Tokens(0, d.Len()) {
+		if strings.Contains(d.Slice(prev, t.Start), "\n") {
+			out, ln = append(out, strings.Join(ln, " ")), nil
+		}
+		ln = append(ln, fmt.Sprintf("%s:%s", t.Class, d.Slice(t.Start, t.End)))
+		prev = t.End
+	}
+	return strings.Join(append(out, strings.Join(ln, " ")), "\n")
+}
+
+// TestLex checks the tokens of lines with literals and comments that hold the delimiters of other literals
+func TestLex(t *testing.T) {
+	for _, c := range []struct{ src, want string }{
+		{
+			"package main // the `main` one",
+			"keyword:package identifier:main comment:// the `main` one",
+		},
+		{
+			"x := `a \"b\" /* c */ 'd'` + \"`\"",
+			"identifier:x operator::= string:`a \"b\" /* c */ 'd'` operator:+ string:\"`\"",
+		},
+		{
+			// a raw string in a string and a string in a raw string do not nest
+			"s := \"`x`\" + `\"y\"` + `\\`",
+			"identifier:s operator::= string:\"`x`\" operator:+ string:`\"y\"` operator:+ string:`\\`",
+		},
+		{
+			"r := []rune{'\\'', '\"', '`', '\\n', '\\u00e9', 'ü'}",
+			"identifier:r operator::= operator:[] builtin:rune operator:{ rune:'\\'' operator:, rune:'\"' operator:, " +
+				"rune:'`' operator:, rune:'\\n' operator:, rune:'\\u00e9' operator:, rune:'ü' operator:}",
+		},
+		{
+			"f := 0x1p-2 + 1e+9 - .5i + 0x1e-1_000",
+			"identifier:f operator::= number:0x1p-2 operator:+ number:1e+9 operator:- number:.5i operator:+ " +
+				"number:0x1e operator:- number:1_000",
+		},
+		{
+			"a/b /* c */ /d//e",
+			"identifier:a operator:/ identifier:b comment:/* c */ operator:/ identifier:d comment://e",
+		},
+		{
+			"\"unclosed \\\" string\nnext",
+			"string:\"unclosed \\\" string\nidentifier:next",
+		},
+		{
+			"x := `first\n// not a comment\n` + y /* a\n`not raw` */ z",
+			"identifier:x operator::= string:`first\nstring:// not a comment\nstring:` operator:+ identifier:y " +
+				"comment:/* a\ncomment:`not raw` */ identifier:z",
+		},
+	} {
+		if got := spans(c.src); got != c.want {
+			t.Errorf("%q lexed to\n%s\nwant\n%s", c.src, got, c.want)
+		}
+	}
+}
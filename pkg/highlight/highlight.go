@@ -0,0 +1,196 @@
+// Package highlight splits the lines of a document into tokens that are drawn in the colors of their class. The
+// tokens of each line are kept along with the state the lexer was in at its start, so that an edit only lexes the
+// lines it damaged, and the lines after them until one starts in the same state as it did before.
+package highlight
+
+import (
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// Class is the kind of a token, which decides the color it is drawn in
+type Class uint8
+
+const (
+	Plain Class = iota
+	Keyword
+	// Builtin is the predeclared identifiers of a language, such as its basic types
+	Builtin
+	Identifier
+	Number
+	String
+	Rune
+	Comment
+	Operator
+)
+
+var classNames = []string{
+	"plain", "keyword", "builtin", "identifier", "number", "string", "rune", "comment", "operator",
+}
+
+func (c Class) String() string {
+	if int(c) < len(classNames) {
+		return classNames[c]
+	}
+	return "unknown"
+}
+
+// ClassNamed returns the class with a name
+func ClassNamed(name string) (c Class, ok bool) {
+	for i, n := range classNames {
+		if n == name {
+			return Class(i), true
+		}
+	}
+	return
+}
+
+// colors is the name of the color of the gel theme each class is drawn in
+var colors = []string{"DocText", "Primary", "Info", "DocText", "Chk", "Success", "Warning", "Hint", "Secondary"}
+
+// Color returns the name of the color of the theme the class is drawn in, which follows the theme when it changes
+func (c Class) Color() string {
+	if int(c) < len(colors) {
+		return colors[c]
+	}
+	return colors[Plain]
+}
+
+// Token is a run of the text of one class. Text between tokens is plain.
+type Token struct {
+	Start, End int
+	Class      Class
+}
+
+// Lexer splits a line into tokens with offsets relative to its start. A line is lexed in the state the line before
+// it ended in, which carries literals and comments that span lines, and the first line in state zero.
+type Lexer interface {
+	Lex(line []rune, state int) (tokens []Token, end int)
+}
+
+// line is the start of a line, the state it is lexed in and its tokens
+type line struct {
+	start  int
+	state  int
+	tokens []Token
+}
+
+// Highlighter is the tokens of a document
+type Highlighter struct {
+	lexer Lexer
+	lines []line
+	// Cost is the number of lines lexed by the last update
+	Cost int
+}
+
+// New lexes a text into lines of tokens
+func New(src structure.Source, lx Lexer) (h *Highlighter) {
+	h = &Highlighter{lexer: lx, lines: []line{{}}}
+	h.Update(src, 0, 0, src.Len())
+	return
+}
+
+// Lexer returns the lexer the text is split with
+func (h *Highlighter) Lexer() Lexer {
+	return h.lexer
+}
+
+// Apply updates the tokens for an event that has been applied to the document the source reads from
+func (h *Highlighter) Apply(src structure.Source, ev doc.Event) {
+	switch ev.Kind {
+	case doc.Insert:
+		h.Update(src, ev.Offset, 0, len([]rune(ev.Text)))
+	case doc.Delete:
+		h.Update(src, ev.Offset, len([]rune(ev.Old)), 0)
+	case doc.Move:
+		// everything outside of the span from the source to the destination is unchanged
+		removed, inserted := len([]rune(ev.Old)), len([]rune(ev.Text))
+		start, end := ev.Offset, ev.Offset+removed
+		if ev.To < start {
+			start = ev.To
+		}
+		if ev.To > end {
+			end = ev.To
+		}
+		h.Update(src, start, end-start, end-start-removed+inserted)
+	}
+}
+
+// Update changes the tokens to account for the removal of removed runes at the offset and the insertion of inserted
+// runes in their place. The source must already contain the change.
+//
+// The lines from the one the change starts on are lexed again up to the first line after the change that starts in
+// the state it was lexed in before, whose tokens and those of the lines after it are kept.
+func (h *Highlighter) Update(src structure.Source, at, removed, inserted int) {
+	delta := inserted - removed
+	first := h.line(at)
+	pos, state := h.lines[first].start, h.lines[first].state
+	// the lines that started after the removed text start after the inserted text now
+	keep := first
+	for keep < len(h.lines) && h.lines[keep].start < at+removed {
+		keep++
+	}
+	old := h.lines[keep:]
+	for i := range old {
+		old[i].start += delta
+	}
+	lines := h.lines[:first:first]
+	n := src.Len()
+	h.Cost = 0
+	var rs []rune
+	for j := 0; ; {
+		rs = rs[:0]
+		end := pos
+		for ; end < n; end++ {
+			r := src.RuneAt(end)
+			if r == '\n' {
+				break
+			}
+			rs = append(rs, r)
+		}
+		tokens, next := h.lexer.Lex(rs, state)
+		lines = append(lines, line{start: pos, state: state, tokens: tokens})
+		h.Cost++
+		if end >= n {
+			break
+		}
+		pos, state = end+1, next
+		for j < len(old) && old[j].start < pos {
+			j++
+		}
+		if j < len(old) && pos >= at+inserted && old[j].start == pos && old[j].state == state {
+			lines = append(lines, old[j:]...)
+			break
+		}
+	}
+	h.lines = lines
+}
+
+// line returns the index of the line containing the offset
+func (h *Highlighter) line(at int) int {
+	lo, hi := 0, len(h.lines)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if h.lines[mid].start <= at {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// Tokens returns the tokens that overlap a range of the document, with offsets in the document
+func (h *Highlighter) Tokens(start, end int) (out []Token) {
+	for i := h.line(start); i < len(h.lines) && h.lines[i].start < end; i++ {
+		ln := h.lines[i]
+		for _, t := range ln.tokens {
+			t.Start += ln.start
+			t.End += ln.start
+			if t.End > start && t.Start < end {
+				out = append(out, t)
+			}
+		}
+	}
+	return
+}
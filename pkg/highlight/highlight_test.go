@@ -0,0 +1,96 @@
+package highlight_test
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/highlight"
+	"github.com/p9c/glom/pkg/highlight/golang"
+)
+
+const src = "package main\n\nfunc f() {\n\tx := 1\n\ty := `raw\nstring`\n\treturn\n}\n"
+
+// setup returns a document with the text repeated and its highlighter following its edits
+func setup(t *testing.T, times int) (*doc.Document, *highlight.Highlighter) {
+	d := doc.New()
+	if e := d.Insert(0, strings.Repeat(src, times)); e != nil {
+		t.Fatal(e)
+	}
+	h := highlight.New(d, golang.New())
+	d.Watch(func(ev doc.Event) { h.Apply(d, ev) })
+	return d, h
+}
+
+// same checks that the tokens after an edit are those of lexing the whole text again
+func same(t *testing.T, d *doc.Document, h *highlight.Highlighter, what string) {
+	t.Helper()
+	fresh := highlight.New(d, golang.New())
+	if got, want := h.Tokens(0, d.Len()), fresh.Tokens(0, d.Len()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after %s the tokens are\n%v\nwant\n%v", what, got, want)
+	}
+}
+
+// TestUpdate checks that an edit lexes only the lines it damaged, and those after it whose state it changed
+func TestUpdate(t *testing.T) {
+	d, h := setup(t, 100)
+	lines := strings.Count(d.Text(), "\n") + 1
+	if e := d.Insert(strings.Index(src, "1"), "2 + "); e != nil {
+		t.Fatal(e)
+	}
+	if h.Cost != 1 {
+		t.Errorf("an edit inside a line cost %d", h.Cost)
+	}
+	same(t, d, h, "an edit inside a line")
+	if e := d.Insert(strings.Index(src, "\treturn"), "z := 3\n\t"); e != nil {
+		t.Fatal(e)
+	}
+	if h.Cost != 2 {
+		t.Errorf("adding a line cost %d", h.Cost)
+	}
+	same(t, d, h, "adding a line")
+	// opening a comment changes every line after it
+	second := strings.Index(d.Text(), "}\npackage") + 2
+	if e := d.Insert(second, "/*"); e != nil {
+		t.Fatal(e)
+	}
+	if h.Cost != lines-8 {
+		t.Errorf("opening a comment cost %d", h.Cost)
+	}
+	same(t, d, h, "opening a comment")
+	if e := d.Insert(second+len("/*package main\n"), "*/"); e != nil {
+		t.Fatal(e)
+	}
+	if h.Cost != lines-9 {
+		t.Errorf("closing a comment cost %d", h.Cost)
+	}
+	same(t, d, h, "closing a comment")
+	if e := d.Move(0, len(src), d.Len()); e != nil {
+		t.Fatal(e)
+	}
+	same(t, d, h, "a move")
+}
+
+// TestRandom checks the tokens after random edits against lexing the whole text again
+func TestRandom(t *testing.T) {
+	d, h := setup(t, 4)
+	rng := rand.New(rand.NewSource(1))
+	pieces := []string{"`", "\"", "'", "/*", "*/", "//", "\n", "x", " 1.5e+3 ", "\\"}
+	for i := 0; i < 500; i++ {
+		at := rng.Intn(d.Len() + 1)
+		if rng.Intn(3) == 0 && at < d.Len() {
+			n := 1 + rng.Intn(5)
+			if at+n > d.Len() {
+				n = d.Len() - at
+			}
+			if e := d.Delete(at, n); e != nil {
+				t.Fatal(e)
+			}
+		} else if e := d.Insert(at, pieces[rng.Intn(len(pieces))]); e != nil {
+			t.Fatal(e)
+		}
+		same(t, d, h, "a random edit")
+	}
+}
@@ -0,0 +1,194 @@
+// Package importer creates the journal of a file that was written outside of glom. The history can start with the file
+// as it is, or be made from the commits of the git repository the file is in, so that the undo tree of the file goes
+// back through its real history.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/p9c/glom/pkg/diff"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// ErrExists is returned when the file already has a journal and it is not to be replaced
+var ErrExists = errors.New("file already has a journal")
+
+// Options controls how a file is imported
+type Options struct {
+	// Git makes the history from the commits that changed the file
+	Git bool
+	// Force replaces a journal the file already has
+	Force bool
+	// JournalDir is where the journal is written
+	JournalDir string
+}
+
+// Version is the text of a file at a commit
+type Version struct {
+	Hash    string
+	Author  string
+	Time    time.Time
+	Message string
+	Text    string
+}
+
+// Events returns the events that turn one text into another, made from the lines that differ between them
+func Events(from, to string) (events []doc.Event) {
+	at := 0
+	for _, c := range diff.Lines(from, to) {
+		txt := c.Text()
+		n := len([]rune(txt))
+		switch c.Op {
+		case diff.Equal:
+			at += n
+		case diff.Delete:
+			events = append(events, doc.Event{Kind: doc.Delete, Offset: at, Old: txt})
+		case diff.Insert:
+			events = append(events, doc.Event{Kind: doc.Insert, Offset: at, Text: txt})
+			at += n
+		}
+	}
+	return
+}
+
+// Commits returns the versions of a file in the commits of its repository that changed it, oldest first. A commit
+// that removed the file gives an empty text.
+func Commits(file string) (versions []Version, e error) {
+	var abs string
+	if abs, e = filepath.Abs(file); e != nil {
+		return
+	}
+	var repo *git.Repository
+	if repo, e = git.PlainOpenWithOptions(filepath.Dir(abs), &git.PlainOpenOptions{DetectDotGit: true}); e != nil {
+		return
+	}
+	var wt *git.Worktree
+	if wt, e = repo.Worktree(); e != nil {
+		return
+	}
+	var rel string
+	if rel, e = filepath.Rel(wt.Filesystem.Root(), abs); e != nil {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+	var iter object.CommitIter
+	if iter, e = repo.Log(&git.LogOptions{FileName: &rel}); e != nil {
+		return
+	}
+	defer iter.Close()
+	var commits []*object.Commit
+	for {
+		var c *object.Commit
+		if c, e = iter.Next(); e != nil {
+			if e == io.EOF {
+				e = nil
+				break
+			}
+			return
+		}
+		commits = append(commits, c)
+	}
+	sort.SliceStable(commits, func(i, j int) bool { return commits[i].Committer.When.Before(commits[j].Committer.When) })
+	for _, c := range commits {
+		v := Version{
+			Hash:    c.Hash.String(),
+			Author:  fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email),
+			Time:    c.Author.When,
+			Message: c.Message,
+		}
+		var f *object.File
+		if f, e = c.File(rel); e == nil {
+			if v.Text, e = f.Contents(); e != nil {
+				return
+			}
+		} else if e != object.ErrFileNotFound {
+			return
+		}
+		e = nil
+		versions = append(versions, v)
+	}
+	return
+}
+
+// Import writes a new journal for a file and returns its path. The history is the file as it is now, or with the git
+// option one node for each commit that changed it, bookmarked as git: and the short hash of the commit, followed by
+// the changes in the working tree if there are any.
+func Import(file string, o Options) (path string, e error) {
+	if o.JournalDir == "" {
+		o.JournalDir = journal.Dir()
+	}
+	var b []byte
+	if b, e = ioutil.ReadFile(file); e != nil {
+		return
+	}
+	var versions []Version
+	if o.Git {
+		if versions, e = Commits(file); e != nil {
+			return
+		}
+	}
+	var info os.FileInfo
+	if info, e = os.Stat(file); e != nil {
+		return
+	}
+	versions = append(versions, Version{Time: info.ModTime(), Text: string(b)})
+	path = journal.Path(o.JournalDir, file)
+	if _, se := os.Stat(path); se == nil {
+		if !o.Force {
+			return path, ErrExists
+		}
+		if e = os.Remove(path); e != nil {
+			return
+		}
+	}
+	var j *journal.Journal
+	if j, _, e = journal.Open(path); e != nil {
+		return
+	}
+	defer func() {
+		if ce := j.Close(); E.Chk(ce) && e == nil {
+			e = ce
+		}
+	}()
+	j.Sync(false)
+	abs := file
+	if a, ae := filepath.Abs(file); !E.Chk(ae) {
+		abs = a
+	}
+	if e = j.Append(journal.Record{Kind: journal.FileRecord, Name: abs}); e != nil {
+		return
+	}
+	d := doc.New()
+	h := undo.New(d)
+	journal.Attach(j, h)
+	for _, v := range versions {
+		events := Events(d.Text(), v.Text)
+		if len(events) == 0 {
+			continue
+		}
+		when := v.Time
+		d.Clock, d.Author = func() time.Time { return when }, v.Author
+		var n *undo.Node
+		if n, e = h.Commit(events...); e != nil {
+			return
+		}
+		if v.Hash != "" {
+			if e = h.Name(n.ID, "git:"+v.Hash[:7]); e != nil {
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package importer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/export"
+	"github.com/p9c/glom/pkg/importer"
+)
+
+func TestEvents(t *testing.T) {
+	from, to := "a\nb\nc\nd\n", "a\nB\nc\nd\ne\n"
+	d := doc.New()
+	if e := d.Insert(0, from); e != nil {
+		t.Fatal(e)
+	}
+	for _, ev := range importer.Events(from, to) {
+		if e := d.Apply(ev); e != nil {
+			t.Fatal(ev, e)
+		}
+	}
+	if got := d.Text(); got != to {
+		t.Errorf("events give %q, want %q", got, to)
+	}
+}
+
+func TestImport(t *testing.T) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	journals, repo := filepath.Join(dir, "journals"), filepath.Join(dir, "repo")
+	var r *git.Repository
+	if r, e = git.PlainInit(repo, false); e != nil {
+		t.Fatal(e)
+	}
+	var wt *git.Worktree
+	if wt, e = r.Worktree(); e != nil {
+		t.Fatal(e)
+	}
+	file := filepath.Join(repo, "main.go")
+	versions := []string{"package main\n", "package main\n\nfunc main() {}\n", "package main\n\nfunc main() {\n}\n"}
+	when := time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)
+	var hashes []string
+	for i, v := range versions {
+		if e = ioutil.WriteFile(file, []byte(v), 0644); e != nil {
+			t.Fatal(e)
+		}
+		if _, e = wt.Add("main.go"); e != nil {
+			t.Fatal(e)
+		}
+		sig := &object.Signature{Name: "tester", Email: "t@example.com", When: when.Add(time.Duration(i) * time.Hour)}
+		h, ce := wt.Commit("version", &git.CommitOptions{Author: sig, Committer: sig})
+		if ce != nil {
+			t.Fatal(ce)
+		}
+		hashes = append(hashes, h.String())
+	}
+	// the working tree has changes that were not committed
+	working := "package main\n\nfunc main() {\n\tprintln()\n}\n"
+	if e = ioutil.WriteFile(file, []byte(working), 0644); e != nil {
+		t.Fatal(e)
+	}
+	var path string
+	if path, e = importer.Import(file, importer.Options{Git: true, JournalDir: journals}); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = importer.Import(file, importer.Options{JournalDir: journals}); e != importer.ErrExists {
+		t.Errorf("importing again gave %v", e)
+	}
+	h, name, e := export.History(path, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if abs, _ := filepath.Abs(file); name != abs {
+		t.Errorf("journal is of %q", name)
+	}
+	if got := h.Doc().Text(); got != working {
+		t.Errorf("current text is %q", got)
+	}
+	if h.Len() != len(versions)+2 {
+		t.Errorf("history has %d nodes, want %d", h.Len(), len(versions)+2)
+	}
+	for i, hash := range hashes {
+		n, ok := h.Lookup("git:" + hash[:7])
+		if !ok {
+			t.Fatalf("commit %d is not bookmarked", i)
+		}
+		if e = h.Switch(n.ID); e != nil {
+			t.Fatal(e)
+		}
+		if got := h.Doc().Text(); got != versions[i] {
+			t.Errorf("text at commit %d is %q", i, got)
+		}
+		if ev := n.Events[0]; !ev.Time.Equal(when.Add(time.Duration(i)*time.Hour)) || ev.Author != "tester <t@example.com>" {
+			t.Errorf("commit %d was stamped %v by %q", i, ev.Time, ev.Author)
+		}
+	}
+	// without git the history starts with the file as it is
+	if _, e = importer.Import(file, importer.Options{Force: true, JournalDir: journals}); e != nil {
+		t.Fatal(e)
+	}
+	if h, _, e = export.History(path, ""); e != nil {
+		t.Fatal(e)
+	}
+	if h.Len() != 2 || h.Doc().Text() != working {
+		t.Errorf("plain import has %d nodes and text %q", h.Len(), h.Doc().Text())
+	}
+}
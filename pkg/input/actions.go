@@ -0,0 +1,549 @@
+package input
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/edit"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// action is something done to the buffer of an editor, which extends the selection rather than moving it if extend
+// is set
+type action func(ed *Editor, extend bool) error
+
+var actions = map[string]action{
+	"left":          func(ed *Editor, extend bool) error { return ed.step((*Editor).left, false, extend) },
+	"right":         func(ed *Editor, extend bool) error { return ed.step((*Editor).right, true, extend) },
+	"word-left":     func(ed *Editor, extend bool) error { return ed.move((*Editor).wordLeft, extend) },
+	"word-right":    func(ed *Editor, extend bool) error { return ed.move((*Editor).wordRight, extend) },
+	"word-end":      func(ed *Editor, extend bool) error { return ed.move((*Editor).wordEnd, extend) },
+	"segment-left":  func(ed *Editor, extend bool) error { return ed.move((*Editor).segmentLeft, extend) },
+	"segment-right": func(ed *Editor, extend bool) error { return ed.move((*Editor).segmentRight, extend) },
+	"line-start":    func(ed *Editor, extend bool) error { return ed.move((*Editor).home, extend) },
+	"line-end":      func(ed *Editor, extend bool) error { return ed.move((*Editor).lineEnd, extend) },
+	"doc-start": func(ed *Editor, extend bool) error {
+		return ed.move(func(*Editor, int) int { return 0 }, extend)
+	},
+	"doc-end": func(ed *Editor, extend bool) error {
+		return ed.move(func(ed *Editor, _ int) int { return ed.Doc.Len() }, extend)
+	},
+	"up":        func(ed *Editor, extend bool) error { return ed.lines(-1, extend) },
+	"down":      func(ed *Editor, extend bool) error { return ed.lines(1, extend) },
+	"page-up":   func(ed *Editor, extend bool) error { return ed.lines(-ed.Page, extend) },
+	"page-down": func(ed *Editor, extend bool) error { return ed.lines(ed.Page, extend) },
+	"delete-left": func(ed *Editor, _ bool) error {
+		return ed.erase((*Editor).left, false)
+	},
+	"delete-right": func(ed *Editor, _ bool) error {
+		return ed.erase((*Editor).right, true)
+	},
+	"delete-word-left": func(ed *Editor, _ bool) error {
+		return ed.erase((*Editor).wordLeft, false)
+	},
+	"delete-word-right": func(ed *Editor, _ bool) error {
+		return ed.erase((*Editor).wordRight, true)
+	},
+	"newline": func(ed *Editor, _ bool) error {
+		// the new line is indented like the one it was broken from
+		return ed.edit(
+			func(r doc.Range) (start, end int, txt string) {
+				return r.Start(), r.End(), "\n" + ed.indentation(r.Start())
+			},
+		)
+	},
+	"tab": func(ed *Editor, _ bool) error { return ed.Type("\t") },
+	"select-all": func(ed *Editor, _ bool) error {
+		ed.Selection.Set(doc.Range{Anchor: 0, Caret: ed.Doc.Len()})
+		return nil
+	},
+	"collapse": func(ed *Editor, _ bool) error {
+		if ed.Selection.Len() > 1 {
+			ed.Selection.Collapse()
+			return nil
+		}
+		ed.Selection.Set(doc.Cursor(ed.Selection.Primary().Caret))
+		return nil
+	},
+	"add-cursor-up":   func(ed *Editor, _ bool) error { return ed.addCursor(-1) },
+	"add-cursor-down": func(ed *Editor, _ bool) error { return ed.addCursor(1) },
+	"select-next":     func(ed *Editor, _ bool) error { return ed.selectNext() },
+	"undo":            func(ed *Editor, _ bool) error { return ed.History.Undo() },
+	"redo":            func(ed *Editor, _ bool) error { return ed.History.Redo() },
+	"copy":            func(ed *Editor, _ bool) error { return ed.copy() },
+	"cut": func(ed *Editor, _ bool) error {
+		if e := ed.copy(); e != nil {
+			return e
+		}
+		return ed.edit(func(r doc.Range) (start, end int, txt string) { return r.Start(), r.End(), "" })
+	},
+	"paste": func(ed *Editor, _ bool) error { return ed.paste() },
+	"paste-extended": func(ed *Editor, _ bool) error {
+		return ed.pasteAs(func(o *Offer) string { return o.Extended })
+	},
+	"paste-wrapped": func(ed *Editor, _ bool) error {
+		return ed.pasteAs(func(o *Offer) string { return o.Wrapped })
+	},
+	"paste-raw": func(ed *Editor, _ bool) error {
+		return ed.pasteAs(func(o *Offer) string { return o.Text })
+	},
+	"save": func(ed *Editor, _ bool) error { return ed.Save() },
+	"select-line": func(ed *Editor, _ bool) error {
+		ed.Selection.Map(
+			func(_ int, r doc.Range) doc.Range {
+				end := ed.lineEnd(r.End())
+				if end < ed.Doc.Len() {
+					end++
+				}
+				return doc.Range{Anchor: ed.lineStart(r.Start()), Caret: end}
+			},
+		)
+		return nil
+	},
+	"select-inner-segment": func(ed *Editor, _ bool) error { return ed.selectSegment(true) },
+	"select-segment":       func(ed *Editor, _ bool) error { return ed.selectSegment(false) },
+	"move-segment-up":      func(ed *Editor, _ bool) error { return ed.moveSegment(-1) },
+	"move-segment-down":    func(ed *Editor, _ bool) error { return ed.moveSegment(1) },
+	"expand-selection":     func(ed *Editor, _ bool) error { return ed.expand() },
+	"shrink-selection":     func(ed *Editor, _ bool) error { return ed.shrink() },
+	"next-segment":         func(ed *Editor, extend bool) error { return ed.sibling(1, extend) },
+	"prev-segment":         func(ed *Editor, extend bool) error { return ed.sibling(-1, extend) },
+	"parent-segment":       func(ed *Editor, _ bool) error { return ed.parent() },
+	"child-segment":        func(ed *Editor, _ bool) error { return ed.child() },
+	"slurp-forward":        func(ed *Editor, _ bool) error { return ed.slurp(true) },
+	"slurp-backward":       func(ed *Editor, _ bool) error { return ed.slurp(false) },
+	"barf-forward":         func(ed *Editor, _ bool) error { return ed.barf(true) },
+	"barf-backward":        func(ed *Editor, _ bool) error { return ed.barf(false) },
+	"splice":               func(ed *Editor, _ bool) error { return ed.splice() },
+	"raise":                func(ed *Editor, _ bool) error { return ed.raise() },
+	"wrap":                 func(ed *Editor, _ bool) error { return ed.wrap() },
+	"split":                func(ed *Editor, _ bool) error { return ed.split() },
+	"toggle-paredit": func(ed *Editor, _ bool) error {
+		ed.Paredit = !ed.Paredit
+		return nil
+	},
+}
+
+// motion returns where a motion takes a caret at the offset
+type motion func(ed *Editor, at int) int
+
+// move moves the carets, and with them their anchors unless the selection is extended
+func (ed *Editor) move(m motion, extend bool) error {
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			if r.Caret = m(ed, r.Caret); !extend {
+				r.Anchor = r.Caret
+			}
+			return r
+		},
+	)
+	return nil
+}
+
+// step is move for motions by a character, which only collapse a selection to its end in their direction when it
+// is not extended
+func (ed *Editor) step(m motion, forward, extend bool) error {
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			switch {
+			case extend:
+				r.Caret = m(ed, r.Caret)
+				return r
+			case r.Empty():
+				return doc.Cursor(m(ed, r.Caret))
+			case forward:
+				return doc.Cursor(r.End())
+			}
+			return doc.Cursor(r.Start())
+		},
+	)
+	return nil
+}
+
+// lines moves the carets n lines down, or up for a negative n, keeping the columns they were in when they started
+// moving between lines
+func (ed *Editor) lines(n int, extend bool) error {
+	ranges := ed.Selection.Ranges()
+	if len(ed.goals) != len(ranges) {
+		ed.goals = ed.goals[:0]
+		for _, r := range ranges {
+			ed.goals = append(ed.goals, ed.column(r.Caret))
+		}
+	}
+	goals := ed.goals
+	ed.Selection.Map(
+		func(i int, r doc.Range) doc.Range {
+			if r.Caret = ed.lineDown(r.Caret, n, goals[i]); !extend {
+				r.Anchor = r.Caret
+			}
+			return r
+		},
+	)
+	// cursors that ran into each other at the start or end of the document are one cursor now
+	if ed.Selection.Len() == len(goals) {
+		ed.vertical = true
+	}
+	return nil
+}
+
+// erase deletes the selected text at every range, or the text from the cursor to where a motion takes it
+func (ed *Editor) erase(m motion, forward bool) error {
+	if ed.Paredit && ed.balanced(nil) {
+		return ed.eraseBalanced(m, forward)
+	}
+	return ed.edit(
+		func(r doc.Range) (start, end int, txt string) {
+			switch {
+			case !r.Empty():
+				return r.Start(), r.End(), ""
+			case forward:
+				return r.Caret, m(ed, r.Caret), ""
+			}
+			return m(ed, r.Caret), r.Caret, ""
+		},
+	)
+}
+
+// addCursor adds a cursor on the line above the first range, or below the last one for a positive direction, in the
+// column of its caret
+func (ed *Editor) addCursor(dir int) error {
+	ranges := ed.Selection.Ranges()
+	r := ranges[0]
+	if dir > 0 {
+		r = ranges[len(ranges)-1]
+	}
+	at := ed.lineDown(r.Caret, dir, ed.column(r.Caret))
+	if ed.lineStart(at) != ed.lineStart(r.Caret) {
+		ed.Selection.Add(doc.Cursor(at))
+	}
+	return nil
+}
+
+// selectNext selects the word at an empty primary range, or adds the next occurrence of the text of the primary range
+// after it to the selection, starting again from the top at the end of the document
+func (ed *Editor) selectNext() error {
+	p := ed.Selection.Primary()
+	if p.Empty() {
+		start, end := p.Caret, p.Caret
+		for start > 0 && wordRune(ed.Doc.RuneAt(start-1)) {
+			start--
+		}
+		for end < ed.Doc.Len() && wordRune(ed.Doc.RuneAt(end)) {
+			end++
+		}
+		if start < end {
+			i := ed.Selection.PrimaryIndex()
+			ed.Selection.Map(
+				func(j int, r doc.Range) doc.Range {
+					if j == i {
+						return doc.Range{Anchor: start, Caret: end}
+					}
+					return r
+				},
+			)
+		}
+		return nil
+	}
+	txt, want := []rune(ed.Doc.Text()), []rune(ed.Doc.Slice(p.Start(), p.End()))
+	match := func(at int) bool {
+		for i, r := range want {
+			if txt[at+i] != r {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 1; i <= len(txt); i++ {
+		at := (p.Start() + i) % len(txt)
+		if at+len(want) <= len(txt) && match(at) {
+			ed.Selection.Add(doc.Range{Anchor: at, Caret: at + len(want)})
+			return nil
+		}
+	}
+	return nil
+}
+
+// copy puts the selected text into the register, with a line for each range when there are several
+func (ed *Editor) copy() error {
+	var parts []string
+	var last doc.Range
+	for _, r := range ed.Selection.Ranges() {
+		if !r.Empty() {
+			parts, last = append(parts, ed.Doc.Slice(r.Start(), r.End())), r
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	ed.Register = strings.Join(parts, "\n")
+	// the fragment around unbalanced text is found now, as cutting it or editing the document loses it
+	ed.copied, ed.extended = ed.Register, ""
+	if len(parts) == 1 && !structure.Balanced(structure.Runes([]rune(ed.Register)), ed.Structure.Syntax()) {
+		ed.extended = ed.extend(last.Start(), last.End())
+	}
+	return nil
+}
+
+// selectSegment selects the innermost segment around each range, or only the inside of it within its delimiters.
+// Selecting again selects the segment around that.
+func (ed *Editor) selectSegment(inner bool) error {
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			for seg := ed.Structure.EnclosingRange(r.Start(), r.End()); seg != nil; seg = seg.Parent {
+				start, end := seg.Start(), seg.End()
+				if inner {
+					start, end = seg.Inner()
+				}
+				// a cursor on a delimiter is on the segment the delimiter belongs to
+				onDelimiter := inner && r.Empty() && seg.Parent != nil
+				if start <= r.Start() && end >= r.End() && end-start > r.Len() || onDelimiter && start < end {
+					return doc.Range{Anchor: start, Caret: end}
+				}
+			}
+			return r
+		},
+	)
+	return nil
+}
+
+// moveSegment moves the innermost segment at the primary caret that can be moved past the sibling before it, or the
+// one after it for a positive direction. The cursor keeps its place in the moved segment.
+func (ed *Editor) moveSegment(dir int) (e error) {
+	path := ed.Structure.Path(ed.Selection.Primary().Caret)
+	var seg *structure.Segment
+	var drop edit.Drop
+	for i := len(path) - 1; i > 0; i-- {
+		if drop, e = edit.Step(ed.Doc, path[i], dir); e == nil {
+			seg = path[i]
+			break
+		}
+	}
+	if seg == nil {
+		// nothing around the cursor can be moved that way
+		return nil
+	}
+	var ev doc.Event
+	if ev, e = edit.MoveEvent(ed.Doc, seg, drop); e != nil {
+		return
+	}
+	if ed.Paredit && ed.balanced(nil) && !ed.balanced(moved(ev)) {
+		return nil
+	}
+	rel := ed.Selection.Primary().Caret - seg.Start()
+	start, n := doc.Follow(ev, seg.Start(), seg.End()-seg.Start())
+	if _, e = ed.History.Commit(ev); e != nil {
+		return
+	}
+	if rel > n {
+		rel = n
+	}
+	ed.Selection.Set(doc.Cursor(start + rel))
+	return
+}
+
+func (ed *Editor) left(at int) int {
+	if at > 0 {
+		return at - 1
+	}
+	return at
+}
+
+func (ed *Editor) right(at int) int {
+	if at < ed.Doc.Len() {
+		return at + 1
+	}
+	return at
+}
+
+// class sorts runes into white space, the runes of words and everything else, which word motions stop between
+func class(r rune) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case wordRune(r):
+		return 1
+	}
+	return 2
+}
+
+func wordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// wordLeft returns the start of the word or run of punctuation before the offset
+func (ed *Editor) wordLeft(at int) int {
+	for at > 0 && class(ed.Doc.RuneAt(at-1)) == 0 {
+		at--
+	}
+	if at == 0 {
+		return at
+	}
+	c := class(ed.Doc.RuneAt(at - 1))
+	for at > 0 && class(ed.Doc.RuneAt(at-1)) == c {
+		at--
+	}
+	return at
+}
+
+// wordRight returns the end of the word or run of punctuation after the offset
+func (ed *Editor) wordRight(at int) int {
+	n := ed.Doc.Len()
+	for at < n && class(ed.Doc.RuneAt(at)) == 0 {
+		at++
+	}
+	if at == n {
+		return at
+	}
+	c := class(ed.Doc.RuneAt(at))
+	for at < n && class(ed.Doc.RuneAt(at)) == c {
+		at++
+	}
+	return at
+}
+
+// wordEnd returns the offset of the last rune of the word or run of punctuation after the one at the offset, where a
+// block caret covers it
+func (ed *Editor) wordEnd(at int) int {
+	if at+1 >= ed.Doc.Len() {
+		return at
+	}
+	return ed.wordRight(at+1) - 1
+}
+
+// segmentRight returns the end of the outermost segment starting at the offset, so that brackets, strings and
+// comments are stepped over whole. Inside a segment it is the end of the next segment in it, or the end of its inside
+// and then of the segment itself when there is none.
+func (ed *Editor) segmentRight(at int) int {
+	path := ed.Structure.Path(at)
+	for _, s := range path[1:] {
+		if s.Start() == at {
+			return s.End()
+		}
+	}
+	c := path[len(path)-1]
+	for _, ch := range c.Children {
+		if ch.Start() >= at {
+			return ch.End()
+		}
+	}
+	if _, end := c.Inner(); at < end {
+		return end
+	}
+	if c.Parent == nil {
+		return at
+	}
+	return c.End()
+}
+
+// segmentLeft returns the start of the outermost segment ending at the offset, the mirror of segmentRight
+func (ed *Editor) segmentLeft(at int) int {
+	if at == 0 {
+		return at
+	}
+	path := ed.Structure.Path(at - 1)
+	for _, s := range path[1:] {
+		if s.End() == at {
+			return s.Start()
+		}
+	}
+	path = ed.Structure.Path(at)
+	c := path[len(path)-1]
+	for i := len(c.Children) - 1; i >= 0; i-- {
+		if ch := c.Children[i]; ch.End() <= at {
+			return ch.Start()
+		}
+	}
+	if start, _ := c.Inner(); at > start {
+		return start
+	}
+	return c.Start()
+}
+
+// lineStart returns the offset of the start of the line containing the offset
+func (ed *Editor) lineStart(at int) int {
+	for at > 0 && ed.Doc.RuneAt(at-1) != '\n' {
+		at--
+	}
+	return at
+}
+
+// lineEnd returns the offset of the newline ending the line containing the offset, or the end of the document
+func (ed *Editor) lineEnd(at int) int {
+	for n := ed.Doc.Len(); at < n && ed.Doc.RuneAt(at) != '\n'; at++ {
+	}
+	return at
+}
+
+// home returns the first rune on the line of the offset that is not white space, or the start of the line if the
+// offset is already there
+func (ed *Editor) home(at int) int {
+	start := ed.lineStart(at)
+	first := start + len([]rune(ed.indentation(ed.lineEnd(at))))
+	if at == first {
+		return start
+	}
+	return first
+}
+
+// indentation returns the white space at the start of the line containing the offset, as far as the offset
+func (ed *Editor) indentation(at int) string {
+	var out []rune
+	for i := ed.lineStart(at); i < at; i++ {
+		r := ed.Doc.RuneAt(i)
+		if r != ' ' && r != '\t' {
+			break
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// advance returns the column after a rune in a column
+func (ed *Editor) advance(col int, r rune) int {
+	if r == '\t' && ed.TabWidth > 0 {
+		return (col/ed.TabWidth + 1) * ed.TabWidth
+	}
+	return col + 1
+}
+
+// column returns the column of the offset on its line, with tabs expanded to their tab stop
+func (ed *Editor) column(at int) (col int) {
+	for i := ed.lineStart(at); i < at; i++ {
+		col = ed.advance(col, ed.Doc.RuneAt(i))
+	}
+	return
+}
+
+// lineDown returns the offset in a column n lines below the one with the offset, or above for a negative n. Lines
+// too short for the column give their end, and going past the first or last line gives the start or end of the
+// document.
+func (ed *Editor) lineDown(at, n, col int) int {
+	start, size := ed.lineStart(at), ed.Doc.Len()
+	for ; n > 0; n-- {
+		end := ed.lineEnd(start)
+		if end == size {
+			return size
+		}
+		start = end + 1
+	}
+	for ; n < 0; n++ {
+		if start == 0 {
+			return 0
+		}
+		start = ed.lineStart(start - 1)
+	}
+	c := 0
+	for at = start; at < size; at++ {
+		r := ed.Doc.RuneAt(at)
+		if r == '\n' {
+			break
+		}
+		next := ed.advance(c, r)
+		if next > col {
+			break
+		}
+		c = next
+	}
+	return at
+}
@@ -0,0 +1,149 @@
+// Package input turns the text typed in the editor into edits of a buffer, and runs the actions keys are bound to,
+// which edit it and move the cursors in it. Every action has a name, so that keys can be bound to it by a keymap.
+package input
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/workspace"
+)
+
+// ErrAction is returned for the names of actions that do not exist
+var ErrAction = errors.New("no such action")
+
+// Editor applies the input of the editor to a buffer
+type Editor struct {
+	*workspace.Buffer
+	// Page is the number of lines paging up and down moves the cursors
+	Page int
+	// TabWidth is the number of columns between tab stops, which the cursors keep their column by when they move
+	// between lines
+	TabWidth int
+	// Register is the text that was last copied or cut, and is pasted
+	Register string
+	// Paredit keeps the brackets, literals and block comments of a balanced document balanced. Edits that would
+	// unbalance it are done in a way that does not, or not at all.
+	Paredit bool
+	// Offer is the ways the register can be pasted when the last paste found it unbalanced, until the next action
+	Offer *Offer
+	// copied is the text last copied and extended the balanced fragment of the document around it if it is not
+	// balanced itself
+	copied, extended string
+	// goals are the columns the cursors were in before they started moving up and down, and vertical is set while
+	// they still are
+	goals    []int
+	vertical bool
+	// expansions are the selections expanded from, which shrinking returns to
+	expansions []expansion
+}
+
+// NewEditor creates an editor of a buffer
+func NewEditor(b *workspace.Buffer) (ed *Editor) {
+	ed = &Editor{Page: 20, TabWidth: 4}
+	ed.Use(b)
+	return
+}
+
+// Use switches the editor to another buffer
+func (ed *Editor) Use(b *workspace.Buffer) {
+	ed.Buffer = b
+	ed.goals, ed.expansions = nil, nil
+}
+
+// Actions returns the names of the actions keys can be bound to
+func Actions() (names []string) {
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Has reports whether there is an action with the name
+func Has(name string) bool {
+	_, ok := actions[name]
+	return ok
+}
+
+// Do runs the action with the name, extending the selection rather than moving it if extend is set
+func (ed *Editor) Do(name string, extend bool) (e error) {
+	a, ok := actions[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrAction, name)
+	}
+	ed.vertical, ed.Offer = false, nil
+	e = a(ed, extend)
+	if !ed.vertical {
+		ed.goals = nil
+	}
+	return
+}
+
+// Type replaces the selected text at every cursor with text that was typed or composed by an input method
+func (ed *Editor) Type(txt string) (e error) {
+	ed.goals, ed.Offer = nil, nil
+	if txt == "" {
+		return
+	}
+	if ed.Paredit && ed.balanced(nil) {
+		return ed.typeBalanced(txt)
+	}
+	return ed.edit(func(r doc.Range) (start, end int, s string) { return r.Start(), r.End(), txt })
+}
+
+// change replaces the text from start to end
+type change struct {
+	start, end int
+	txt        string
+}
+
+// edit replaces a stretch of the text at each range of the selection as one edit, which is undone as a whole. fn gives
+// the stretch and its replacement for a range. The stretches are clipped so that they do not overlap. In paredit mode
+// nothing is replaced if it would unbalance the document.
+func (ed *Editor) edit(fn func(r doc.Range) (start, end int, txt string)) (e error) {
+	var changes []change
+	for _, r := range ed.Selection.Ranges() {
+		var c change
+		c.start, c.end, c.txt = fn(r)
+		if n := len(changes); n > 0 && c.start < changes[n-1].end {
+			c.start = changes[n-1].end
+		}
+		if c.end < c.start {
+			c.end = c.start
+		}
+		if c.end > c.start || c.txt != "" {
+			changes = append(changes, c)
+		}
+	}
+	if ed.Paredit && ed.balanced(nil) && !ed.balanced(changes) {
+		return
+	}
+	return ed.commit(changes)
+}
+
+// commit makes changes that do not overlap, in order, as one edit. They are replaced from the last to the first, so
+// that the offsets of the ones before them stay valid.
+func (ed *Editor) commit(changes []change) (e error) {
+	_, e = ed.History.Edit(
+		func(d *doc.Document) (e error) {
+			for i := len(changes) - 1; i >= 0; i-- {
+				c := changes[i]
+				if c.end > c.start {
+					if e = d.Delete(c.start, c.end-c.start); e != nil {
+						return
+					}
+				}
+				if c.txt != "" {
+					if e = d.Insert(c.start, c.txt); e != nil {
+						return
+					}
+				}
+			}
+			return
+		},
+	)
+	return
+}
@@ -0,0 +1,224 @@
+package input_test
+
+import (
+	"errors"
+	"testing"
+
+	"gioui.org/io/key"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/input"
+	"github.com/p9c/glom/pkg/keymap"
+	"github.com/p9c/glom/pkg/settings"
+	"github.com/p9c/glom/pkg/workspace"
+)
+
+// editor is an editor of an empty buffer with the default keymap
+type editor struct {
+	*input.Editor
+	keys *keymap.Keymap
+}
+
+func newEditor(t *testing.T) *editor {
+	keys, e := keymap.New(settings.Default())
+	if e != nil {
+		t.Fatal(e)
+	}
+	return &editor{Editor: input.NewEditor(workspace.NewBuffer()), keys: keys}
+}
+
+// press sends a key press to the editor
+func press(t *testing.T, ed *editor, name string, mods key.Modifiers) {
+	t.Helper()
+	ok, e := ed.keys.Event(ed, key.Event{Name: name, Modifiers: mods, State: key.Press})
+	if e != nil {
+		t.Fatal(name, e)
+	}
+	if !ok {
+		t.Fatalf("%s %v is not bound", name, mods)
+	}
+}
+
+// typed sends text to the editor as an input method would
+func typed(t *testing.T, ed *editor, txt string) {
+	t.Helper()
+	if _, e := ed.keys.Event(ed, key.EditEvent{Text: txt}); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func carets(ed *editor) (out []int) {
+	for _, r := range ed.Selection.Ranges() {
+		out = append(out, r.Caret)
+	}
+	return
+}
+
+func checkText(t *testing.T, ed *editor, txt string) {
+	t.Helper()
+	if got := ed.Doc.Text(); got != txt {
+		t.Fatalf("text is %q, want %q", got, txt)
+	}
+}
+
+func check(t *testing.T, ed *editor, txt string, want ...int) {
+	t.Helper()
+	checkText(t, ed, txt)
+	got := carets(ed)
+	if len(got) != len(want) {
+		t.Fatalf("carets are at %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("carets are at %v, want %v", got, want)
+		}
+	}
+}
+
+// TestTyping checks that text typed and deleted at the cursor is recorded as edits that can be undone
+func TestTyping(t *testing.T) {
+	ed := newEditor(t)
+	typed(t, ed, "hello")
+	check(t, ed, "hello", 5)
+	press(t, ed, key.NameLeftArrow, 0)
+	press(t, ed, key.NameLeftArrow, 0)
+	typed(t, ed, "X")
+	check(t, ed, "helXlo", 4)
+	press(t, ed, key.NameLeftArrow, key.ModShift)
+	press(t, ed, key.NameLeftArrow, key.ModShift)
+	if r := ed.Selection.Primary(); r.Anchor != 4 || r.Caret != 2 {
+		t.Fatalf("selection is %+v", r)
+	}
+	typed(t, ed, "ü")
+	check(t, ed, "heülo", 3)
+	press(t, ed, key.NameDeleteBackward, 0)
+	press(t, ed, key.NameDeleteForward, 0)
+	check(t, ed, "heo", 2)
+	if e := ed.Do("undo", false); e != nil {
+		t.Fatal(e)
+	}
+	checkText(t, ed, "helo")
+	if e := ed.Do("undo", false); e != nil {
+		t.Fatal(e)
+	}
+	checkText(t, ed, "heülo")
+	if ok, _ := ed.keys.Key(ed, key.Event{Name: "Q", State: key.Press}); ok {
+		t.Error("a letter without a modifier ran an action")
+	}
+	if e := ed.Do("fly", false); !errors.Is(e, input.ErrAction) {
+		t.Errorf("unknown action gave %v", e)
+	}
+}
+
+// TestNavigation checks the motions by words, lines and segments
+func TestNavigation(t *testing.T) {
+	ed := newEditor(t)
+	typed(t, ed, "\tfoo(bar, [1, 2]) + x\nab\n\tlast line here")
+	press(t, ed, key.NameHome, key.ModShortcut)
+	check(t, ed, ed.Doc.Text(), 0)
+	press(t, ed, key.NameHome, 0)
+	check(t, ed, ed.Doc.Text(), 1)
+	press(t, ed, key.NameHome, 0)
+	check(t, ed, ed.Doc.Text(), 0)
+	steps := []struct {
+		name string
+		mods key.Modifiers
+		want int
+	}{
+		{key.NameRightArrow, key.ModShortcut, 4},
+		{key.NameRightArrow, key.ModShortcut, 5},
+		{key.NameLeftArrow, key.ModAlt, 4},
+		{key.NameRightArrow, key.ModAlt, 17},
+		{key.NameLeftArrow, key.ModAlt, 4},
+		{key.NameRightArrow, key.ModShortcut, 5},
+		{key.NameRightArrow, key.ModShortcut, 8},
+		{key.NameRightArrow, key.ModShortcut, 9},
+		{key.NameRightArrow, key.ModShortcut, 11},
+		{key.NameRightArrow, key.ModAlt, 15},
+		{key.NameRightArrow, key.ModAlt, 16},
+		{key.NameRightArrow, key.ModAlt, 17},
+		{key.NameLeftArrow, key.ModAlt, 4},
+		{key.NameEnd, 0, 21},
+		{key.NameDownArrow, 0, 24},
+		{key.NameDownArrow, 0, 40},
+		{key.NameUpArrow, 0, 24},
+		{key.NameUpArrow, 0, 21},
+		{key.NameLeftArrow, key.ModShortcut, 20},
+		{key.NameHome, key.ModShortcut, 0},
+		{key.NameEnd, key.ModShortcut, 40},
+	}
+	for i, s := range steps {
+		press(t, ed, s.name, s.mods)
+		if got := ed.Selection.Primary().Caret; got != s.want {
+			t.Fatalf("step %d: caret at %d, want %d", i, got, s.want)
+		}
+	}
+}
+
+// TestWordEnd checks that the motion to the end of a word lands on its last rune, where the block caret of the modes
+// that do not take text covers it, and goes on to the next word from there
+func TestWordEnd(t *testing.T) {
+	ed := newEditor(t)
+	typed(t, ed, "foo  bar(x)")
+	ed.Selection.Set(doc.Cursor(0))
+	for i, want := range []int{2, 7, 8, 9, 10, 10} {
+		if e := ed.Do("word-end", false); e != nil {
+			t.Fatal(e)
+		}
+		if got := ed.Selection.Primary().Caret; got != want {
+			t.Fatalf("step %d: caret at %d, want %d", i, got, want)
+		}
+	}
+}
+
+// TestCursors checks that every cursor of a multiple selection is edited at once
+func TestCursors(t *testing.T) {
+	ed := newEditor(t)
+	typed(t, ed, "one\ntwo\nthree")
+	press(t, ed, key.NameHome, key.ModShortcut)
+	press(t, ed, key.NameDownArrow, key.ModAlt|key.ModShift)
+	press(t, ed, key.NameDownArrow, key.ModAlt|key.ModShift)
+	check(t, ed, "one\ntwo\nthree", 0, 4, 8)
+	typed(t, ed, "- ")
+	check(t, ed, "- one\n- two\n- three", 2, 8, 14)
+	press(t, ed, key.NameEnd, 0)
+	press(t, ed, key.NameDeleteBackward, key.ModShortcut)
+	check(t, ed, "- \n- \n- ", 2, 5, 8)
+	press(t, ed, key.NameDeleteBackward, key.ModShortcut)
+	check(t, ed, "\n\n", 0, 1, 2)
+	if e := ed.Do("undo", false); e != nil {
+		t.Fatal(e)
+	}
+	checkText(t, ed, "- \n- \n- ")
+	press(t, ed, key.NameEscape, 0)
+	if ed.Selection.Len() != 1 {
+		t.Fatalf("escape left %d ranges", ed.Selection.Len())
+	}
+	ed.Selection.Set(doc.Cursor(0))
+	press(t, ed, key.NameEnd, key.ModShortcut)
+	typed(t, ed, "\nab cd ab ab")
+	ed.Selection.Set(doc.Cursor(10))
+	press(t, ed, "D", key.ModShortcut)
+	press(t, ed, "D", key.ModShortcut)
+	press(t, ed, "D", key.ModShortcut)
+	typed(t, ed, "x")
+	check(t, ed, "- \n- \n- \nx cd x x", 10, 15, 17)
+}
+
+// TestNewline checks that a new line keeps the indentation of the line it was broken from
+func TestNewline(t *testing.T) {
+	ed := newEditor(t)
+	typed(t, ed, "\tif x {")
+	press(t, ed, key.NameReturn, 0)
+	press(t, ed, key.NameTab, 0)
+	typed(t, ed, "y")
+	check(t, ed, "\tif x {\n\t\ty", 11)
+	press(t, ed, key.NameHome, 0)
+	press(t, ed, key.NameRightArrow, key.ModShift)
+	press(t, ed, key.NameRightArrow, 0)
+	check(t, ed, "\tif x {\n\t\ty", 11)
+	press(t, ed, key.NameUpArrow, key.ModShift)
+	if r := ed.Selection.Primary(); r.Anchor != 11 || r.Caret != 6 {
+		t.Fatalf("selection is %+v", r)
+	}
+}
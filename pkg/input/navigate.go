@@ -0,0 +1,199 @@
+package input
+
+import (
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// expansion is the selection before it was expanded and the selection it was expanded to, which shrinking returns
+// from
+type expansion struct {
+	from, to []doc.Range
+	primary  int
+}
+
+// expand selects the smallest segment around each range that is larger than it, the inside of the segment within its
+// delimiters before the whole of it
+func (ed *Editor) expand() error {
+	from, primary := ed.Selection.Ranges(), ed.Selection.PrimaryIndex()
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			for seg := ed.Structure.EnclosingRange(r.Start(), r.End()); seg != nil; seg = seg.Parent {
+				inStart, inEnd := seg.Inner()
+				for _, span := range [][2]int{{inStart, inEnd}, {seg.Start(), seg.End()}} {
+					if start, end := span[0], span[1]; start <= r.Start() && end >= r.End() && end-start > r.Len() {
+						return doc.Range{Anchor: start, Caret: end}
+					}
+				}
+			}
+			return r
+		},
+	)
+	if to := ed.Selection.Ranges(); !sameRanges(from, to) {
+		ed.expansions = append(ed.expansions, expansion{from: from, to: to, primary: primary})
+	}
+	return nil
+}
+
+// shrink returns the selection to what it was before it was last expanded. A selection that was not expanded to
+// shrinks to the outermost segment inside each range that holds its caret, or to the caret if there is none.
+func (ed *Editor) shrink() error {
+	if n := len(ed.expansions); n > 0 {
+		last := ed.expansions[n-1]
+		ed.expansions = ed.expansions[:n-1]
+		if sameRanges(last.to, ed.Selection.Ranges()) {
+			ed.reselect(last.from, last.primary)
+			return nil
+		}
+		// the selection was changed since, so what it was expanded from no longer applies
+		ed.expansions = nil
+	}
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			if r.Empty() {
+				return r
+			}
+			at := r.Caret
+			if at == r.End() {
+				at--
+			}
+			for _, seg := range ed.Structure.Path(at)[1:] {
+				if seg.Start() >= r.Start() && seg.End() <= r.End() && seg.Len < r.Len() {
+					return doc.Range{Anchor: seg.Start(), Caret: seg.End()}
+				}
+			}
+			return doc.Cursor(r.Caret)
+		},
+	)
+	return nil
+}
+
+// sameRanges reports whether two selections have the same ranges
+func sameRanges(a, b []doc.Range) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// reselect sets the ranges of the selection, keeping the range at primary the primary one
+func (ed *Editor) reselect(ranges []doc.Range, primary int) {
+	if primary < 0 || primary >= len(ranges) {
+		ed.Selection.Set(ranges...)
+		return
+	}
+	// the last range is the primary one
+	ed.Selection.Set(append(append(ranges[:primary:primary], ranges[primary+1:]...), ranges[primary])...)
+}
+
+// selected returns the segment a range selects, either whole or within its delimiters, or nil
+func (ed *Editor) selected(r doc.Range) *structure.Segment {
+	if r.Empty() {
+		return nil
+	}
+	for seg := ed.Structure.EnclosingRange(r.Start(), r.End()); seg != nil; seg = seg.Parent {
+		start, end := seg.Inner()
+		if seg.Start() == r.Start() && seg.End() == r.End() || start == r.Start() && end == r.End() {
+			return seg
+		}
+	}
+	return nil
+}
+
+// spans reports whether two segments cover the same text, as a segment of a language parser and the bracket it is
+// made of can
+func spans(a, b *structure.Segment) bool {
+	return a.Start() == b.Start() && a.End() == b.End()
+}
+
+// whole returns the range selecting a segment, extending a range to it instead if extend is set
+func whole(r doc.Range, seg *structure.Segment, extend bool) doc.Range {
+	if !extend {
+		return doc.Range{Anchor: seg.Start(), Caret: seg.End()}
+	}
+	if seg.Start() < r.Start() {
+		return doc.Range{Anchor: r.End(), Caret: seg.Start()}
+	}
+	return doc.Range{Anchor: r.Start(), Caret: seg.End()}
+}
+
+// sibling selects the segment after the one each range selects, or before it for a negative direction. A caret goes
+// to the next segment in the innermost segment around it, or to the one after that segment when there is none.
+func (ed *Editor) sibling(dir int, extend bool) error {
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			seg := ed.selected(r)
+			if seg == nil {
+				seg = ed.Structure.Enclosing(r.Caret)
+				var to *structure.Segment
+				for _, ch := range seg.Children {
+					if dir > 0 && ch.Start() >= r.Caret && to == nil {
+						to = ch
+					}
+					if dir < 0 && ch.End() <= r.Caret {
+						to = ch
+					}
+				}
+				if to != nil {
+					return whole(r, to, extend)
+				}
+			}
+			to := seg.Next()
+			if dir < 0 {
+				to = seg.Prev()
+			}
+			if to == nil {
+				return r
+			}
+			return whole(r, to, extend)
+		},
+	)
+	return nil
+}
+
+// parent selects the segment around the one each range selects, or the innermost segment around a range that selects
+// none
+func (ed *Editor) parent() error {
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			var to *structure.Segment
+			if seg := ed.selected(r); seg != nil {
+				for to = seg.Parent; to != nil && spans(to, seg); to = to.Parent {
+				}
+			} else {
+				to = ed.Structure.EnclosingRange(r.Start(), r.End())
+			}
+			if to == nil || to.Parent == nil {
+				return r
+			}
+			return whole(r, to, false)
+		},
+	)
+	return nil
+}
+
+// child selects the first segment in the one each range selects, or in the innermost segment around a caret
+func (ed *Editor) child() error {
+	ed.Selection.Map(
+		func(_ int, r doc.Range) doc.Range {
+			seg := ed.selected(r)
+			if seg == nil {
+				seg = ed.Structure.Enclosing(r.Caret)
+			}
+			to := seg
+			for len(to.Children) > 0 && (to == seg || spans(to, seg)) {
+				to = to.Children[0]
+			}
+			if to == seg {
+				return r
+			}
+			return whole(r, to, false)
+		},
+	)
+	return nil
+}
@@ -0,0 +1,117 @@
+package input_test
+
+import (
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/grammar"
+)
+
+const tree = `f(a, [b, c], "s") + g(x)`
+
+// plain returns an editor of the text segmented by its brackets and literals alone, with the caret at the offset
+func plain(t *testing.T, at int) *editor {
+	ed := newEditor(t)
+	ed.Buffer.Use(grammar.Plain)
+	typed(t, ed, tree)
+	ed.Selection.Set(doc.Cursor(at))
+	return ed
+}
+
+// step is an action and the primary range after it
+type step struct {
+	action        string
+	anchor, caret int
+}
+
+// steps runs actions one after another, checking the primary range after each
+func steps(t *testing.T, ed *editor, want ...step) {
+	t.Helper()
+	for i, s := range want {
+		if e := ed.Do(s.action, false); e != nil {
+			t.Fatal(e)
+		}
+		if r := ed.Selection.Primary(); r.Anchor != s.anchor || r.Caret != s.caret {
+			t.Fatalf("step %d: %s selected %q %+v", i, s.action, ed.Doc.Slice(r.Start(), r.End()), r)
+		}
+	}
+}
+
+// TestExpand checks that expanding selects the inside and then the whole of each segment around the caret, and that
+// shrinking goes back the same way
+func TestExpand(t *testing.T) {
+	ed := plain(t, 6)
+	steps(
+		t, ed,
+		step{"expand-selection", 6, 10},
+		step{"expand-selection", 5, 11},
+		step{"expand-selection", 2, 16},
+		step{"expand-selection", 1, 17},
+		step{"expand-selection", 0, 24},
+		step{"expand-selection", 0, 24},
+		step{"shrink-selection", 1, 17},
+		step{"shrink-selection", 2, 16},
+		step{"shrink-selection", 5, 11},
+		step{"shrink-selection", 6, 10},
+		step{"shrink-selection", 6, 6},
+		step{"shrink-selection", 6, 6},
+		// a selection that was not expanded to shrinks to the segment at its caret
+		step{"select-all", 0, 24},
+		step{"shrink-selection", 21, 24},
+	)
+	// in Go the segments of the parser come between the brackets
+	ed = newEditor(t)
+	typed(t, ed, "package main\n\nfunc f(x int) {\n\tif x > 0 {\n\t\tg(x, \"y\")\n\t}\n}\n")
+	at := 40
+	ed.Selection.Set(doc.Cursor(at))
+	n := 0
+	for r := ed.Selection.Primary(); r.Len() < ed.Doc.Len(); n++ {
+		if e := ed.Do("expand-selection", false); e != nil {
+			t.Fatal(e)
+		}
+		next := ed.Selection.Primary()
+		if next.Start() > r.Start() || next.End() < r.End() || next.Len() <= r.Len() {
+			t.Fatalf("expanding %+v selected %+v", r, next)
+		}
+		r = next
+	}
+	for ; n > 0; n-- {
+		if e := ed.Do("shrink-selection", false); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if r := ed.Selection.Primary(); r.Anchor != at || r.Caret != at {
+		t.Errorf("shrinking back selected %+v", r)
+	}
+}
+
+// TestTreeNavigation checks moving between siblings, parents and children with the keyboard
+func TestTreeNavigation(t *testing.T) {
+	ed := plain(t, 6)
+	steps(
+		t, ed,
+		step{"next-segment", 13, 16},
+		step{"next-segment", 13, 16},
+		step{"prev-segment", 5, 11},
+		step{"prev-segment", 5, 11},
+		step{"parent-segment", 1, 17},
+		step{"parent-segment", 1, 17},
+		step{"child-segment", 5, 11},
+		step{"child-segment", 5, 11},
+	)
+	if e := ed.Do("next-segment", true); e != nil {
+		t.Fatal(e)
+	}
+	if r := ed.Selection.Primary(); r.Anchor != 5 || r.Caret != 16 {
+		t.Errorf("extending to the next segment selected %+v", r)
+	}
+	ed = plain(t, 18)
+	steps(
+		t, ed,
+		step{"next-segment", 21, 24},
+		step{"collapse", 24, 24},
+		step{"line-start", 0, 0},
+		step{"child-segment", 1, 17},
+	)
+	steps(t, plain(t, 18), step{"prev-segment", 1, 17})
+}
@@ -0,0 +1,472 @@
+package input
+
+import (
+	"sort"
+	"unicode"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// plan is what paredit does at a range of the selection, a change of the text, which may be no change at all, and
+// the range after it relative to the start of the change
+type plan struct {
+	change
+	r doc.Range
+}
+
+// stay is the plan that leaves a range as it is
+func stay(r doc.Range) plan {
+	start := r.Start()
+	return plan{change{start, start, ""}, doc.Range{Anchor: r.Anchor - start, Caret: r.Caret - start}}
+}
+
+// balanced reports whether the brackets, literals and block comments of the document are closed after changes that
+// do not overlap, in order
+func (ed *Editor) balanced(changes []change) bool {
+	syn := ed.Structure.Syntax()
+	if len(changes) == 0 {
+		return structure.Balanced(ed.Doc, syn)
+	}
+	txt := []rune(ed.Doc.Text())
+	out := make([]rune, 0, len(txt))
+	prev := 0
+	for _, c := range changes {
+		out = append(append(out, txt[prev:c.start]...), []rune(c.txt)...)
+		prev = c.end
+	}
+	return structure.Balanced(structure.Runes(append(out, txt[prev:]...)), syn)
+}
+
+// moved returns the changes that make up a move event
+func moved(ev doc.Event) []change {
+	n := len([]rune(ev.Old))
+	if ev.To < ev.Offset {
+		return []change{{ev.To, ev.To, ev.Text}, {ev.Offset, ev.Offset + n, ""}}
+	}
+	return []change{{ev.Offset, ev.Offset + n, ""}, {ev.To, ev.To, ev.Text}}
+}
+
+// brackets segments the document by the delimiters of its syntax alone, whatever parser its language has
+func (ed *Editor) brackets() *structure.Tree {
+	return structure.Parse(ed.Doc, ed.Structure.Syntax())
+}
+
+// typeBalanced is Type in paredit mode. At each range the text is typed as it is if that keeps the document balanced.
+// Otherwise the caret steps over it if it is the closing delimiter after the caret, it is escaped if it would close
+// the literal the caret is in, or it is typed with its closing delimiter around the selected text if it opens
+// something. A range where none of these keep the document balanced is left as it is.
+func (ed *Editor) typeBalanced(txt string) error {
+	tree := ed.brackets()
+	n := len([]rune(txt))
+	var plans []plan
+	for _, r := range ed.Selection.Ranges() {
+		start, end := r.Start(), r.End()
+		candidates := []plan{{change{start, end, txt}, doc.Cursor(n)}}
+		if r.Empty() && ed.closes(txt) && start+n <= ed.Doc.Len() && ed.Doc.Slice(start, start+n) == txt {
+			candidates = append(candidates, plan{change{start, start, ""}, doc.Cursor(n)})
+		}
+		if q, ok := ed.literal(tree, start); ok && r.Empty() && q.Escape != 0 && txt == q.Close {
+			candidates = append(candidates, plan{change{start, start, string(q.Escape) + txt}, doc.Cursor(n + 1)})
+		}
+		if closer, ok := ed.closer(txt); ok {
+			wrapped := change{start, end, txt + ed.Doc.Slice(start, end) + closer}
+			candidates = append(candidates, plan{wrapped, doc.Cursor(n)})
+		}
+		p := stay(r)
+		for _, c := range candidates {
+			if c.start == c.end && c.txt == "" || ed.balanced([]change{c.change}) {
+				p = c
+				break
+			}
+		}
+		plans = append(plans, p)
+	}
+	return ed.apply(plans)
+}
+
+// eraseBalanced is erase in paredit mode. Deleting part of a bracket, literal or block comment that holds nothing
+// deletes all of it, and deleting a delimiter of one that holds something moves the caret over the delimiter instead.
+// Selected text is only deleted if that keeps the document balanced.
+func (ed *Editor) eraseBalanced(m motion, forward bool) error {
+	tree := ed.brackets()
+	var plans []plan
+	for _, r := range ed.Selection.Ranges() {
+		start, end := r.Start(), r.End()
+		if r.Empty() {
+			if forward {
+				end = m(ed, r.Caret)
+			} else {
+				start = m(ed, r.Caret)
+			}
+		}
+		del := change{start, end, ""}
+		switch {
+		case start == end || ed.balanced([]change{del}):
+			plans = append(plans, plan{del, doc.Cursor(0)})
+		case !r.Empty():
+			plans = append(plans, stay(r))
+		default:
+			if s := empty(tree, start, end); s != nil {
+				plans = append(plans, plan{change{s.Start(), s.End(), ""}, doc.Cursor(0)})
+				continue
+			}
+			to := start
+			if forward {
+				to = end
+			}
+			plans = append(plans, plan{change{r.Caret, r.Caret, ""}, doc.Cursor(to - r.Caret)})
+		}
+	}
+	return ed.apply(plans)
+}
+
+// apply carries out the plans for the ranges of the selection as one edit and puts the ranges where the plans place
+// them. Nothing is done if the changes of the plans overlap or would unbalance the document.
+func (ed *Editor) apply(plans []plan) (e error) {
+	primary := ed.Selection.PrimaryIndex()
+	var changes []change
+	for _, p := range plans {
+		if p.start == p.end && p.txt == "" {
+			continue
+		}
+		if n := len(changes); n > 0 && p.start < changes[n-1].end {
+			return
+		}
+		changes = append(changes, p.change)
+	}
+	if len(changes) > 0 {
+		if !ed.balanced(changes) {
+			return
+		}
+		if e = ed.commit(changes); e != nil {
+			return
+		}
+	}
+	ranges := make([]doc.Range, len(plans))
+	shift := 0
+	for i, p := range plans {
+		if p.start == p.end && p.txt == "" {
+			// a range that only moves can move past the changes of the others
+			anchor, caret := follow(changes, p.start+p.r.Anchor), follow(changes, p.start+p.r.Caret)
+			ranges[i] = doc.Range{Anchor: anchor, Caret: caret}
+			continue
+		}
+		at := p.start + shift
+		ranges[i] = doc.Range{Anchor: at + p.r.Anchor, Caret: at + p.r.Caret}
+		shift += len([]rune(p.txt)) - (p.end - p.start)
+	}
+	ed.reselect(ranges, primary)
+	return
+}
+
+// follow returns where an offset in the text before changes is in the text after them. Offsets in replaced text go
+// to the end of its replacement.
+func follow(changes []change, at int) int {
+	moved := at
+	for _, c := range changes {
+		switch n := len([]rune(c.txt)); {
+		case c.end <= at:
+			moved += n - (c.end - c.start)
+		case c.start < at:
+			moved += c.start + n - at
+		}
+	}
+	return moved
+}
+
+// closes reports whether the text is the closing delimiter of a bracket, literal or block comment
+func (ed *Editor) closes(txt string) bool {
+	syn := ed.Structure.Syntax()
+	for _, b := range syn.Brackets {
+		if b.Close == txt {
+			return true
+		}
+	}
+	for _, q := range syn.Strings {
+		if q.Close == txt {
+			return true
+		}
+	}
+	for _, b := range syn.BlockComments {
+		if b.Close == txt {
+			return true
+		}
+	}
+	return false
+}
+
+// closer returns the closing delimiter of the bracket, literal or block comment the text opens
+func (ed *Editor) closer(txt string) (string, bool) {
+	syn := ed.Structure.Syntax()
+	for _, b := range syn.Brackets {
+		if b.Open == txt {
+			return b.Close, true
+		}
+	}
+	for _, q := range syn.Strings {
+		if q.Open == txt {
+			return q.Close, true
+		}
+	}
+	for _, b := range syn.BlockComments {
+		if b.Open == txt {
+			return b.Close, true
+		}
+	}
+	return "", false
+}
+
+// literal returns the quote of the string the offset is in, between its delimiters
+func (ed *Editor) literal(tree *structure.Tree, at int) (q structure.Quote, ok bool) {
+	s := tree.Enclosing(at)
+	if start, end := s.Inner(); s.Kind != structure.String || at < start || at > end {
+		return
+	}
+	for _, q = range ed.Structure.Syntax().Strings {
+		if q.Open == s.Label {
+			return q, true
+		}
+	}
+	return structure.Quote{}, false
+}
+
+// empty returns the innermost bracket, literal or block comment holding nothing that the range is a part of
+func empty(tree *structure.Tree, start, end int) *structure.Segment {
+	path := tree.Path(start)
+	for i := len(path) - 1; i > 0; i-- {
+		s := path[i]
+		if in, out := s.Inner(); s.Kind != structure.Indent && in == out && s.Start() <= start && end <= s.End() {
+			return s
+		}
+	}
+	return nil
+}
+
+// container returns the innermost bracket the offset is in, between its delimiters, or nil at the top level
+func container(tree *structure.Tree, at int) *structure.Segment {
+	path := tree.Path(at)
+	for i := len(path) - 1; i > 0; i-- {
+		if start, end := path[i].Inner(); path[i].Kind == structure.Bracket && start <= at && at <= end {
+			return path[i]
+		}
+	}
+	return nil
+}
+
+// outside returns the innermost bracket around a segment, or nil at the top level
+func outside(s *structure.Segment) *structure.Segment {
+	for s = s.Parent; s != nil && s.Kind != structure.Bracket; s = s.Parent {
+	}
+	return s
+}
+
+// inside returns the range between the delimiters of a bracket, or the whole document for nil
+func (ed *Editor) inside(s *structure.Segment) (start, end int) {
+	if s == nil {
+		return 0, ed.Doc.Len()
+	}
+	return s.Inner()
+}
+
+// delimiters returns the opening and closing delimiters of a segment
+func (ed *Editor) delimiters(s *structure.Segment) (open, close string) {
+	start, end := s.Inner()
+	return ed.Doc.Slice(s.Start(), start), ed.Doc.Slice(end, s.End())
+}
+
+// itemAfter returns the first item between the offset and the limit. Items are runs of text without white space, in
+// which brackets, literals and comments count whole.
+func (ed *Editor) itemAfter(tree *structure.Tree, at, limit int) (start, end int, ok bool) {
+	for at < limit && unicode.IsSpace(ed.Doc.RuneAt(at)) {
+		at++
+	}
+	if at >= limit {
+		return
+	}
+	start = at
+	for at < limit && !unicode.IsSpace(ed.Doc.RuneAt(at)) {
+		at = over(tree, at)
+	}
+	if at > limit {
+		at = limit
+	}
+	return start, at, true
+}
+
+// itemBefore returns the last item between the limit and the offset
+func (ed *Editor) itemBefore(tree *structure.Tree, at, limit int) (start, end int, ok bool) {
+	for at > limit && unicode.IsSpace(ed.Doc.RuneAt(at-1)) {
+		at--
+	}
+	if at <= limit {
+		return
+	}
+	end = at
+	for at > limit && !unicode.IsSpace(ed.Doc.RuneAt(at-1)) {
+		at = back(tree, at)
+	}
+	if at < limit {
+		at = limit
+	}
+	return at, end, true
+}
+
+// itemAt returns the item inside a bracket, or at the top level for nil, that the offset is in or at the end of, or
+// else the first one after it
+func (ed *Editor) itemAt(tree *structure.Tree, s *structure.Segment, at int) (start, end int, ok bool) {
+	from, limit := ed.inside(s)
+	for {
+		if start, end, ok = ed.itemAfter(tree, from, limit); !ok || end >= at {
+			return
+		}
+		from = end
+	}
+}
+
+// over returns the end of the outermost segment starting at the offset, or else the offset after it
+func over(tree *structure.Tree, at int) int {
+	for _, s := range tree.Path(at)[1:] {
+		if s.Kind != structure.Indent && s.Start() == at {
+			return s.End()
+		}
+	}
+	return at + 1
+}
+
+// back returns the start of the outermost segment ending at the offset, or else the offset before it
+func back(tree *structure.Tree, at int) int {
+	for _, s := range tree.Path(at - 1)[1:] {
+		if s.Kind != structure.Indent && s.End() == at {
+			return s.Start()
+		}
+	}
+	return at - 1
+}
+
+// restructure makes changes that do not overlap as one edit, unless they would unbalance the document
+func (ed *Editor) restructure(changes ...change) (ok bool, e error) {
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].start < changes[j].start })
+	if !ed.balanced(changes) {
+		return
+	}
+	return true, ed.commit(changes)
+}
+
+// slurp moves the closing delimiter of the bracket around the primary caret past the item after the bracket, or the
+// opening delimiter back before the item before it
+func (ed *Editor) slurp(forward bool) (e error) {
+	tree := ed.brackets()
+	s := container(tree, ed.Selection.Primary().Caret)
+	if s == nil {
+		return
+	}
+	lo, hi := ed.inside(outside(s))
+	open, close := ed.delimiters(s)
+	start, end := s.Inner()
+	if forward {
+		if _, to, ok := ed.itemAfter(tree, s.End(), hi); ok {
+			_, e = ed.restructure(change{end, s.End(), ""}, change{to, to, close})
+		}
+		return
+	}
+	if to, _, ok := ed.itemBefore(tree, s.Start(), lo); ok {
+		_, e = ed.restructure(change{to, to, open}, change{s.Start(), start, ""})
+	}
+	return
+}
+
+// barf moves the closing delimiter of the bracket around the primary caret back before its last item, or the opening
+// delimiter past its first item
+func (ed *Editor) barf(forward bool) (e error) {
+	tree := ed.brackets()
+	s := container(tree, ed.Selection.Primary().Caret)
+	if s == nil {
+		return
+	}
+	open, close := ed.delimiters(s)
+	start, end := s.Inner()
+	if forward {
+		last, _, ok := ed.itemBefore(tree, end, start)
+		if !ok {
+			return
+		}
+		to := start
+		if _, prev, ok := ed.itemBefore(tree, last, start); ok {
+			to = prev
+		}
+		_, e = ed.restructure(change{to, to, close}, change{end, s.End(), ""})
+		return
+	}
+	_, first, ok := ed.itemAfter(tree, start, end)
+	if !ok {
+		return
+	}
+	to := end
+	if next, _, ok := ed.itemAfter(tree, first, end); ok {
+		to = next
+	}
+	_, e = ed.restructure(change{s.Start(), start, ""}, change{to, to, open})
+	return
+}
+
+// splice removes the delimiters of the bracket around the primary caret, leaving what it holds in its place
+func (ed *Editor) splice() (e error) {
+	s := container(ed.brackets(), ed.Selection.Primary().Caret)
+	if s == nil {
+		return
+	}
+	start, end := s.Inner()
+	_, e = ed.restructure(change{s.Start(), start, ""}, change{end, s.End(), ""})
+	return
+}
+
+// raise replaces the bracket around the primary caret with the item the caret is at
+func (ed *Editor) raise() (e error) {
+	tree := ed.brackets()
+	at := ed.Selection.Primary().Caret
+	s := container(tree, at)
+	if s == nil {
+		return
+	}
+	if start, end, ok := ed.itemAt(tree, s, at); ok {
+		_, e = ed.restructure(change{s.Start(), start, ""}, change{end, s.End(), ""})
+	}
+	return
+}
+
+// wrap puts the selected text, or else the item at the primary caret, in the first kind of bracket of the syntax, with
+// the caret after the opening delimiter
+func (ed *Editor) wrap() (e error) {
+	brackets := ed.Structure.Syntax().Brackets
+	if len(brackets) == 0 {
+		return
+	}
+	b := brackets[0]
+	r := ed.Selection.Primary()
+	start, end := r.Start(), r.End()
+	if r.Empty() {
+		tree := ed.brackets()
+		var ok bool
+		if start, end, ok = ed.itemAt(tree, container(tree, r.Caret), r.Caret); !ok || start > r.Caret {
+			start, end = r.Caret, r.Caret
+		}
+	}
+	var ok bool
+	if ok, e = ed.restructure(change{start, start, b.Open}, change{end, end, b.Close}); ok && e == nil {
+		ed.Selection.Set(doc.Cursor(start + len([]rune(b.Open))))
+	}
+	return
+}
+
+// split closes the bracket around the primary caret at the caret and opens another one after it
+func (ed *Editor) split() (e error) {
+	at := ed.Selection.Primary().Caret
+	s := container(ed.brackets(), at)
+	if s == nil {
+		return
+	}
+	open, close := ed.delimiters(s)
+	_, e = ed.restructure(change{at, at, close + open})
+	return
+}
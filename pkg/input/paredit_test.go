@@ -0,0 +1,210 @@
+package input_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// strict returns an editor in paredit mode of a text with the caret where the text has a |
+func strict(t *testing.T, txt string) *editor {
+	t.Helper()
+	ed := newEditor(t)
+	at := strings.Index(txt, "|")
+	typed(t, ed, strings.Replace(txt, "|", "", 1))
+	ed.Selection.Set(doc.Cursor(len([]rune(txt[:at]))))
+	ed.Paredit = true
+	return ed
+}
+
+// marked returns the text of an editor with a | at the primary caret
+func marked(ed *editor) string {
+	txt := []rune(ed.Doc.Text())
+	at := ed.Selection.Primary().Caret
+	return string(txt[:at]) + "|" + string(txt[at:])
+}
+
+// TestParedit checks what typing, deleting and the structural commands do to the brackets around the caret
+func TestParedit(t *testing.T) {
+	for _, c := range []struct{ src, action, want string }{
+		{"x := |", "(", "x := (|)"},
+		{"f(a|)", ")", "f(a)|"},
+		{"f(a| b)", ")", "f(a| b)"},
+		{"s := |", `"`, `s := "|"`},
+		{`s := "a|b"`, `"`, `s := "a\"|b"`},
+		{`s := "ab|"`, `"`, `s := "ab"|`},
+		{"// it|", "'", "// it'|"},
+		{"f(|)", "delete-left", "f|"},
+		{"f(a)|", "delete-left", "f(a|)"},
+		{"f(|a)", "delete-left", "f|(a)"},
+		{`s := "a"|`, "delete-left", `s := "a|"`},
+		{`s := ""|`, "delete-left", `s := |`},
+		{`s := "|"`, "delete-left", `s := |`},
+		{"f(|a)", "delete-right", "f(|)"},
+		{"f(a|)", "delete-right", "f(a)|"},
+		{"x /*|*/", "delete-right", "x |"},
+		{"f(a|) b c", "slurp-forward", "f(a| b) c"},
+		{"a b (c|)", "slurp-backward", "a (b c|)"},
+		{"f(a|) // c", "slurp-forward", "f(a|) // c"},
+		{"f(a b| c)", "barf-forward", "f(a b)| c"},
+		{"(a b| c)", "barf-backward", "a (b| c)"},
+		{"f(a (b| c))", "splice", "f(a b| c)"},
+		{"f(a (b| c))", "raise", "f(a b|)"},
+		{"f(a b|)", "wrap", "f(a (|b))"},
+		{"f(a| b)", "split", "f(a)(| b)"},
+		{"f(a, \"b|\")", "split", "f(a, \"b)(|\")"},
+	} {
+		ed := strict(t, c.src)
+		var e error
+		if strings.Contains(c.action, "-") || len(c.action) > 1 {
+			e = ed.Do(c.action, false)
+		} else {
+			e = ed.Type(c.action)
+		}
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got := marked(ed); got != c.want {
+			t.Errorf("%s in %q gave %q, want %q", c.action, c.src, got, c.want)
+		}
+	}
+}
+
+// TestPareditSelection checks that an opener typed over selected text wraps it, and that unbalanced selections are not
+// cut
+func TestPareditSelection(t *testing.T) {
+	ed := strict(t, "f(a b)|")
+	ed.Selection.Set(doc.Range{Anchor: 2, Caret: 5})
+	typed(t, ed, "[")
+	if got, want := marked(ed), "f([|a b])"; got != want {
+		t.Errorf("wrapping gave %q, want %q", got, want)
+	}
+	ed.Selection.Set(doc.Range{Anchor: 1, Caret: 4})
+	if e := ed.Do("cut", false); e != nil {
+		t.Fatal(e)
+	}
+	checkText(t, ed, "f([a b])")
+	if e := ed.Do("paste", false); e != nil {
+		t.Fatal(e)
+	}
+	checkText(t, ed, "f([a b])")
+}
+
+// stroke is a key the property test presses, which runs an action or types text
+type stroke struct {
+	action string
+	extend bool
+	txt    string
+}
+
+func (s stroke) String() string {
+	if s.action == "" {
+		return fmt.Sprintf("%q", s.txt)
+	}
+	if s.extend {
+		return "select-" + s.action
+	}
+	return s.action
+}
+
+// session is a balanced text, the offset of the caret in it and keys pressed in paredit mode
+type session struct {
+	src     string
+	at      int
+	strokes []stroke
+}
+
+func (s session) String() string {
+	return fmt.Sprintf("%q at %d then %v", s.src, s.at, s.strokes)
+}
+
+var (
+	pieces = []string{
+		"(", ")", "[", "]", "{", "}", "\"", "'", "`", "/", "*", "\\", "//", "/*", "*/", "\n", " ", "x", "a b",
+	}
+	strokeActions = []string{
+		"left", "right", "word-left", "word-right", "segment-left", "segment-right", "up", "down", "line-start",
+		"line-end", "delete-left", "delete-right", "delete-word-left", "delete-word-right", "newline", "tab", "cut",
+		"copy", "paste", "undo", "redo", "select-segment", "select-inner-segment", "select-line", "select-next",
+		"add-cursor-down", "collapse", "move-segment-up", "move-segment-down", "slurp-forward", "slurp-backward",
+		"barf-forward", "barf-backward", "splice", "raise", "wrap", "split", "paste-extended", "paste-wrapped",
+		"paste-raw",
+	}
+)
+
+// balancedText returns random text with brackets, literals and comments that are all closed
+func balancedText(rnd *rand.Rand, depth int) string {
+	var sb strings.Builder
+	for i := rnd.Intn(4); i >= 0; i-- {
+		switch n := rnd.Intn(10); {
+		case n < 3 && depth > 0:
+			b := [][2]string{{"(", ")"}, {"[", "]"}, {"{", "}"}}[rnd.Intn(3)]
+			sb.WriteString(b[0] + balancedText(rnd, depth-1) + b[1])
+		case n == 3:
+			sb.WriteString([]string{`"s(t"`, `'['`, "`r\n}`", `"\""`}[rnd.Intn(4)])
+		case n == 4:
+			sb.WriteString([]string{"/* ( */", "// ]\n"}[rnd.Intn(2)])
+		case n == 5:
+			sb.WriteString("\n\t")
+		default:
+			sb.WriteString([]string{"a", "b ", "f", ", ", " "}[rnd.Intn(5)])
+		}
+	}
+	return sb.String()
+}
+
+// Generate makes a session for testing/quick
+func (session) Generate(rnd *rand.Rand, size int) reflect.Value {
+	s := session{src: balancedText(rnd, 4)}
+	s.at = rnd.Intn(len([]rune(s.src)) + 1)
+	for i := rnd.Intn(size * 2); i >= 0; i-- {
+		if rnd.Intn(2) == 0 {
+			s.strokes = append(s.strokes, stroke{txt: pieces[rnd.Intn(len(pieces))]})
+			continue
+		}
+		action := strokeActions[rnd.Intn(len(strokeActions))]
+		s.strokes = append(s.strokes, stroke{action: action, extend: rnd.Intn(4) == 0})
+	}
+	return reflect.ValueOf(s)
+}
+
+// TestPareditBalance checks that no sequence of keys leaves a balanced document unbalanced in paredit mode
+func TestPareditBalance(t *testing.T) {
+	balanced := func(s session) bool {
+		ed := newEditor(t)
+		typed(t, ed, s.src)
+		if !structure.Balanced(ed.Doc, nil) {
+			t.Fatalf("generated text %q is not balanced", s.src)
+		}
+		ed.Selection.Set(doc.Cursor(s.at))
+		ed.Paredit = true
+		for i, k := range s.strokes {
+			var e error
+			if k.action == "" {
+				e = ed.Type(k.txt)
+			} else {
+				e = ed.Do(k.action, k.extend)
+			}
+			if e != nil && !errors.Is(e, undo.ErrRoot) && !errors.Is(e, undo.ErrLeaf) {
+				t.Fatal(e)
+			}
+			if !structure.Balanced(ed.Doc, nil) {
+				t.Logf("after %v the text is %q", s.strokes[:i+1], ed.Doc.Text())
+				return false
+			}
+		}
+		return true
+	}
+	cfg := &quick.Config{MaxCount: 300, Rand: rand.New(rand.NewSource(1))}
+	if e := quick.Check(balanced, cfg); e != nil {
+		t.Error(e)
+	}
+}
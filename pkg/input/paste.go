@@ -0,0 +1,175 @@
+package input
+
+import (
+	"strings"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// Offer is the ways text in the register that leaves brackets, literals or block comments open, or closes ones it did
+// not open, can be pasted. The paste-extended, paste-wrapped and paste-raw actions choose between them.
+type Offer struct {
+	// Text is the text as it is
+	Text string
+	// Extended is the smallest balanced fragment around the text in the document it was copied from, if it is known
+	Extended string
+	// Wrapped is the text between the delimiters it is missing, if they balance it
+	Wrapped string
+}
+
+// paste replaces the selected text with the register, re-indented to the line of each range. When it has a line for
+// each range, each range gets its line. Unbalanced text that can be extended or wrapped is not pasted but offered,
+// for one of the other paste actions to paste.
+func (ed *Editor) paste() error {
+	if ed.Register == "" {
+		return nil
+	}
+	if ed.Offer = ed.offer(); ed.Offer != nil {
+		return nil
+	}
+	return ed.pasteText(ed.Register)
+}
+
+// pasteAs pastes the register the way of the offer that way picks, or nothing if it cannot be pasted that way. A
+// balanced register is pasted as it is.
+func (ed *Editor) pasteAs(way func(o *Offer) string) error {
+	if ed.Register == "" {
+		return nil
+	}
+	o := ed.offer()
+	if o == nil {
+		return ed.pasteText(ed.Register)
+	}
+	if txt := way(o); txt != "" {
+		return ed.pasteText(txt)
+	}
+	return nil
+}
+
+// offer returns the ways the register can be pasted if it is unbalanced and can be extended or wrapped, or nil
+func (ed *Editor) offer() (o *Offer) {
+	syn := ed.Structure.Syntax()
+	txt := []rune(ed.Register)
+	if structure.Balanced(structure.Runes(txt), syn) {
+		return nil
+	}
+	o = &Offer{Text: ed.Register}
+	if ed.copied == ed.Register && structure.Balanced(structure.Runes([]rune(ed.extended)), syn) {
+		o.Extended = ed.extended
+	}
+	open, close := structure.Missing(structure.Runes(txt), syn)
+	if wrapped := open + ed.Register + close; structure.Balanced(structure.Runes([]rune(wrapped)), syn) {
+		o.Wrapped = wrapped
+	}
+	if o.Extended == "" && o.Wrapped == "" {
+		return nil
+	}
+	return
+}
+
+// pasteText replaces the selected text with text as one edit, re-indented to the line of each range, or a line of it
+// at each range when it has as many lines as there are ranges
+func (ed *Editor) pasteText(txt string) error {
+	var lines []string
+	if n := ed.Selection.Len(); n > 1 {
+		if lines = strings.Split(txt, "\n"); len(lines) != n {
+			lines = nil
+		}
+	}
+	i := 0
+	return ed.edit(
+		func(r doc.Range) (start, end int, s string) {
+			s = txt
+			if lines != nil {
+				s = lines[i]
+			}
+			i++
+			return r.Start(), r.End(), ed.reindent(s, r.Start())
+		},
+	)
+}
+
+// extend returns the smallest balanced fragment of the document around a range, which takes in every segment the range
+// cuts through, or "" if there is none
+func (ed *Editor) extend(start, end int) string {
+	tree := ed.brackets()
+	for changed := true; changed; {
+		changed = false
+		for _, at := range []int{start, end - 1} {
+			for _, seg := range tree.Path(at)[1:] {
+				in, out := seg.Inner()
+				if in <= start && end <= out || start <= seg.Start() && seg.End() <= end {
+					continue
+				}
+				if seg.Start() < start {
+					start, changed = seg.Start(), true
+				}
+				if seg.End() > end {
+					end, changed = seg.End(), true
+				}
+			}
+		}
+	}
+	txt := ed.Doc.Slice(start, end)
+	if !structure.Balanced(structure.Runes([]rune(txt)), ed.Structure.Syntax()) {
+		return ""
+	}
+	return txt
+}
+
+// reindent indents the lines of text pasted at an offset to the depth of the line there. The indentation the lines
+// share is replaced by that of the line, and the first line is indented as well when only white space is before the
+// offset. Text pasted into a literal is left as it is.
+func (ed *Editor) reindent(txt string, at int) string {
+	lines := strings.Split(txt, "\n")
+	if _, in := ed.literal(ed.Structure, at); len(lines) == 1 || in {
+		return txt
+	}
+	before := ed.indentation(at)
+	first := ed.lineStart(at)+len([]rune(before)) == at
+	target := ed.indentation(ed.lineEnd(at))
+	var common string
+	shared := false
+	for i, line := range lines {
+		if i == 0 && !first || strings.TrimSpace(line) == "" {
+			continue
+		}
+		if ind := leading(line); !shared {
+			common, shared = ind, true
+		} else {
+			common = commonPrefix(common, ind)
+		}
+	}
+	for i, line := range lines {
+		switch {
+		case i == 0 && !first:
+		case strings.TrimSpace(line) == "":
+			lines[i] = ""
+		case i == 0:
+			// the white space before the offset already indents it part of the way
+			extra := ""
+			if strings.HasPrefix(target, before) {
+				extra = target[len(before):]
+			}
+			lines[i] = extra + line[len(common):]
+		default:
+			lines[i] = target + line[len(common):]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// leading returns the spaces and tabs a line starts with
+func leading(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// commonPrefix returns the longest start two strings share
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
@@ -0,0 +1,91 @@
+package input_test
+
+import (
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+)
+
+// TestPasteIndent checks that pasted lines are indented to the depth of the line they are pasted on
+func TestPasteIndent(t *testing.T) {
+	for _, c := range []struct{ src, register, want string }{
+		{
+			"func f() {\n\tif x {\n\t\t|\n\t}\n}", "g(a,\n\tb)\nh()",
+			"func f() {\n\tif x {\n\t\tg(a,\n\t\t\tb)\n\t\th()|\n\t}\n}",
+		},
+		{"func f() {\n\tx := |\n}", "g(\n    a,\n)", "func f() {\n\tx := g(\n\t    a,\n\t)|\n}"},
+		{"{\n|\tbar()\n}", "\t\tfoo()\n\n\t\tbaz()\n", "{\n\tfoo()\n\n\tbaz()\n|\tbar()\n}"},
+		{"s := `|`", "a\n\tb", "s := `a\n\tb|`"},
+		{"x(|)", "a b", "x(a b|)"},
+	} {
+		ed := strict(t, c.src)
+		ed.Paredit = false
+		ed.Register = c.register
+		if e := ed.Do("paste", false); e != nil {
+			t.Fatal(e)
+		}
+		if got := marked(ed); got != c.want {
+			t.Errorf("pasting %q in %q gave %q, want %q", c.register, c.src, got, c.want)
+		}
+	}
+}
+
+// TestPasteUnbalanced checks that unbalanced text is offered extended to the fragment it was copied from and wrapped
+// in the delimiters it is missing, and that each way of pasting it is a single edit
+func TestPasteUnbalanced(t *testing.T) {
+	const rest = "f(, c))\n"
+	for _, c := range []struct{ action, want string }{
+		{"paste-extended", "a, (b, c)"},
+		{"paste-wrapped", "a, (b)"},
+		{"paste-raw", "a, (b"},
+	} {
+		ed := strict(t, "f(a, (b, c))\n|")
+		ed.Paredit = false
+		ed.Selection.Set(doc.Range{Anchor: 2, Caret: 7})
+		if e := ed.Do("cut", false); e != nil {
+			t.Fatal(e)
+		}
+		checkText(t, ed, rest)
+		ed.Selection.Set(doc.Cursor(ed.Doc.Len()))
+		if e := ed.Do("paste", false); e != nil {
+			t.Fatal(e)
+		}
+		checkText(t, ed, rest)
+		if o := ed.Offer; o == nil || o.Text != "a, (b" || o.Extended != "a, (b, c)" || o.Wrapped != "a, (b)" {
+			t.Fatalf("pasting offered %+v", o)
+		}
+		if e := ed.Do(c.action, false); e != nil {
+			t.Fatal(e)
+		}
+		if ed.Offer != nil {
+			t.Errorf("%s left the offer", c.action)
+		}
+		checkText(t, ed, rest+c.want)
+		if e := ed.Do("undo", false); e != nil {
+			t.Fatal(e)
+		}
+		checkText(t, ed, rest)
+	}
+	// text that did not come from a copy is only offered wrapped, and the offer lasts until the next action
+	ed := strict(t, "f(|)")
+	ed.Paredit = false
+	ed.Register = "a]"
+	if e := ed.Do("paste", false); e != nil {
+		t.Fatal(e)
+	}
+	if o := ed.Offer; o == nil || o.Extended != "" || o.Wrapped != "[a]" {
+		t.Fatalf("pasting offered %+v", o)
+	}
+	if e := ed.Do("left", false); e != nil {
+		t.Fatal(e)
+	}
+	if ed.Offer != nil {
+		t.Error("moving kept the offer")
+	}
+	// text that cannot be balanced is pasted as it is
+	ed.Register = "\"a\nb"
+	if e := ed.Do("paste", false); e != nil {
+		t.Fatal(e)
+	}
+	checkText(t, ed, "f\"a\nb()")
+}
@@ -0,0 +1,145 @@
+package journal
+
+import (
+	"os"
+	"time"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// Compact returns the records of a smaller history with the same current state. Branches that lead to neither the
+// current node nor a named node, and that have not been added to since the cutoff, are squashed into a single node
+// holding the events of their most recent path. Everything else keeps its nodes, and the records end with a snapshot
+// of the current node.
+func Compact(t *undo.Tree, cutoff time.Time) (records []Record) {
+	nodes := t.Nodes()
+	// newest is the time of the most recent node in the subtree of each node, children always come after their parent
+	newest := make([]time.Time, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		if n.Time.After(newest[i]) {
+			newest[i] = n.Time
+		}
+		if n.Parent != nil && newest[i].After(newest[n.Parent.ID]) {
+			newest[n.Parent.ID] = newest[i]
+		}
+	}
+	keep := make([]bool, len(nodes))
+	mark := func(n *undo.Node) {
+		for ; n != nil && !keep[n.ID]; n = n.Parent {
+			keep[n.ID] = true
+		}
+	}
+	mark(t.Current())
+	for _, n := range t.Bookmarks() {
+		mark(n)
+	}
+	for _, n := range nodes {
+		if !newest[n.ID].Before(cutoff) {
+			mark(n)
+		}
+	}
+	ids := make(map[int]int)
+	ids[0] = 0
+	for _, n := range nodes[1:] {
+		if !keep[n.ID] && keep[n.Parent.ID] {
+			// an abandoned branch becomes one node reaching the newest of its tips
+			var events []doc.Event
+			tip := n
+			for {
+				events = append(events, tip.Events...)
+				if tip.Leaf() {
+					break
+				}
+				next := tip.Children[0]
+				for _, ch := range tip.Children[1:] {
+					if newest[ch.ID].After(newest[next.ID]) {
+						next = ch
+					}
+				}
+				tip = next
+			}
+			ids[n.ID] = len(ids)
+			records = append(
+				records, Record{Kind: NodeRecord, Node: ids[n.ID], Parent: ids[n.Parent.ID], Time: tip.Time,
+					Events: events},
+			)
+			continue
+		}
+		if keep[n.ID] {
+			ids[n.ID] = len(ids)
+			records = append(
+				records, Record{Kind: NodeRecord, Node: ids[n.ID], Parent: ids[n.Parent.ID], Time: n.Time,
+					Events: n.Events},
+			)
+		}
+	}
+	for _, n := range t.Bookmarks() {
+		records = append(records, Record{Kind: NameRecord, Node: ids[n.ID], Name: n.Name})
+	}
+	cur := ids[t.Current().ID]
+	records = append(records, Record{Kind: SwitchRecord, Node: cur})
+	snap := Snapshot(t)
+	snap.Node = cur
+	return append(records, snap)
+}
+
+// Stats describes a journal before and after a compaction, and how many nodes were squashed away
+type Stats struct {
+	Nodes, Records [2]int
+	Size           [2]int64
+	Squashed       int
+}
+
+// CompactFile compacts the journal at the path, squashing abandoned branches that are older than the age. The
+// compacted journal is written beside the old one and then replaces it, so a crash during compaction loses nothing.
+// The journal must not be open for appending while it is compacted.
+func CompactFile(path string, age time.Duration, now time.Time) (st Stats, e error) {
+	var j *Journal
+	var records []Record
+	if j, records, e = Open(path); e != nil {
+		return
+	}
+	st.Records[0], st.Size[0] = len(records), j.Size()
+	if e = j.Close(); E.Chk(e) {
+		return
+	}
+	t := undo.New(doc.New())
+	if e = Restore(t, records); e != nil {
+		return
+	}
+	st.Nodes[0] = t.Len()
+	compacted := Compact(t, now.Add(-age))
+	if file := File(records); file != "" {
+		compacted = append([]Record{{Kind: FileRecord, Name: file}}, compacted...)
+	}
+	if sum := Disk(records); sum != "" {
+		compacted = append(compacted, Record{Kind: DiskRecord, Name: sum})
+	}
+	tmp := path + ".compact"
+	_ = os.Remove(tmp)
+	var out *Journal
+	if out, _, e = Open(tmp); e != nil {
+		return
+	}
+	out.Sync(false)
+	for _, r := range compacted {
+		if r.Kind == NodeRecord {
+			st.Nodes[1]++
+		}
+		if e = out.Append(r); E.Chk(e) {
+			_ = out.Close()
+			return
+		}
+	}
+	// the root is not in the records
+	st.Nodes[1]++
+	st.Records[1], st.Size[1] = len(compacted), out.Size()
+	st.Squashed = st.Nodes[0] - st.Nodes[1]
+	if e = out.Close(); E.Chk(e) {
+		return
+	}
+	e = os.Rename(tmp, path)
+	return
+}
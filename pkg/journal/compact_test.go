@@ -0,0 +1,225 @@
+package journal_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// clock returns a document clock that moves a minute forward on every reading
+func clock(start time.Time) func() time.Time {
+	return func() time.Time {
+		start = start.Add(time.Minute)
+		return start
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "snap.journal")
+	j, _, e := journal.Open(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	j.Sync(false).SnapshotEvery(10)
+	h := undo.New(doc.New())
+	journal.Attach(j, h)
+	for i := 0; i < 95; i++ {
+		if _, e = h.Edit(func(d *doc.Document) error { return d.Insert(d.Len(), "x") }); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if _, e = h.Edit(func(d *doc.Document) error { return d.Annotate("n", 0, 3, "first three") }); e != nil {
+		t.Fatal(e)
+	}
+	j.Close()
+	r, records := restore(t, path)
+	snapshots := 0
+	for _, rec := range records {
+		if rec.Kind == journal.SnapshotRecord {
+			snapshots++
+		}
+	}
+	if snapshots != 9 {
+		t.Errorf("%d snapshots were written for 96 events", snapshots)
+	}
+	// only the events after the last snapshot are replayed onto it
+	if got := r.Doc().Log().Len(); got > 10 {
+		t.Errorf("restoring replayed %d events", got)
+	}
+	if r.Doc().Text() != h.Doc().Text() || len(r.Doc().Notes()) != 1 {
+		t.Errorf("restored %q with %v", r.Doc().Text(), r.Doc().Notes())
+	}
+	if e = r.Switch(40); e != nil {
+		t.Fatal(e)
+	}
+	if r.Doc().Len() != 40 {
+		t.Errorf("node 40 of the restored history has %d runes", r.Doc().Len())
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "compact.journal")
+	j, _, e := journal.Open(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := doc.New()
+	d.Clock = clock(start)
+	h := undo.New(d)
+	journal.Attach(j, h)
+	insert := func(s string) {
+		if _, e := h.Edit(func(d *doc.Document) error { return d.Insert(d.Len(), s) }); e != nil {
+			t.Fatal(e)
+		}
+	}
+	// an old branch of three edits with a fork in it, an old branch with a bookmark, and the current branch
+	insert("a")
+	insert("b")
+	insert("c")
+	insert("d")
+	if e = h.Switch(2); e != nil {
+		t.Fatal(e)
+	}
+	insert("e")
+	if e = h.Switch(1); e != nil {
+		t.Fatal(e)
+	}
+	insert("f")
+	if e = h.Name(h.Current().ID, "kept"); e != nil {
+		t.Fatal(e)
+	}
+	if e = h.Switch(0); e != nil {
+		t.Fatal(e)
+	}
+	insert("g")
+	insert("h")
+	j.Close()
+	old, _ := restore(t, path)
+	texts := map[string]bool{}
+	for _, n := range old.Branches() {
+		s, _ := old.Text(n.ID)
+		texts[s] = true
+	}
+	st, e := journal.CompactFile(path, time.Hour, start.Add(5*time.Hour))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if st.Nodes != [2]int{9, 6} || st.Squashed != 3 || st.Size[1] >= st.Size[0] {
+		t.Errorf("compaction stats %+v", st)
+	}
+	h, _ = restore(t, path)
+	if h.Doc().Text() != "gh" || h.Len() != 6 {
+		t.Fatalf("compacted history is at %q with %d nodes", h.Doc().Text(), h.Len())
+	}
+	n, ok := h.Lookup("kept")
+	if !ok {
+		t.Fatal("the bookmark was lost")
+	}
+	if s, _ := h.Text(n.ID); s != "af" {
+		t.Errorf("the bookmark is %q", s)
+	}
+	// the fork of the old branch is squashed into its newest tip, the older tip is gone
+	got := map[string]bool{}
+	for _, n := range h.Branches() {
+		s, _ := h.Text(n.ID)
+		got[s] = true
+	}
+	if !got["abe"] || got["abcd"] || !got["gh"] || !got["af"] || len(got) != 3 {
+		t.Errorf("branches after compaction are %v, before %v", got, texts)
+	}
+	// nothing is squashed when every branch is recent
+	if st, e = journal.CompactFile(path, time.Hour, start); e != nil || st.Squashed != 0 {
+		t.Errorf("a second compaction squashed %d nodes, %v", st.Squashed, e)
+	}
+}
+
+const benchEvents = 1000000
+
+var benchJournals sync.Map
+
+// benchJournal writes a journal of a million single character insertions, in nodes of ten events, with snapshots
+// every given number of events
+func benchJournal(b *testing.B, every int) string {
+	if path, ok := benchJournals.Load(every); ok {
+		return path.(string)
+	}
+	dir, e := ioutil.TempDir("", "glombench")
+	if e != nil {
+		b.Fatal(e)
+	}
+	path := filepath.Join(dir, fmt.Sprint(every, ".journal"))
+	j, _, e := journal.Open(path)
+	if e != nil {
+		b.Fatal(e)
+	}
+	j.Sync(false).SnapshotEvery(every)
+	h := undo.New(doc.New())
+	journal.Attach(j, h)
+	events := make([]doc.Event, 10)
+	for i := 0; i < benchEvents; i += len(events) {
+		for k := range events {
+			events[k] = doc.Event{Kind: doc.Insert, Offset: i + k, Text: string(rune('a' + k))}
+		}
+		if _, e = h.Commit(events...); e != nil {
+			b.Fatal(e)
+		}
+	}
+	if e = j.Close(); e != nil {
+		b.Fatal(e)
+	}
+	benchJournals.Store(every, path)
+	return path
+}
+
+func benchmarkOpen(b *testing.B, every int) {
+	path := benchJournal(b, every)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j, records, e := journal.Open(path)
+		if e != nil {
+			b.Fatal(e)
+		}
+		h := undo.New(doc.New())
+		if e = journal.Restore(h, records); e != nil {
+			b.Fatal(e)
+		}
+		if h.Doc().Len() != benchEvents {
+			b.Fatalf("restored %d runes", h.Doc().Len())
+		}
+		j.Close()
+	}
+}
+
+// BenchmarkOpen1MSnapshots opens a journal of a million events with the default snapshot interval
+func BenchmarkOpen1MSnapshots(b *testing.B) {
+	benchmarkOpen(b, journal.DefaultSnapshotEvery)
+}
+
+// BenchmarkOpen1MReplay opens a journal of a million events without snapshots, replaying every event
+func BenchmarkOpen1MReplay(b *testing.B) {
+	benchmarkOpen(b, 0)
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	benchJournals.Range(
+		func(_, path interface{}) bool {
+			os.RemoveAll(filepath.Dir(path.(string)))
+			return true
+		},
+	)
+	os.Exit(code)
+}
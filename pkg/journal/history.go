@@ -0,0 +1,134 @@
+package journal
+
+import (
+	"fmt"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// Attach appends a record to the journal for every change made to the tree from now on. When the current node is
+// more than the snapshot interval of events away from the nearest snapshot above it, a snapshot of the document is
+// written as well. The interval grows with the document to an eighth of its length, so that the snapshots of a long
+// document do not take up more of the journal than the events do.
+func Attach(j *Journal, t *undo.Tree) {
+	t.Watch(
+		func(c undo.Change, n *undo.Node) {
+			var r Record
+			switch c {
+			case undo.Added:
+				r = Record{Kind: NodeRecord, Node: n.ID, Parent: n.Parent.ID, Time: n.Time, Events: n.Events}
+			case undo.Switched:
+				r = Record{Kind: SwitchRecord, Node: n.ID}
+			case undo.Named:
+				r = Record{Kind: NameRecord, Node: n.ID, Name: n.Name}
+			default:
+				return
+			}
+			if e := j.Append(r); E.Chk(e) {
+				return
+			}
+			if c == undo.Named || j.every <= 0 {
+				return
+			}
+			every := j.every
+			if l := t.Doc().Len() / 8; l > every {
+				every = l
+			}
+			if j.distance(n) >= every {
+				if e := j.Append(Snapshot(t)); E.Chk(e) {
+				}
+			}
+		},
+	)
+}
+
+// distance counts the events between the node and the nearest snapshot above it. The counts are remembered for each
+// node, so that adding a node only has to look at its parent.
+func (j *Journal) distance(n *undo.Node) (events int) {
+	var path []*undo.Node
+	for ; n != nil; n = n.Parent {
+		if n.Parent == nil || j.snapshots[n.ID] {
+			break
+		}
+		if n.ID < len(j.dist) && j.dist[n.ID] > 0 {
+			events = j.dist[n.ID]
+			break
+		}
+		path = append(path, n)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		events += len(path[i].Events)
+		for len(j.dist) <= path[i].ID {
+			j.dist = append(j.dist, 0)
+		}
+		j.dist[path[i].ID] = events
+	}
+	return
+}
+
+// Snapshot returns a snapshot record of the document at the current node of the tree
+func Snapshot(t *undo.Tree) Record {
+	return Record{Kind: SnapshotRecord, Node: t.Current().ID, Text: t.Doc().Text(), Notes: t.Doc().Notes()}
+}
+
+// Restore rebuilds a history from the records of a journal, onto a tree that has nothing but its root. The nodes are
+// added without replaying their events, and the document is brought to the node it was at when the last record was
+// written from the nearest snapshot above that node, so only the events after the snapshot are replayed.
+func Restore(t *undo.Tree, records []Record) (e error) {
+	snapshots := make(map[int]int)
+	current := t.Current().ID
+	for i, r := range records {
+		if r.Kind != NodeRecord && (r.Node < 0 || r.Node >= t.Len()) {
+			return fmt.Errorf("record %d: %w", i, undo.ErrNoNode)
+		}
+		switch r.Kind {
+		case NodeRecord:
+			if r.Node != t.Len() {
+				return fmt.Errorf("record %d: node %d is out of order, expected %d", i, r.Node, t.Len())
+			}
+			if _, e = t.Graft(r.Parent, r.Events, r.Time); e != nil {
+				return fmt.Errorf("record %d: %w", i, e)
+			}
+			current = r.Node
+		case SwitchRecord:
+			current = r.Node
+		case NameRecord:
+			if e = t.Name(r.Node, r.Name); e != nil {
+				return fmt.Errorf("record %d: %w", i, e)
+			}
+		case SnapshotRecord:
+			snapshots[r.Node] = i
+		}
+	}
+	n, _ := t.Node(current)
+	for ; n.Parent != nil; n = n.Parent {
+		if _, ok := snapshots[n.ID]; ok {
+			break
+		}
+	}
+	if i, ok := snapshots[n.ID]; ok && n.Parent != nil {
+		if e = load(t.Doc(), records[i]); e != nil {
+			return fmt.Errorf("record %d: %w", i, e)
+		}
+		if e = t.Reset(n.ID); e != nil {
+			return
+		}
+	}
+	return t.Switch(current)
+}
+
+// load brings an empty document to the state of a snapshot
+func load(d *doc.Document, r Record) (e error) {
+	if r.Text != "" {
+		if e = d.Insert(0, r.Text); e != nil {
+			return
+		}
+	}
+	for _, n := range r.Notes {
+		if e = d.Annotate(n.ID, n.Offset, n.Length, n.Text); e != nil {
+			return
+		}
+	}
+	return
+}
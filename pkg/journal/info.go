@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+var kindNames = map[Kind]string{
+	NodeRecord:     "node",
+	SwitchRecord:   "switch",
+	NameRecord:     "name",
+	SnapshotRecord: "snapshot",
+	FileRecord:     "file",
+	DiskRecord:     "disk",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Info describes a journal and the history stored in it
+type Info struct {
+	Path string
+	// File is the source file the journal is for, if it names one
+	File string
+	Size int64
+	// Records counts the records of each kind
+	Records map[Kind]int
+	// Nodes, Branches and Events count the nodes of the history, the tips of its branches and the events of all nodes
+	Nodes, Branches, Events int
+	Bookmarks               []string
+	// Current is the node the document was last at and Depth the number of nodes above it
+	Current, Depth int
+	// First and Last are the times of the oldest and newest node after the root
+	First, Last time.Time
+	// Length is the number of runes in the document at the current node
+	Length int
+}
+
+// Inspect reads the journal at the path and describes it. Like Open it cuts off a torn record at the end.
+func Inspect(path string) (in Info, e error) {
+	var j *Journal
+	var records []Record
+	if j, records, e = Open(path); e != nil {
+		return
+	}
+	in.Path, in.Size = path, j.Size()
+	if e = j.Close(); E.Chk(e) {
+		return
+	}
+	in.File = File(records)
+	in.Records = make(map[Kind]int)
+	for _, r := range records {
+		in.Records[r.Kind]++
+	}
+	t := undo.New(doc.New())
+	if e = Restore(t, records); e != nil {
+		return
+	}
+	in.Nodes, in.Branches = t.Len(), len(t.Branches())
+	for _, n := range t.Nodes() {
+		in.Events += len(n.Events)
+		if n.Parent == nil {
+			continue
+		}
+		if in.First.IsZero() || n.Time.Before(in.First) {
+			in.First = n.Time
+		}
+		if n.Time.After(in.Last) {
+			in.Last = n.Time
+		}
+	}
+	for _, n := range t.Bookmarks() {
+		in.Bookmarks = append(in.Bookmarks, n.Name)
+	}
+	in.Current, in.Depth = t.Current().ID, t.Current().Depth
+	in.Length = t.Doc().Len()
+	return
+}
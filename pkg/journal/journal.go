@@ -0,0 +1,294 @@
+// Package journal stores the history of a document on disk as it is made. A journal is an append-only file of
+// records, each of which is a change to the undo tree of the document: a new node with its events, a switch to
+// another node, or a name given to a node. Replaying the records rebuilds the tree and brings the document to the
+// node it was last at.
+//
+// The file starts with a magic string and the version of the format. Every record after it is the length of its
+// payload as a varint, the payload, and a CRC-32C checksum of the payload. A record that was only partly written when
+// the editor stopped fails its checksum, and it and anything after it are cut off when the journal is opened again.
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/p9c/glom/pkg/appdata"
+)
+
+// Version is the version of the journal format written by this package
+const Version = 1
+
+// Magic starts every journal file
+const Magic = "glomjrnl"
+
+// MaxRecord is the largest payload a record may have
+const MaxRecord = 1 << 30
+
+// DefaultSnapshotEvery is the number of events between snapshots of the document
+const DefaultSnapshotEvery = 4096
+
+var (
+	// ErrFormat is returned for files that are not journals
+	ErrFormat = errors.New("not a glom journal")
+	// ErrVersion is returned for journals written by a newer version of the format
+	ErrVersion = errors.New("journal version is not supported")
+)
+
+var table = crc32.MakeTable(crc32.Castagnoli)
+
+// Journal is an open journal file records are appended to
+type Journal struct {
+	f    *os.File
+	path string
+	// size is the length of the valid part of the file
+	size int64
+	// sync makes every append wait until the record is on the disk
+	sync bool
+	// every is the number of events after which a snapshot is written, and snapshots are the nodes that have one
+	every     int
+	snapshots map[int]bool
+	// dist is the number of events from each node up to the nearest snapshot, where it is known
+	dist []int
+}
+
+// DirName is the name of the directory in the data directory of glom that journals are stored in
+const DirName = "journals"
+
+// Dir returns the directory the journals of files are stored in
+func Dir() string {
+	return filepath.Join(appdata.Dir("glom", false), DirName)
+}
+
+// Path returns the path of the journal of a file in a directory, named after the absolute path of the file
+func Path(dir, file string) string {
+	if abs, e := filepath.Abs(file); !E.Chk(e) {
+		file = abs
+	}
+	sum := sha256.Sum256([]byte(file))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".journal")
+}
+
+// Open opens the journal at the path, creating it if it does not exist, and returns the records in it. A record torn
+// by the end of the file is truncated from it, so that appending continues after the last good record. A corrupt
+// record before the end is cut off with everything after it too, but only once the whole file has been copied aside
+// beside the journal, so that the records after it are not lost.
+func Open(path string) (j *Journal, records []Record, e error) {
+	if e = os.MkdirAll(filepath.Dir(path), 0700); E.Chk(e) {
+		return
+	}
+	var f *os.File
+	if f, e = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600); E.Chk(e) {
+		return
+	}
+	j = &Journal{f: f, path: path, sync: true, every: DefaultSnapshotEvery, snapshots: make(map[int]bool)}
+	defer func() {
+		if e != nil {
+			_ = f.Close()
+			j, records = nil, nil
+		}
+	}()
+	var info os.FileInfo
+	if info, e = f.Stat(); E.Chk(e) {
+		return
+	}
+	if info.Size() == 0 {
+		e = j.header()
+		return
+	}
+	var corrupt bool
+	if records, corrupt, e = j.read(info.Size()); e != nil {
+		return
+	}
+	if corrupt {
+		aside := fmt.Sprintf("%s.%d.corrupt", path, time.Now().UnixNano())
+		W.Ln("journal", path, "is corrupt at byte", j.size, "copying it to", aside)
+		if e = copyFile(path, aside); E.Chk(e) {
+			return
+		}
+	}
+	if j.size < info.Size() {
+		W.Ln("truncating journal", path, "from", info.Size(), "to", j.size, "bytes")
+		if e = f.Truncate(j.size); E.Chk(e) {
+			return
+		}
+		if e = f.Sync(); E.Chk(e) {
+			return
+		}
+	}
+	_, e = f.Seek(j.size, io.SeekStart)
+	return
+}
+
+// header writes the start of a new journal
+func (j *Journal) header() (e error) {
+	en := &encoder{buf: []byte(Magic)}
+	en.uint(Version)
+	if _, e = j.f.Write(en.buf); E.Chk(e) {
+		return
+	}
+	j.size = int64(len(en.buf))
+	return j.f.Sync()
+}
+
+// read decodes the records of the file of a size up to the first one that is incomplete or does not match its
+// checksum. It is corrupt if that record ends before the end of the file, rather than being torn by it.
+func (j *Journal) read(size int64) (records []Record, corrupt bool, e error) {
+	r := bufio.NewReader(j.f)
+	magic := make([]byte, len(Magic))
+	if _, e = io.ReadFull(r, magic); e != nil || string(magic) != Magic {
+		return nil, false, ErrFormat
+	}
+	var version uint64
+	if version, e = binary.ReadUvarint(r); e != nil {
+		return nil, false, ErrFormat
+	}
+	if version > Version {
+		return nil, false, fmt.Errorf("%w: %d", ErrVersion, version)
+	}
+	j.size = int64(len(Magic) + uvarintLen(version))
+	for {
+		var n uint64
+		if n, e = binary.ReadUvarint(r); e != nil {
+			// a length cut short by the end of the file is torn, one that runs on for too many bytes is not
+			corrupt = e != io.EOF && e != io.ErrUnexpectedEOF
+			break
+		}
+		if n > MaxRecord {
+			corrupt = true
+			break
+		}
+		// the length is checked against what is left of the file before anything is allocated for it, a record
+		// that runs past the end was torn
+		end := j.size + int64(uvarintLen(n)) + int64(n) + 4
+		if end > size {
+			break
+		}
+		payload := make([]byte, n+4)
+		if _, e = io.ReadFull(r, payload); e != nil {
+			break
+		}
+		sum := binary.LittleEndian.Uint32(payload[n:])
+		if crc32.Checksum(payload[:n], table) != sum {
+			corrupt = end < size
+			break
+		}
+		var rec Record
+		if rec, e = Decode(payload[:n]); e != nil {
+			// a record that was written whole but cannot be read is not a torn tail, it must not be cut off
+			return nil, false, fmt.Errorf("record at byte %d: %w", j.size, e)
+		}
+		records = append(records, rec)
+		if rec.Kind == SnapshotRecord {
+			j.snapshots[rec.Node] = true
+		}
+		j.size = end
+	}
+	return records, corrupt, nil
+}
+
+// copyFile copies a file to a new file at another path
+func copyFile(from, to string) (e error) {
+	var b []byte
+	if b, e = ioutil.ReadFile(from); e != nil {
+		return
+	}
+	return ioutil.WriteFile(to, b, 0600)
+}
+
+// File returns the name of the source file given by the records of a journal
+func File(records []Record) string {
+	for _, r := range records {
+		if r.Kind == FileRecord {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// Disk returns the hash of the source file the last disk record of a journal holds, or "" if it has none
+func Disk(records []Record) (sum string) {
+	for _, r := range records {
+		if r.Kind == DiskRecord {
+			sum = r.Name
+		}
+	}
+	return
+}
+
+// Sum returns the hash of the content of a source file that disk records hold
+func Sum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func uvarintLen(x uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], x)
+}
+
+// Sync sets whether every append waits for the record to reach the disk, which is the default
+func (j *Journal) Sync(sync bool) *Journal {
+	j.sync = sync
+	return j
+}
+
+// SnapshotEvery sets the number of events after which a snapshot of the document is written, zero turns snapshots
+// off
+func (j *Journal) SnapshotEvery(n int) *Journal {
+	j.every = n
+	return j
+}
+
+// Path returns the path of the journal file
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Size returns the length of the journal file in bytes
+func (j *Journal) Size() int64 {
+	return j.size
+}
+
+// Append writes a record to the end of the journal
+func (j *Journal) Append(r Record) (e error) {
+	payload := Encode(r)
+	en := &encoder{buf: make([]byte, 0, len(payload)+binary.MaxVarintLen64+4)}
+	en.uint(uint64(len(payload)))
+	en.buf = append(en.buf, payload...)
+	en.buf = append(en.buf, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(en.buf[len(en.buf)-4:], crc32.Checksum(payload, table))
+	if _, e = j.f.Write(en.buf); E.Chk(e) {
+		// a partly written record is removed so that the next one does not land behind it
+		if te := j.f.Truncate(j.size); !E.Chk(te) {
+			_, _ = j.f.Seek(j.size, io.SeekStart)
+		}
+		return
+	}
+	j.size += int64(len(en.buf))
+	if r.Kind == SnapshotRecord {
+		j.snapshots[r.Node] = true
+	}
+	if j.sync {
+		e = j.f.Sync()
+	}
+	return
+}
+
+// Close flushes the journal to the disk and closes it
+func (j *Journal) Close() (e error) {
+	if e = j.f.Sync(); E.Chk(e) {
+		_ = j.f.Close()
+		return
+	}
+	return j.f.Close()
+}
@@ -0,0 +1,250 @@
+package journal_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+func tempDir(t *testing.T) (dir string, done func()) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestEncoding(t *testing.T) {
+	tm := time.Unix(1600000000, 123456789)
+	for _, r := range []journal.Record{
+		{
+			Kind: journal.NodeRecord, Node: 3, Parent: 1, Time: tm, Events: []doc.Event{
+				{Kind: doc.Insert, Offset: 5, Text: "héllo", Author: "a", Time: tm.Add(-time.Millisecond)},
+				{Kind: doc.Move, Offset: 300, Old: "x,", To: 1 << 20, Text: ", x", Time: tm},
+				{Kind: doc.Annotate, Note: "n1", Offset: 2, Length: 7, Text: "note"},
+			},
+		},
+		{Kind: journal.SwitchRecord, Node: 1},
+		{Kind: journal.NameRecord, Node: 2, Name: "release"},
+		{Kind: journal.FileRecord, Name: "/src/main.go"},
+		{Kind: journal.DiskRecord, Name: journal.Sum([]byte("package main\n"))},
+	} {
+		got, e := journal.Decode(journal.Encode(r))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if got.Events == nil {
+			got.Events = r.Events
+		}
+		if !reflect.DeepEqual(got, r) {
+			t.Errorf("decoded %+v\nwant %+v", got, r)
+		}
+	}
+	b := journal.Encode(journal.Record{Kind: journal.NameRecord, Node: 1, Name: "abc"})
+	if _, e := journal.Decode(b[:len(b)-1]); e == nil {
+		t.Error("a short record decoded")
+	}
+}
+
+// edit makes a history with two branches and a name in a tree attached to a new journal
+func edit(t *testing.T, path string) (h *undo.Tree) {
+	j, records, e := journal.Open(path)
+	if e != nil || len(records) != 0 {
+		t.Fatal(records, e)
+	}
+	h = undo.New(doc.New())
+	journal.Attach(j, h)
+	for _, txt := range []string{"one", " two", " three"} {
+		if _, e = h.Edit(func(d *doc.Document) error { return d.Insert(d.Len(), txt) }); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e = h.Name(2, "two"); e != nil {
+		t.Fatal(e)
+	}
+	if e = h.Undo(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = h.Edit(func(d *doc.Document) error { return d.Insert(0, "zero ") }); e != nil {
+		t.Fatal(e)
+	}
+	if e = j.Close(); e != nil {
+		t.Fatal(e)
+	}
+	return
+}
+
+// restore rebuilds a history from the journal at the path
+func restore(t *testing.T, path string) (h *undo.Tree, records []journal.Record) {
+	j, records, e := journal.Open(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer j.Close()
+	h = undo.New(doc.New())
+	if e = journal.Restore(h, records); e != nil {
+		t.Fatal(e)
+	}
+	return
+}
+
+func TestRestore(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := journal.Path(dir, "main.go")
+	want := edit(t, path)
+	h, _ := restore(t, path)
+	if h.Doc().Text() != want.Doc().Text() || h.Len() != want.Len() || h.Current().ID != want.Current().ID {
+		t.Fatalf("restored %q at node %d of %d, want %q at %d of %d", h.Doc().Text(), h.Current().ID, h.Len(),
+			want.Doc().Text(), want.Current().ID, want.Len())
+	}
+	if n, ok := h.Lookup("two"); !ok || n.ID != 2 {
+		t.Error("the name was not restored")
+	}
+	if s, e := h.Text(3); e != nil || s != "one two three" {
+		t.Errorf("the abandoned branch is %q, %v", s, e)
+	}
+	if !h.Nodes()[1].Time.Equal(want.Nodes()[1].Time) {
+		t.Errorf("node time %v, want %v", h.Nodes()[1].Time, want.Nodes()[1].Time)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := journal.Path(dir, "main.go")
+	edit(t, path)
+	in, e := journal.Inspect(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if in.Nodes != 5 || in.Branches != 2 || in.Events != 4 || in.Current != 4 || in.Depth != 3 || in.Length != 12 {
+		t.Errorf("inspected %+v", in)
+	}
+	if in.Records[journal.NodeRecord] != 4 || in.Records[journal.NameRecord] != 1 || in.Records[journal.SwitchRecord] != 1 {
+		t.Errorf("records %v", in.Records)
+	}
+	if len(in.Bookmarks) != 1 || in.Bookmarks[0] != "two" || in.First.After(in.Last) {
+		t.Errorf("bookmarks %v, edited %v to %v", in.Bookmarks, in.First, in.Last)
+	}
+}
+
+func TestTornTail(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "torn.journal")
+	edit(t, path)
+	info, e := os.Stat(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, all := restore(t, path)
+	// the last record is cut short as if the editor stopped while writing it
+	if e = os.Truncate(path, info.Size()-3); e != nil {
+		t.Fatal(e)
+	}
+	h, records := restore(t, path)
+	if len(records) != len(all)-1 || h.Doc().Text() != "one two" {
+		t.Fatalf("restored %d of %d records to %q", len(records), len(all), h.Doc().Text())
+	}
+	// the torn record is gone from the file and the next record follows the last good one
+	j, _, e := journal.Open(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e = j.Append(journal.Record{Kind: journal.NameRecord, Node: 1, Name: "one"}); e != nil {
+		t.Fatal(e)
+	}
+	j.Close()
+	if h, records = restore(t, path); len(records) != len(all) {
+		t.Fatalf("%d records after appending to a repaired journal", len(records))
+	}
+	if _, ok := h.Lookup("one"); !ok {
+		t.Error("the record appended after the repair is missing")
+	}
+}
+
+func TestCorruption(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "corrupt.journal")
+	edit(t, path)
+	b, e := ioutil.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	// a flipped bit in the last record fails its checksum
+	b[len(b)-6] ^= 1
+	if e = ioutil.WriteFile(path, b, 0600); e != nil {
+		t.Fatal(e)
+	}
+	if h, records := restore(t, path); h.Doc().Text() != "one two" || len(records) == 0 {
+		t.Errorf("restored %q from %d records", h.Doc().Text(), len(records))
+	}
+	// a flipped bit in a record before the last loses the records after it only once the journal was copied aside
+	b, all := corrupted(t, path, func(b []byte, records int64) { b[records+2] ^= 1 })
+	if h, records := restore(t, path); h.Doc().Text() != "" || len(records) != 0 {
+		t.Errorf("restored %q from %d records", h.Doc().Text(), len(records))
+	}
+	asides, _ := filepath.Glob(path + ".*.corrupt")
+	if len(asides) != 1 {
+		t.Fatalf("copies aside are %v", asides)
+	}
+	if aside, _ := ioutil.ReadFile(asides[0]); string(aside) != string(b) {
+		t.Errorf("the copy aside of the journal of %d records has %d bytes of %d", len(all), len(aside), len(b))
+	}
+	// a length longer than the rest of the file is torn, and one longer than any record is corrupt
+	for _, length := range []uint64{1 << 20, journal.MaxRecord + 1} {
+		b, _ = corrupted(t, path, func(b []byte, records int64) {})
+		var tail [binary.MaxVarintLen64]byte
+		b = append(b, tail[:binary.PutUvarint(tail[:], length)]...)
+		if e = ioutil.WriteFile(path, append(b, 1, 2, 3), 0600); e != nil {
+			t.Fatal(e)
+		}
+		if _, records := restore(t, path); len(records) == 0 {
+			t.Errorf("a length of %d lost the records before it", length)
+		}
+	}
+	if asides, _ = filepath.Glob(path + ".*.corrupt"); len(asides) != 2 {
+		t.Errorf("copies aside are %v", asides)
+	}
+	if e = ioutil.WriteFile(path, []byte("package main\n"), 0600); e != nil {
+		t.Fatal(e)
+	}
+	if _, _, e = journal.Open(path); e != journal.ErrFormat {
+		t.Errorf("opening a file that is not a journal gave %v", e)
+	}
+	if e = ioutil.WriteFile(path, []byte(journal.Magic+"\x09"), 0600); e != nil {
+		t.Fatal(e)
+	}
+	if _, _, e = journal.Open(path); !errors.Is(e, journal.ErrVersion) {
+		t.Errorf("opening a newer journal gave %v", e)
+	}
+}
+
+// corrupted makes a new journal at a path and changes its bytes, given the offset its records start at, returning the
+// changed bytes and the records it had before
+func corrupted(t *testing.T, path string, change func(b []byte, records int64)) (b []byte, all []journal.Record) {
+	t.Helper()
+	_ = os.Remove(path)
+	edit(t, path)
+	_, all = restore(t, path)
+	b, e := ioutil.ReadFile(path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	change(b, int64(len(journal.Magic)+1))
+	if e = ioutil.WriteFile(path, b, 0600); e != nil {
+		t.Fatal(e)
+	}
+	return
+}
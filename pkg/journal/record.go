@@ -0,0 +1,241 @@
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/p9c/glom/pkg/doc"
+)
+
+// ErrRecord is returned for a record that does not decode
+var ErrRecord = errors.New("malformed journal record")
+
+// Kind is the type of a journal record
+type Kind uint8
+
+const (
+	// NodeRecord adds the node Node as a child of Parent holding Events, and makes it current
+	NodeRecord Kind = iota + 1
+	// SwitchRecord moves the document to the node Node
+	SwitchRecord
+	// NameRecord sets the name of the node Node to Name
+	NameRecord
+	// SnapshotRecord holds the Text and Notes of the document at the node Node, so that restoring the document does
+	// not have to replay the events before it
+	SnapshotRecord
+	// FileRecord names the source file the journal is the history of in Name
+	FileRecord
+	// DiskRecord holds in Name the hash of the text of the source file when it was last read or written by glom, so
+	// that a file changed outside of glom can be told from one that was not
+	DiskRecord
+)
+
+// Record is a change to the history of a document
+type Record struct {
+	Kind   Kind
+	Node   int
+	Parent int
+	Time   time.Time
+	Events []doc.Event
+	Name   string
+	Text   string
+	Notes  []doc.Note
+}
+
+// encoder appends values to a buffer in the journal encoding. Integers are varints and strings are prefixed with
+// their length in bytes.
+type encoder struct {
+	buf []byte
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (en *encoder) byte(b byte) {
+	en.buf = append(en.buf, b)
+}
+
+func (en *encoder) uint(x uint64) {
+	en.buf = append(en.buf, en.tmp[:binary.PutUvarint(en.tmp[:], x)]...)
+}
+
+func (en *encoder) int(x int64) {
+	en.buf = append(en.buf, en.tmp[:binary.PutVarint(en.tmp[:], x)]...)
+}
+
+func (en *encoder) str(s string) {
+	en.uint(uint64(len(s)))
+	en.buf = append(en.buf, s...)
+}
+
+// stamp encodes a time as nanoseconds relative to a base, with the zero time kept apart from every real time
+func (en *encoder) stamp(t, base time.Time) {
+	if t.IsZero() {
+		en.byte(0)
+		return
+	}
+	en.byte(1)
+	en.int(t.Sub(base).Nanoseconds())
+}
+
+// decoder reads values encoded by an encoder, remembering the first error
+type decoder struct {
+	buf []byte
+	e   error
+}
+
+func (de *decoder) fail() {
+	if de.e == nil {
+		de.e = ErrRecord
+	}
+	de.buf = nil
+}
+
+func (de *decoder) byte() (b byte) {
+	if len(de.buf) == 0 {
+		de.fail()
+		return
+	}
+	b, de.buf = de.buf[0], de.buf[1:]
+	return
+}
+
+func (de *decoder) uint() uint64 {
+	x, n := binary.Uvarint(de.buf)
+	if n <= 0 {
+		de.fail()
+		return 0
+	}
+	de.buf = de.buf[n:]
+	return x
+}
+
+func (de *decoder) int() int64 {
+	x, n := binary.Varint(de.buf)
+	if n <= 0 {
+		de.fail()
+		return 0
+	}
+	de.buf = de.buf[n:]
+	return x
+}
+
+func (de *decoder) str() (s string) {
+	n := de.uint()
+	if n > uint64(len(de.buf)) {
+		de.fail()
+		return
+	}
+	s, de.buf = string(de.buf[:n]), de.buf[n:]
+	return
+}
+
+func (de *decoder) stamp(base time.Time) time.Time {
+	if de.byte() == 0 {
+		return time.Time{}
+	}
+	return base.Add(time.Duration(de.int()))
+}
+
+// epoch is the base of the times of nodes
+var epoch = time.Unix(0, 0)
+
+// base returns the time the times of the events of a node are relative to
+func base(t time.Time) time.Time {
+	if t.IsZero() {
+		return epoch
+	}
+	return t
+}
+
+// Encode returns the payload of a record. The times of the events of a node are stored relative to the time of the
+// node, which keeps them short.
+func Encode(r Record) []byte {
+	en := &encoder{}
+	en.byte(byte(r.Kind))
+	en.uint(uint64(r.Node))
+	switch r.Kind {
+	case NodeRecord:
+		en.uint(uint64(r.Parent))
+		en.stamp(r.Time, epoch)
+		base := base(r.Time)
+		en.uint(uint64(len(r.Events)))
+		for _, ev := range r.Events {
+			en.byte(byte(ev.Kind))
+			en.uint(uint64(ev.Offset))
+			en.uint(uint64(ev.Length))
+			en.uint(uint64(ev.To))
+			en.str(ev.Text)
+			en.str(ev.Old)
+			en.str(ev.Note)
+			en.str(ev.Author)
+			en.stamp(ev.Time, base)
+		}
+	case NameRecord, FileRecord, DiskRecord:
+		en.str(r.Name)
+	case SnapshotRecord:
+		en.str(r.Text)
+		en.uint(uint64(len(r.Notes)))
+		for _, n := range r.Notes {
+			en.str(n.ID)
+			en.uint(uint64(n.Offset))
+			en.uint(uint64(n.Length))
+			en.str(n.Text)
+		}
+	}
+	return en.buf
+}
+
+// Decode reads a record from its payload
+func Decode(b []byte) (r Record, e error) {
+	de := &decoder{buf: b}
+	r.Kind = Kind(de.byte())
+	r.Node = int(de.uint())
+	switch r.Kind {
+	case NodeRecord:
+		r.Parent = int(de.uint())
+		r.Time = de.stamp(epoch)
+		base := base(r.Time)
+		n := de.uint()
+		if n > uint64(len(de.buf)) {
+			// every event takes more than a byte, so a count beyond the rest of the payload is corrupt
+			de.fail()
+		}
+		r.Events = make([]doc.Event, 0, n)
+		for i := uint64(0); i < n && de.e == nil; i++ {
+			var ev doc.Event
+			ev.Kind = doc.Kind(de.byte())
+			ev.Offset = int(de.uint())
+			ev.Length = int(de.uint())
+			ev.To = int(de.uint())
+			ev.Text = de.str()
+			ev.Old = de.str()
+			ev.Note = de.str()
+			ev.Author = de.str()
+			ev.Time = de.stamp(base)
+			r.Events = append(r.Events, ev)
+		}
+	case SwitchRecord:
+	case NameRecord, FileRecord, DiskRecord:
+		r.Name = de.str()
+	case SnapshotRecord:
+		r.Text = de.str()
+		n := de.uint()
+		if n > uint64(len(de.buf)) {
+			de.fail()
+		}
+		for i := uint64(0); i < n && de.e == nil; i++ {
+			var nt doc.Note
+			nt.ID = de.str()
+			nt.Offset = int(de.uint())
+			nt.Length = int(de.uint())
+			nt.Text = de.str()
+			r.Notes = append(r.Notes, nt)
+		}
+	default:
+		de.fail()
+	}
+	if de.e == nil && len(de.buf) > 0 {
+		de.fail()
+	}
+	return r, de.e
+}
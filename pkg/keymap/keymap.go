@@ -0,0 +1,299 @@
+// Package keymap binds keys to the actions of the editor. A keymap has one or more modes, each with its own bindings,
+// and a binding can be a sequence of keys pressed one after another, like the chords of Emacs or the operators and
+// text objects of Vim. Keymaps start from one of the presets and the settings add to them.
+package keymap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gioui.org/io/event"
+	"gioui.org/io/key"
+
+	"github.com/p9c/glom/pkg/input"
+	"github.com/p9c/glom/pkg/settings"
+)
+
+// ModeAction is the prefix of the actions that switch a keymap to the mode named after it
+const ModeAction = "mode-"
+
+// SelectAction is the prefix that turns an action moving the cursors into one extending the selection
+const SelectAction = "select-"
+
+// Runner runs the actions of the editor and takes the text typed into it, which an input.Editor does
+type Runner interface {
+	Do(action string, extend bool) error
+	Type(txt string) error
+}
+
+// Mode is a set of bindings that are used together
+type Mode struct {
+	Name string
+	// Insert is set for modes in which typed text goes into the document, in other modes keys only run actions
+	Insert bool
+	// Extend is set for modes in which motions extend the selection
+	Extend bool
+	// Counts is set for modes in which a number typed before a binding repeats it
+	Counts bool
+	// Leave is the mode typing text switches to
+	Leave string
+	root  *node
+}
+
+// node is a key of a binding, with the action of the binding if it is the last key of one
+type node struct {
+	action string
+	next   map[settings.Key]*node
+}
+
+// bind adds a binding to the mode. Bindings of a key sequence that starts another one or is started by another give
+// way to the new binding, and an empty action removes the binding of the keys.
+func (m *Mode) bind(keys []settings.Key, action string) {
+	n := m.root
+	for _, k := range keys {
+		n.action = ""
+		if n.next == nil {
+			n.next = make(map[settings.Key]*node)
+		}
+		if n.next[k] == nil {
+			n.next[k] = &node{}
+		}
+		n = n.next[k]
+	}
+	n.action, n.next = action, nil
+}
+
+// Keymap is the modes of the editor and the state of the keys pressed so far
+type Keymap struct {
+	modes map[string]*Mode
+	mode  *Mode
+	// pending is the keys of a binding pressed so far and the node they reach
+	pending []settings.Key
+	at      *node
+	count   int
+	// swallow drops the text of a key that was taken by a binding
+	swallow bool
+}
+
+// New builds the keymap of the settings from its preset, adding the bindings of the settings to it. Bindings that
+// cannot be used are left out and described by the error, the keymap is complete otherwise.
+func New(st settings.Settings) (k *Keymap, e error) {
+	var problems []string
+	p, ok := presets[st.Keymap]
+	if !ok {
+		problems = append(problems, fmt.Sprintf("no keymap %q", st.Keymap))
+		p = presets["default"]
+	}
+	k = &Keymap{modes: make(map[string]*Mode)}
+	for _, spec := range p.modes {
+		k.modes[spec.name] = &Mode{
+			Name: spec.name, Insert: spec.insert, Extend: spec.extend, Counts: spec.counts, Leave: spec.leave,
+			root: &node{},
+		}
+	}
+	add := func(m *Mode, keys, action string) {
+		ks, e := settings.ParseKeys(keys)
+		if e == nil {
+			e = k.check(action)
+		}
+		if e != nil {
+			problems = append(problems, fmt.Sprintf("%s mode: %v", m.Name, e))
+			return
+		}
+		m.bind(ks, action)
+	}
+	for _, spec := range p.modes {
+		m := k.modes[spec.name]
+		if spec.base {
+			for _, keys := range sorted(editing) {
+				add(m, keys, editing[keys])
+			}
+		}
+		for _, keys := range sorted(spec.keys) {
+			add(m, keys, spec.keys[keys])
+		}
+		for _, action := range sorted(st.Keys) {
+			add(m, st.Keys[action], action)
+		}
+	}
+	var names []string
+	for name := range st.Modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m, ok := k.modes[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("no mode %q in the %s keymap", name, st.Keymap))
+			continue
+		}
+		for _, keys := range sorted(st.Modes[name]) {
+			add(m, keys, st.Modes[name][keys])
+		}
+	}
+	k.mode = k.modes[p.start]
+	if len(problems) > 0 {
+		e = errors.New(strings.Join(problems, "; "))
+	}
+	return
+}
+
+// check returns an error if an action of a binding does not exist
+func (k *Keymap) check(actions string) error {
+	for _, a := range strings.Fields(actions) {
+		if _, ok := k.modes[strings.TrimPrefix(a, ModeAction)]; ok && strings.HasPrefix(a, ModeAction) {
+			continue
+		}
+		if !input.Has(a) && !(strings.HasPrefix(a, SelectAction) && input.Has(strings.TrimPrefix(a, SelectAction))) {
+			return fmt.Errorf("%w %q", input.ErrAction, a)
+		}
+	}
+	return nil
+}
+
+// Mode returns the mode the keymap is in
+func (k *Keymap) Mode() *Mode {
+	return k.mode
+}
+
+// Modes returns the names of the modes of the keymap
+func (k *Keymap) Modes() (names []string) {
+	for name := range k.modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Pending returns the keys pressed so far of a binding of more than one key, and the count typed before it
+func (k *Keymap) Pending() (keys []settings.Key, count int) {
+	return append([]settings.Key{}, k.pending...), k.count
+}
+
+// Event handles an event of the editor, reporting whether it was input for it
+func (k *Keymap) Event(r Runner, ev event.Event) (ok bool, e error) {
+	switch ev := ev.(type) {
+	case key.Event:
+		return k.Key(r, ev)
+	case key.EditEvent:
+		return true, k.Type(r, ev.Text)
+	}
+	return
+}
+
+// Key runs the binding a key press completes, reporting whether the key was taken by the keymap. In a mode that takes
+// text a key held with shift that is only bound without it runs its action extending the selection.
+func (k *Keymap) Key(r Runner, ke key.Event) (ok bool, e error) {
+	if ke.State != key.Press {
+		return
+	}
+	k.swallow = false
+	m := k.mode
+	pressed := settings.Key{Name: ke.Name, Modifiers: ke.Modifiers}
+	if m.Counts && k.at == nil && ke.Modifiers == 0 && len(ke.Name) == 1 && ke.Name[0] >= '0' && ke.Name[0] <= '9' &&
+		(ke.Name != "0" || k.count > 0) {
+		k.count = k.count*10 + int(ke.Name[0]-'0')
+		k.swallow = typing(ke)
+		return true, nil
+	}
+	from := k.at
+	if from == nil {
+		from = m.root
+	}
+	n, extend := from.next[pressed], false
+	if n == nil && m.Insert && ke.Modifiers.Contain(key.ModShift) {
+		pressed.Modifiers &^= key.ModShift
+		n, extend = from.next[pressed], true
+	}
+	if n == nil || n.action == "" && len(n.next) == 0 {
+		if k.at != nil {
+			// a key that does not continue a binding starts again
+			k.reset()
+			return k.Key(r, ke)
+		}
+		k.reset()
+		return !m.Insert, nil
+	}
+	k.swallow = typing(ke)
+	if len(n.next) > 0 {
+		k.pending, k.at = append(k.pending, pressed), n
+		return true, nil
+	}
+	count := k.count
+	if count < 1 {
+		count = 1
+	}
+	k.reset()
+	return true, k.run(r, n.action, extend, count)
+}
+
+// typing reports whether a key press also types text, which comes in an event of its own after the key
+func typing(ke key.Event) bool {
+	if ke.Modifiers&^key.ModShift != 0 {
+		return false
+	}
+	switch ke.Name {
+	case key.NameSpace:
+		return true
+	case key.NameLeftArrow, key.NameRightArrow, key.NameUpArrow, key.NameDownArrow, key.NameReturn, key.NameEnter,
+		key.NameEscape, key.NameHome, key.NameEnd, key.NameDeleteBackward, key.NameDeleteForward, key.NamePageUp,
+		key.NamePageDown, key.NameTab:
+		return false
+	}
+	return utf8.RuneCountInString(ke.Name) == 1
+}
+
+func (k *Keymap) reset() {
+	k.pending, k.at, k.count = nil, nil, 0
+}
+
+// run runs the actions of a binding count times
+func (k *Keymap) run(r Runner, actions string, extend bool, count int) (e error) {
+	for i := 0; i < count; i++ {
+		for _, a := range strings.Fields(actions) {
+			switch {
+			case strings.HasPrefix(a, ModeAction) && k.modes[strings.TrimPrefix(a, ModeAction)] != nil:
+				k.mode = k.modes[strings.TrimPrefix(a, ModeAction)]
+			case input.Has(a):
+				e = r.Do(a, extend || k.mode.Extend)
+			default:
+				e = r.Do(strings.TrimPrefix(a, SelectAction), true)
+			}
+			if e != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Type puts text into the document in modes that take text, unless it is the text of a key a binding took
+func (k *Keymap) Type(r Runner, txt string) (e error) {
+	if k.swallow {
+		k.swallow = false
+		return
+	}
+	if !k.mode.Insert {
+		return
+	}
+	k.reset()
+	if e = r.Type(txt); e != nil {
+		return
+	}
+	if leave := k.modes[k.mode.Leave]; leave != nil {
+		k.mode = leave
+	}
+	return
+}
+
+// sorted returns the keys of a map in order, so that bindings are added in the same order every time
+func sorted(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,134 @@
+package keymap_test
+
+import (
+	"strings"
+	"testing"
+
+	"gioui.org/io/key"
+
+	"github.com/p9c/glom/pkg/input"
+	"github.com/p9c/glom/pkg/keymap"
+	"github.com/p9c/glom/pkg/settings"
+	"github.com/p9c/glom/pkg/workspace"
+)
+
+// editor feeds keys written like the bindings of the settings to an editor through a keymap
+type editor struct {
+	*input.Editor
+	keys *keymap.Keymap
+	t    *testing.T
+}
+
+func newEditor(t *testing.T, preset, txt string) *editor {
+	st := settings.Default()
+	st.Keymap = preset
+	keys, e := keymap.New(st)
+	if e != nil {
+		t.Fatal(e)
+	}
+	ed := &editor{Editor: input.NewEditor(workspace.NewBuffer()), keys: keys, t: t}
+	if e = ed.Type(txt); e != nil {
+		t.Fatal(e)
+	}
+	if e = ed.Do("doc-start", false); e != nil {
+		t.Fatal(e)
+	}
+	return ed
+}
+
+// press presses the keys one after another, sending the text a key types after it like a window does
+func (ed *editor) press(keys string) *editor {
+	ed.t.Helper()
+	ks, e := settings.ParseKeys(keys)
+	if e != nil {
+		ed.t.Fatal(e)
+	}
+	for _, k := range ks {
+		if _, e = ed.keys.Event(ed, key.Event{Name: k.Name, Modifiers: k.Modifiers, State: key.Press}); e != nil {
+			ed.t.Fatal(k, e)
+		}
+		if k.Modifiers&^key.ModShift != 0 || len(k.Name) != 1 {
+			continue
+		}
+		txt := strings.ToLower(k.Name)
+		if k.Modifiers.Contain(key.ModShift) {
+			txt = k.Name
+		}
+		if _, e = ed.keys.Event(ed, key.EditEvent{Text: txt}); e != nil {
+			ed.t.Fatal(k, e)
+		}
+	}
+	return ed
+}
+
+// expect checks the text, the mode and the primary range, which is given by its caret alone if it is empty
+func (ed *editor) expect(txt, mode string, at ...int) {
+	ed.t.Helper()
+	if got := ed.Doc.Text(); got != txt {
+		ed.t.Fatalf("text is %q, want %q", got, txt)
+	}
+	if got := ed.keys.Mode().Name; got != mode {
+		ed.t.Fatalf("mode is %s, want %s", got, mode)
+	}
+	r := ed.Selection.Primary()
+	if len(at) == 1 && (!r.Empty() || r.Caret != at[0]) || len(at) == 2 && (r.Anchor != at[0] || r.Caret != at[1]) {
+		ed.t.Fatalf("selection is %+v, want %v", r, at)
+	}
+}
+
+// TestVim checks the modes, operators, counts and segment text objects of the Vim keymap
+func TestVim(t *testing.T) {
+	ed := newEditor(t, "vim", "f(a, [b, c])\nsecond line\nthird")
+	ed.expect("f(a, [b, c])\nsecond line\nthird", "normal", 0)
+	ed.press("L L A X Escape").expect("f(ax, [b, c])\nsecond line\nthird", "normal", 3)
+	ed.press("X").expect("f(a, [b, c])\nsecond line\nthird", "normal", 3)
+	ed.press("3 L").expect("f(a, [b, c])\nsecond line\nthird", "normal", 6)
+	ed.press("C I S Z Escape").expect("f(a, [z])\nsecond line\nthird", "normal", 6)
+	ed.press("D A S").expect("f(a, )\nsecond line\nthird", "normal", 5)
+	ed.press("U").expect("f(a, [z])\nsecond line\nthird", "normal")
+	ed.press("J 0 D D").expect("f(a, [z])\nthird", "normal", 10)
+	ed.press("P").expect("f(a, [z])\nsecond line\nthird", "normal", 22)
+	ed.press("G G V L D").expect("(a, [z])\nsecond line\nthird", "normal", 0)
+	ed.press("Shift-V Y P").expect("(a, [z])\n(a, [z])\nsecond line\nthird", "normal", 9)
+	ed.press("Shift-G I ! Escape").expect("(a, [z])\n(a, [z])\nsecond line\nthird!", "normal", 35)
+	ed.press("Q D Q").expect("(a, [z])\n(a, [z])\nsecond line\nthird!", "normal", 35)
+}
+
+// TestEmacs checks the chords and the mark of the Emacs keymap
+func TestEmacs(t *testing.T) {
+	ed := newEditor(t, "emacs", "one two\nthree")
+	ed.press("Ctrl-E Ctrl-N").expect("one two\nthree", "emacs", 13)
+	ed.press("Ctrl-A Ctrl-K").expect("one two\n", "emacs", 8)
+	ed.press("Ctrl-Y").expect("one two\nthree", "emacs", 13)
+	ed.press("Ctrl-X U").expect("one two\n", "emacs", 8)
+	ed.press("Alt-Shift-< Ctrl-Space Alt-F").expect("one two\n", "mark", 0, 3)
+	ed.press("Ctrl-W").expect(" two\n", "emacs", 0)
+	ed.press("Ctrl-Space Ctrl-F Ctrl-F X").expect("xwo\n", "emacs", 1)
+	ed.press("Ctrl-X Ctrl-F Y").expect("xwyo\n", "emacs", 3)
+}
+
+// TestSettings checks that the bindings of the settings are added to the preset and that bad ones are left out
+func TestSettings(t *testing.T) {
+	st := settings.Default()
+	st.Keys["move-segment-down"] = "Ctrl-J Ctrl-J"
+	st.Keys["fly"] = "Ctrl-Q"
+	st.Modes = map[string]map[string]string{"edit": {"Ctrl-L": "line-end select-line-start"}, "normal": {"Q": "undo"}}
+	keys, e := keymap.New(st)
+	if e == nil || !strings.Contains(e.Error(), input.ErrAction.Error()) || !strings.Contains(e.Error(), "normal") {
+		t.Fatalf("bad bindings gave %v", e)
+	}
+	ed := &editor{Editor: input.NewEditor(workspace.NewBuffer()), keys: keys, t: t}
+	if e = ed.Type("package p\n\nvar x = f(a, b)"); e != nil {
+		t.Fatal(e)
+	}
+	ed.press("Ctrl-L").expect("package p\n\nvar x = f(a, b)", "edit", 26, 11)
+	ed.press("Right Left Left Left Left Left Ctrl-J Ctrl-J").expect("package p\n\nvar x = f(b, a)", "edit", 24)
+	ed.press("Alt-Up").expect("package p\n\nvar x = f(a, b)", "edit", 21)
+	if ks, _ := keys.Pending(); len(ks) != 0 {
+		t.Errorf("keys %v are still pending", ks)
+	}
+	ed.press("Ctrl-J")
+	if ks, _ := keys.Pending(); len(ks) != 1 {
+		t.Errorf("pending keys are %v", ks)
+	}
+}
@@ -0,0 +1,230 @@
+package keymap
+
+// preset is the modes of a keymap and the mode it starts in
+type preset struct {
+	start string
+	modes []modeSpec
+}
+
+// modeSpec is a mode of a preset with its bindings. Modes with base set start from the editing keys.
+type modeSpec struct {
+	name                   string
+	insert, extend, counts bool
+	leave                  string
+	base                   bool
+	keys                   map[string]string
+}
+
+// editing is the keys of the default keymap, which the modes of the other keymaps that take text start from
+var editing = map[string]string{
+	"Left":             "left",
+	"Right":            "right",
+	"Up":               "up",
+	"Down":             "down",
+	"Short-Left":       "word-left",
+	"Short-Right":      "word-right",
+	"Alt-Left":         "segment-left",
+	"Alt-Right":        "segment-right",
+	"Home":             "line-start",
+	"End":              "line-end",
+	"Short-Home":       "doc-start",
+	"Short-End":        "doc-end",
+	"PageUp":           "page-up",
+	"PageDown":         "page-down",
+	"Backspace":        "delete-left",
+	"Delete":           "delete-right",
+	"Short-Backspace":  "delete-word-left",
+	"Short-Delete":     "delete-word-right",
+	"Return":           "newline",
+	"Enter":            "newline",
+	"Tab":              "tab",
+	"Escape":           "collapse",
+	"Short-A":          "select-all",
+	"Short-D":          "select-next",
+	"Short-C":          "copy",
+	"Short-X":          "cut",
+	"Short-V":          "paste",
+	"Short-S":          "save",
+	"Short-Shift-V":    "paste-raw",
+	"Alt-V":            "paste-extended",
+	"Alt-Shift-V":      "paste-wrapped",
+	"Alt-Shift-Up":     "add-cursor-up",
+	"Alt-Shift-Down":   "add-cursor-down",
+	"Alt-Up":           "move-segment-up",
+	"Alt-Down":         "move-segment-down",
+	"Short-Shift-Up":   "expand-selection",
+	"Short-Shift-Down": "shrink-selection",
+	"Short-Alt-Right":  "next-segment",
+	"Short-Alt-Left":   "prev-segment",
+	"Short-Alt-Up":     "parent-segment",
+	"Short-Alt-Down":   "child-segment",
+	"Short-Shift-)":    "slurp-forward",
+	"Short-Shift-(":    "slurp-backward",
+	"Short-Shift-}":    "barf-forward",
+	"Short-Shift-{":    "barf-backward",
+	"Alt-S":            "splice",
+	"Alt-R":            "raise",
+	"Alt-Shift-(":      "wrap",
+	"Alt-Shift-S":      "split",
+}
+
+// motions is the keys that move the cursor in the normal and visual modes of Vim
+var motions = map[string]string{
+	"H":         "left",
+	"J":         "down",
+	"K":         "up",
+	"L":         "right",
+	"W":         "word-right",
+	"E":         "word-end",
+	"B":         "word-left",
+	"0":         "line-start",
+	"Shift-^":   "line-start",
+	"Shift-$":   "line-end",
+	"G G":       "doc-start",
+	"Shift-G":   "doc-end",
+	"Ctrl-D":    "page-down",
+	"Ctrl-U":    "page-up",
+	"Shift-(":   "segment-left",
+	"Shift-)":   "segment-right",
+	"Alt-K":     "move-segment-up",
+	"Alt-J":     "move-segment-down",
+	"Space":     "right",
+	"Return":    "down",
+	"Backspace": "left",
+	// keys that put text in the document do nothing
+	"Tab": "",
+}
+
+// with returns the bindings of a map with the bindings of another added
+func with(base, more map[string]string) map[string]string {
+	out := make(map[string]string, len(base)+len(more))
+	for k, a := range base {
+		out[k] = a
+	}
+	for k, a := range more {
+		out[k] = a
+	}
+	return out
+}
+
+var presets = map[string]preset{
+	"default": {
+		start: "edit",
+		modes: []modeSpec{{name: "edit", insert: true, base: true}},
+	},
+	// vim has the normal, insert and visual modes of Vim, with segments as the text objects "is" and "as"
+	"vim": {
+		start: "normal",
+		modes: []modeSpec{
+			{
+				name: "normal", counts: true, base: true,
+				keys: with(
+					motions, map[string]string{
+						"I":       "mode-insert",
+						"A":       "right mode-insert",
+						"Shift-I": "line-start mode-insert",
+						"Shift-A": "line-end mode-insert",
+						"O":       "line-end newline mode-insert",
+						"Shift-O": "line-start newline up mode-insert",
+						"X":       "delete-right",
+						"Shift-X": "delete-left",
+						"D D":     "select-line cut",
+						"D W":     "select-word-right cut",
+						"D I S":   "select-inner-segment cut",
+						"D A S":   "select-segment cut",
+						"C W":     "select-word-right cut mode-insert",
+						"C I S":   "select-inner-segment cut mode-insert",
+						"C A S":   "select-segment cut mode-insert",
+						"Y Y":     "select-line copy left",
+						"Y I S":   "select-inner-segment copy left",
+						"Y A S":   "select-segment copy left",
+						"P":       "paste",
+						"U":       "undo",
+						"Ctrl-R":  "redo",
+						"V":       "mode-visual",
+						"Shift-V": "select-line mode-visual",
+						"Escape":  "collapse",
+					},
+				),
+			},
+			{
+				name: "insert", insert: true, base: true,
+				keys: map[string]string{
+					"Escape": "left mode-normal",
+					"Ctrl-W": "delete-word-left",
+				},
+			},
+			{
+				name: "visual", extend: true, counts: true, base: true,
+				keys: with(
+					motions, map[string]string{
+						"I S":     "select-inner-segment",
+						"A S":     "select-segment",
+						"Shift-V": "select-line",
+						"D":       "cut mode-normal",
+						"X":       "cut mode-normal",
+						"C":       "cut mode-insert",
+						"Y":       "copy mode-normal left",
+						"P":       "paste mode-normal",
+						"V":       "collapse mode-normal",
+						"Escape":  "collapse mode-normal",
+					},
+				),
+			},
+		},
+	},
+	// emacs has the keys of Emacs, with setting the mark as a mode in which the motions extend the selection
+	"emacs": {
+		start: "emacs",
+		modes: []modeSpec{
+			{name: "emacs", insert: true, base: true, keys: emacs},
+			{
+				name: "mark", insert: true, extend: true, leave: "emacs", base: true,
+				keys: with(
+					emacs, map[string]string{
+						"Ctrl-G":     "collapse mode-emacs",
+						"Ctrl-W":     "cut mode-emacs",
+						"Alt-W":      "copy collapse mode-emacs",
+						"Ctrl-Space": "collapse",
+					},
+				),
+			},
+		},
+	},
+}
+
+var emacs = map[string]string{
+	"Ctrl-F":         "right",
+	"Ctrl-B":         "left",
+	"Ctrl-N":         "down",
+	"Ctrl-P":         "up",
+	"Alt-F":          "word-right",
+	"Alt-B":          "word-left",
+	"Ctrl-A":         "line-start",
+	"Ctrl-E":         "line-end",
+	"Alt-Shift-<":    "doc-start",
+	"Alt-Shift->":    "doc-end",
+	"Ctrl-V":         "page-down",
+	"Alt-V":          "page-up",
+	"Ctrl-D":         "delete-right",
+	"Alt-D":          "delete-word-right",
+	"Alt-Backspace":  "delete-word-left",
+	"Ctrl-K":         "select-line-end cut",
+	"Ctrl-W":         "cut",
+	"Alt-W":          "copy collapse",
+	"Ctrl-Y":         "paste",
+	"Ctrl-X Ctrl-S":  "save",
+	"Alt-Y":          "paste-extended",
+	"Ctrl-/":         "undo",
+	"Ctrl-X U":       "undo",
+	"Ctrl-G":         "collapse",
+	"Ctrl-Space":     "mode-mark",
+	"Ctrl-X H":       "select-all mode-mark",
+	"Ctrl-Alt-F":     "segment-right",
+	"Ctrl-Alt-B":     "segment-left",
+	"Ctrl-Alt-Space": "select-segment mode-mark",
+	"Ctrl-Alt-N":     "next-segment",
+	"Ctrl-Alt-P":     "prev-segment",
+	"Ctrl-Alt-U":     "parent-segment",
+	"Ctrl-Alt-D":     "child-segment",
+}
@@ -0,0 +1,319 @@
+// Package settings loads the configuration of glom. The settings of the user are a JSON file in the data directory,
+// and a workspace can override any of them with a .glom file in its root written the same way. Values that are left
+// out keep their defaults, and the settings are validated as a whole before they are used.
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gioui.org/io/key"
+	"github.com/p9c/gel/fonts/p9fonts"
+)
+
+// FileName is the name of the settings file of the user in the data directory
+const FileName = "settings.json"
+
+// ProjectFile is the name of the file in the root of a workspace that overrides the settings of the user
+const ProjectFile = ".glom"
+
+// Settings is the configuration of the editor
+type Settings struct {
+	// Theme is light or dark
+	Theme string `json:"theme"`
+	Font  Font   `json:"font"`
+	// TabWidth is the number of columns between tab stops
+	TabWidth int `json:"tabWidth"`
+	// Wrap continues lines that are longer than the editor is wide on the rows below
+	Wrap        bool   `json:"wrap"`
+	LineNumbers bool   `json:"lineNumbers"`
+	Window      Window `json:"window"`
+	Fold        Fold   `json:"fold"`
+	// Paredit keeps the brackets, literals and block comments of documents balanced while they are edited
+	Paredit bool `json:"paredit"`
+	// Keymap is the preset the keys are bound from, one of Keymaps
+	Keymap string `json:"keymap"`
+	// Keys binds the names of actions to keys in every mode of the keymap. A key is written as modifiers and a key
+	// name joined by dashes, like Short-Z, and keys pressed one after another are separated by spaces.
+	Keys map[string]string `json:"keys"`
+	// Modes binds keys to actions in the modes of the keymap by the name of the mode. Several actions separated by
+	// spaces are run one after another.
+	Modes map[string]map[string]string `json:"modes"`
+}
+
+// Font is the font the text is drawn in
+type Font struct {
+	// Name is one of the monospaced fonts glom is built with
+	Name string `json:"name"`
+	// Size is in scaled points
+	Size float32 `json:"size"`
+}
+
+// Window is the size the window opens with, in multiples of the text size
+type Window struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// Fold is how the folds of a file are set when it is opened
+type Fold struct {
+	// Depth is the number of levels left open in a file without stored folds, nothing is folded when it is zero
+	Depth int `json:"depth"`
+	// Restore loads the folds a file had when it was last closed
+	Restore bool `json:"restore"`
+}
+
+// Keymaps is the presets of key bindings
+var Keymaps = []string{"default", "vim", "emacs"}
+
+// Monospaced is the fonts the text can be drawn in
+var Monospaced = []string{"go regular", "go bold", "go italic", "go bolditalic"}
+
+// Default returns the settings used where the files do not give a value
+func Default() Settings {
+	return Settings{
+		Theme:       "light",
+		Font:        Font{Name: "go regular", Size: 16},
+		TabWidth:    4,
+		LineNumbers: true,
+		Window:      Window{Width: 60, Height: 40},
+		Fold:        Fold{Restore: true},
+		Keymap:      "default",
+		Keys: map[string]string{
+			"undo": "Short-Z",
+			"redo": "Short-Shift-Z",
+		},
+	}
+}
+
+// Path returns the path of the settings file of the user in a data directory
+func Path(dir string) string {
+	return filepath.Join(dir, FileName)
+}
+
+// Workspace returns the root of the workspace a directory is in, which is the nearest directory at or above it that
+// has a project file, or an empty string if there is none
+func Workspace(dir string) string {
+	if abs, e := filepath.Abs(dir); !E.Chk(e) {
+		dir = abs
+	}
+	for {
+		if _, e := os.Stat(filepath.Join(dir, ProjectFile)); e == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Load reads the settings of the user from the data directory and the overrides of the workspace over them, either of
+// which may be missing. An empty workspace has no overrides.
+func Load(dir, workspace string) (s Settings, e error) {
+	s = Default()
+	files := []string{Path(dir)}
+	if workspace != "" {
+		files = append(files, filepath.Join(workspace, ProjectFile))
+	}
+	for _, path := range files {
+		if e = merge(&s, path); e != nil {
+			return
+		}
+	}
+	e = s.Validate()
+	return
+}
+
+// merge decodes a settings file over the settings. Fields in the file replace the ones in the settings, and keys are
+// added to the bindings already there, also in each mode.
+func merge(s *Settings, path string) (e error) {
+	var b []byte
+	if b, e = ioutil.ReadFile(path); e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	modes := s.Modes
+	s.Modes = nil
+	e = dec.Decode(s)
+	for mode, keys := range s.Modes {
+		if modes == nil {
+			modes = make(map[string]map[string]string)
+		}
+		if modes[mode] == nil {
+			modes[mode] = make(map[string]string)
+		}
+		for k, actions := range keys {
+			modes[mode][k] = actions
+		}
+	}
+	if s.Modes = modes; e != nil {
+		return fmt.Errorf("%s: %w", path, e)
+	}
+	return
+}
+
+// Validate returns an error describing every value of the settings that cannot be used
+func (s Settings) Validate() error {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+	if s.Theme != "light" && s.Theme != "dark" {
+		add("theme %q is not light or dark", s.Theme)
+	}
+	if !contains(Monospaced, s.Font.Name) {
+		add("font %q is not one of %s", s.Font.Name, strings.Join(Monospaced, ", "))
+	} else if _, ok := p9fonts.Fonts[s.Font.Name]; !ok {
+		add("font %q is not built in", s.Font.Name)
+	}
+	if s.Font.Size < 6 || s.Font.Size > 72 {
+		add("font size %v is not between 6 and 72", s.Font.Size)
+	}
+	if s.TabWidth < 1 || s.TabWidth > 16 {
+		add("tab width %d is not between 1 and 16", s.TabWidth)
+	}
+	if s.Window.Width < 10 || s.Window.Height < 10 {
+		add("window size %dx%d is smaller than 10x10", s.Window.Width, s.Window.Height)
+	}
+	if s.Fold.Depth < 0 {
+		add("fold depth %d is negative", s.Fold.Depth)
+	}
+	if !contains(Keymaps, s.Keymap) {
+		add("keymap %q is not one of %s", s.Keymap, strings.Join(Keymaps, ", "))
+	}
+	for _, action := range sorted(s.Keys) {
+		if _, e := ParseKeys(s.Keys[action]); e != nil {
+			add("key of %s: %v", action, e)
+		}
+	}
+	modes := make(map[string]string, len(s.Modes))
+	for mode := range s.Modes {
+		modes[mode] = ""
+	}
+	for _, mode := range sorted(modes) {
+		for _, k := range sorted(s.Modes[mode]) {
+			if _, e := ParseKeys(k); e != nil {
+				add("key in %s mode: %v", mode, e)
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// sorted returns the keys of a map in order
+func sorted(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+var modifiers = map[string]key.Modifiers{
+	"Ctrl":    key.ModCtrl,
+	"Command": key.ModCommand,
+	"Shift":   key.ModShift,
+	"Alt":     key.ModAlt,
+	"Super":   key.ModSuper,
+	// Short is Command on macOS and Ctrl elsewhere
+	"Short": key.ModShortcut,
+}
+
+// names are the names keys without a printable name can be written with
+var names = map[string]string{
+	"Left":      key.NameLeftArrow,
+	"Right":     key.NameRightArrow,
+	"Up":        key.NameUpArrow,
+	"Down":      key.NameDownArrow,
+	"Return":    key.NameReturn,
+	"Enter":     key.NameEnter,
+	"Escape":    key.NameEscape,
+	"Home":      key.NameHome,
+	"End":       key.NameEnd,
+	"Backspace": key.NameDeleteBackward,
+	"Delete":    key.NameDeleteForward,
+	"PageUp":    key.NamePageUp,
+	"PageDown":  key.NamePageDown,
+	"Tab":       key.NameTab,
+}
+
+// ParseKey reads a key written as modifiers and the name of a key joined by dashes, like Ctrl-Shift-Z. Letters are
+// upper case as in the names of key events, keys like the arrows can be given by names like Left, and a dash on its
+// own is the minus key.
+func ParseKey(s string) (name string, mods key.Modifiers, e error) {
+	parts := strings.Split(s, "-")
+	if strings.HasSuffix(s, "--") || s == "-" {
+		parts = append(parts[:len(parts)-2], "-")
+	}
+	name = parts[len(parts)-1]
+	if n, ok := names[name]; ok {
+		name = n
+	}
+	if name == "" {
+		return "", 0, fmt.Errorf("%q has no key", s)
+	}
+	for _, m := range parts[:len(parts)-1] {
+		mod, ok := modifiers[m]
+		if !ok {
+			return "", 0, fmt.Errorf("%q in %q is not a modifier", m, s)
+		}
+		mods |= mod
+	}
+	return
+}
+
+// Key is a key pressed with modifiers
+type Key struct {
+	Name      string
+	Modifiers key.Modifiers
+}
+
+func (k Key) String() string {
+	var parts []string
+	for _, m := range []string{"Ctrl", "Command", "Shift", "Alt", "Super"} {
+		if k.Modifiers.Contain(modifiers[m]) {
+			parts = append(parts, m)
+		}
+	}
+	return strings.Join(append(parts, k.Name), "-")
+}
+
+// ParseKeys reads a sequence of keys pressed one after another, written as keys for ParseKey separated by spaces
+func ParseKeys(s string) (keys []Key, e error) {
+	for _, f := range strings.Fields(s) {
+		var k Key
+		if k.Name, k.Modifiers, e = ParseKey(f); e != nil {
+			return nil, e
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%q has no key", s)
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package settings_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gioui.org/io/key"
+
+	"github.com/p9c/glom/pkg/settings"
+)
+
+func tempDir(t *testing.T) (dir string, done func()) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func write(t *testing.T, path, content string) {
+	if e := os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+		t.Fatal(e)
+	}
+	if e := ioutil.WriteFile(path, []byte(content), 0644); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	data, project := filepath.Join(dir, "data"), filepath.Join(dir, "project")
+	if s, e := settings.Load(data, ""); e != nil || s.TabWidth != settings.Default().TabWidth {
+		t.Fatalf("without files loaded %+v, %v", s, e)
+	}
+	write(
+		t, settings.Path(data),
+		`{"theme": "dark", "tabWidth": 8, "keys": {"save": "Short-S"}, "modes": {"normal": {"Q": "undo"}}}`,
+	)
+	write(
+		t, filepath.Join(project, settings.ProjectFile),
+		`{"tabWidth": 2, "fold": {"depth": 1, "restore": true}, "keymap": "vim", "modes": {"normal": {"Z Z": "redo"}}}`,
+	)
+	if ws := settings.Workspace(filepath.Join(project, "pkg", "sub")); ws != project {
+		t.Errorf("workspace of a subdirectory is %q, want %q", ws, project)
+	}
+	s, e := settings.Load(data, project)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s.Theme != "dark" || s.TabWidth != 2 || s.Fold.Depth != 1 || s.Font.Name != "go regular" {
+		t.Errorf("merged settings are %+v", s)
+	}
+	if s.Keys["save"] != "Short-S" || s.Keys["undo"] != "Short-Z" {
+		t.Errorf("keys are %v, want the defaults with save added", s.Keys)
+	}
+	if s.Keymap != "vim" || s.Modes["normal"]["Q"] != "undo" || s.Modes["normal"]["Z Z"] != "redo" {
+		t.Errorf("keymap is %s with modes %v, want vim with both bindings of the normal mode", s.Keymap, s.Modes)
+	}
+	write(t, filepath.Join(project, settings.ProjectFile), `{"tabwidht": 2}`)
+	if _, e = settings.Load(data, project); e == nil {
+		t.Error("an unknown setting was accepted")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := settings.Default()
+	if e := s.Validate(); e != nil {
+		t.Fatal(e)
+	}
+	s.Theme, s.Font.Name, s.TabWidth, s.Keys["undo"] = "blue", "bariol regular", 0, "Hyper-Z"
+	s.Keymap, s.Modes = "ed", map[string]map[string]string{"normal": {"Ctrl-X Meta-S": "undo"}}
+	e := s.Validate()
+	if e == nil {
+		t.Fatal("bad settings were valid")
+	}
+	for _, want := range []string{"theme", "font", "tab width", "key of undo", "keymap", "normal mode"} {
+		if !strings.Contains(e.Error(), want) {
+			t.Errorf("%q does not mention the %s", e, want)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		name string
+		mods key.Modifiers
+	}{
+		{"Z", "Z", 0},
+		{"Ctrl-Shift-Z", "Z", key.ModCtrl | key.ModShift},
+		{"Short-⏎", "⏎", key.ModShortcut},
+		{"Ctrl--", "-", key.ModCtrl},
+		{"-", "-", 0},
+		{"Alt-Left", key.NameLeftArrow, key.ModAlt},
+	} {
+		name, mods, e := settings.ParseKey(c.in)
+		if e != nil || name != c.name || mods != c.mods {
+			t.Errorf("%q parsed to %q %v, %v", c.in, name, mods, e)
+		}
+	}
+	for _, bad := range []string{"", "Ctrl-", "Meta-X"} {
+		if _, _, e := settings.ParseKey(bad); e == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, e := settings.ParseKeys(" Ctrl-X  Shift-Up D ")
+	if e != nil {
+		t.Fatal(e)
+	}
+	want := []settings.Key{{"X", key.ModCtrl}, {key.NameUpArrow, key.ModShift}, {"D", 0}}
+	if len(keys) != len(want) {
+		t.Fatalf("parsed %v, want %v", keys, want)
+	}
+	for i := range keys {
+		if keys[i] != want[i] {
+			t.Fatalf("parsed %v, want %v", keys, want)
+		}
+	}
+	if s := keys[1].String(); s != "Shift-"+key.NameUpArrow {
+		t.Errorf("key written as %q", s)
+	}
+	for _, bad := range []string{"", " ", "Ctrl-X Meta-S"} {
+		if _, e := settings.ParseKeys(bad); e == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	w := settings.NewWatcher(dir, "")
+	if _, changed, e := w.Check(); !changed || e != nil {
+		t.Fatalf("first check changed %v, %v", changed, e)
+	}
+	if _, changed, _ := w.Check(); changed {
+		t.Error("settings changed without a file changing")
+	}
+	write(t, settings.Path(dir), `{"tabWidth": 3}`)
+	s, changed, e := w.Check()
+	if !changed || e != nil || s.TabWidth != 3 {
+		t.Errorf("after writing the file the check gave %v %v %v", s.TabWidth, changed, e)
+	}
+	write(t, settings.Path(dir), `{"tabWidth": 300}`)
+	if _, changed, e = w.Check(); !changed || e == nil {
+		t.Errorf("invalid settings changed %v, %v", changed, e)
+	}
+	// starting with settings that are not valid uses the defaults, and fixing them is a change
+	w = settings.NewWatcher(dir, "")
+	if s = w.Start(); s.TabWidth != settings.Default().TabWidth {
+		t.Errorf("starting with invalid settings gave tab width %d", s.TabWidth)
+	}
+	write(t, settings.Path(dir), `{"tabWidth": 2}`)
+	if s, changed, e = w.Check(); !changed || e != nil || s.TabWidth != 2 {
+		t.Errorf("after fixing the file the check gave %v %v %v", s.TabWidth, changed, e)
+	}
+}
@@ -0,0 +1,97 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/p9c/qu"
+)
+
+// stamp identifies a version of a file by its size and modification time
+type stamp struct {
+	exists bool
+	size   int64
+	mod    time.Time
+}
+
+func stampOf(path string) (s stamp) {
+	info, e := os.Stat(path)
+	if e != nil {
+		return
+	}
+	return stamp{exists: true, size: info.Size(), mod: info.ModTime()}
+}
+
+// Watcher notices changes to the settings files of a data directory and a workspace
+type Watcher struct {
+	dir, workspace string
+	stamps         []stamp
+}
+
+// NewWatcher creates a watcher of the settings files, which reports the files as they are now as a change on its
+// first check
+func NewWatcher(dir, workspace string) *Watcher {
+	return &Watcher{dir: dir, workspace: workspace}
+}
+
+// files returns the settings files being watched
+func (w *Watcher) files() (files []string) {
+	files = []string{Path(w.dir)}
+	if w.workspace != "" {
+		files = append(files, filepath.Join(w.workspace, ProjectFile))
+	}
+	return
+}
+
+// Check loads the settings again if a file was changed, created or removed since the last check
+func (w *Watcher) Check() (s Settings, changed bool, e error) {
+	files := w.files()
+	stamps := make([]stamp, len(files))
+	for i, path := range files {
+		stamps[i] = stampOf(path)
+		changed = changed || w.stamps == nil || stamps[i] != w.stamps[i]
+	}
+	if !changed {
+		return
+	}
+	w.stamps = stamps
+	s, e = Load(w.dir, w.workspace)
+	return
+}
+
+// Start loads the settings for the first time. Settings that are not valid are logged like in Watch, and the
+// defaults are used in their place until the files are fixed.
+func (w *Watcher) Start() (s Settings) {
+	var e error
+	if s, _, e = w.Check(); e != nil {
+		W.Ln("settings not loaded, using the defaults:", e)
+		s = Default()
+	}
+	return
+}
+
+// Watch checks the settings files at an interval until quit and calls fn with the settings each time they change.
+// Settings that are not valid are logged and skipped, so that the last good ones stay in use.
+func (w *Watcher) Watch(every time.Duration, quit qu.C, fn func(s Settings)) {
+	ticker := time.NewTicker(every)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s, changed, e := w.Check()
+				if !changed {
+					continue
+				}
+				if e != nil {
+					W.Ln("settings not reloaded:", e)
+					continue
+				}
+				fn(s)
+			case <-quit.Wait():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,427 @@
+// Package golang segments Go source along its syntax tree, so that declarations, statements, clauses, calls and
+// literals become segments that can be moved, folded and highlighted as a unit. Declarations that do not parse are
+// segmented by their brackets instead.
+package golang
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// Parse builds the segment tree of a Go source text, which is parsed again in full with every edit
+func Parse(src structure.Source) *structure.Tree {
+	return structure.ParseWith(src, structure.Default, Segment)
+}
+
+// Segment builds the segments of a Go source text. When the text does not parse as a whole, each top level
+// declaration is parsed on its own, and the declarations that contain a syntax error are segmented by their brackets,
+// literals and comments.
+func Segment(src structure.Source) (root *structure.Segment) {
+	n := src.Len()
+	b := &builder{src: src, clauses: make(map[*ast.BlockStmt]bool)}
+	b.index(n)
+	root = structure.NewSegment(structure.Root, "", 0, n)
+	root.Separator = ";"
+	if !b.parse(0, len(b.text), "") {
+		// an error is confined to the declaration it is in
+		starts := b.declarations()
+		for i, start := range starts {
+			end := len(b.text)
+			if i+1 < len(starts) {
+				end = starts[i+1]
+			}
+			prefix := declPrefix
+			if i == 0 {
+				prefix = ""
+			}
+			if !b.parse(start, end, prefix) {
+				b.fallback(b.runes[start], b.runes[end])
+			}
+		}
+	}
+	root.Adopt(b.nest(n)...)
+	return
+}
+
+// declPrefix makes a declaration parse as a file on its own
+const declPrefix = "package p;"
+
+// keywords start the top level declarations of a Go file
+var keywords = []string{"func", "var", "const", "type", "import"}
+
+// declarations returns the byte offsets of the lines that start a top level declaration, after the first chunk of the
+// text, which holds the package clause
+func (b *builder) declarations() (starts []int) {
+	tr := structure.Parse(b.src, nil)
+	starts = append(starts, 0)
+	for i := 0; i < len(b.text); i++ {
+		if i > 0 && b.text[i-1] != '\n' {
+			continue
+		}
+		for _, k := range keywords {
+			rest := b.text[i:]
+			if !bytes.HasPrefix(rest, []byte(k)) || len(rest) > len(k) && !isSpace(rest[len(k)]) &&
+				rest[len(k)] != '(' {
+				continue
+			}
+			// a keyword at the start of a line inside a bracket or a literal does not start a declaration
+			if i > 0 && tr.Enclosing(b.runes[i]) == tr.Root() {
+				starts = append(starts, i)
+			}
+			break
+		}
+	}
+	return
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// parse parses the text between two byte offsets, preceded by the prefix, and records its segments if it has no
+// errors
+func (b *builder) parse(start, end int, prefix string) bool {
+	text := append([]byte(prefix), b.text[start:end]...)
+	fset := token.NewFileSet()
+	f, e := parser.ParseFile(fset, "", text, parser.ParseComments|parser.AllErrors)
+	if e != nil || f == nil {
+		return false
+	}
+	fset.Iterate(
+		func(tf *token.File) bool {
+			b.file = tf
+			return false
+		},
+	)
+	b.shift = start - len(prefix)
+	if prefix == "" {
+		if s := b.add(structure.Node, "package", f.Package, f.Name.End()); s != nil {
+			s.fixed = true
+		}
+	}
+	for _, d := range f.Decls {
+		b.node(d)
+	}
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			b.comment(c)
+		}
+	}
+	return true
+}
+
+// span is a segment found in the source, with absolute positions
+type span struct {
+	kind        structure.Kind
+	label       string
+	start, end  int
+	open, close int
+	broken      bool
+	fixed       bool
+	sep         string
+}
+
+// builder collects the segments of a source text
+type builder struct {
+	src  structure.Source
+	text []byte
+	// runes maps each byte offset of the text to the offset of its rune
+	runes []int
+	file  *token.File
+	// shift is the byte offset in the text of the start of the parsed file
+	shift int
+	spans []span
+	// clauses holds the blocks that are the bodies of switch and select statements
+	clauses map[*ast.BlockStmt]bool
+}
+
+// index encodes the source as UTF-8 for the parser and maps byte offsets back to rune offsets
+func (b *builder) index(n int) {
+	b.text = make([]byte, 0, n)
+	b.runes = make([]int, 0, n+1)
+	var buf [utf8.UTFMax]byte
+	for i := 0; i < n; i++ {
+		w := utf8.EncodeRune(buf[:], b.src.RuneAt(i))
+		b.text = append(b.text, buf[:w]...)
+		for j := 0; j < w; j++ {
+			b.runes = append(b.runes, i)
+		}
+	}
+	b.runes = append(b.runes, n)
+}
+
+// pos converts a position in the parsed file to a rune offset, or -1 if it is not valid
+func (b *builder) pos(p token.Pos) int {
+	if !p.IsValid() || b.file == nil {
+		return -1
+	}
+	o := int(p) - b.file.Base() + b.shift
+	if o < 0 || o >= len(b.runes) {
+		return -1
+	}
+	return b.runes[o]
+}
+
+// add records a segment between two positions of the parsed file
+func (b *builder) add(kind structure.Kind, label string, from, to token.Pos) *span {
+	start, end := b.pos(from), b.pos(to)
+	if start < 0 || end <= start {
+		return nil
+	}
+	b.spans = append(b.spans, span{kind: kind, label: label, start: start, end: end})
+	return &b.spans[len(b.spans)-1]
+}
+
+// separate sets the separator between the children of a segment
+func separate(s *span, sep string) {
+	if s != nil {
+		s.sep = sep
+	}
+}
+
+// delimit sets the lengths of the delimiters of a segment from the positions of its opening and closing brackets
+func (b *builder) delimit(s *span, open, close token.Pos) {
+	if s == nil {
+		return
+	}
+	if o := b.pos(open); o >= s.start {
+		s.open = o + 1 - s.start
+	}
+	if c := b.pos(close); c >= 0 && c < s.end {
+		s.close = s.end - c
+	} else {
+		s.broken = true
+	}
+}
+
+// fallback segments the text between two offsets by its brackets, literals and comments
+func (b *builder) fallback(start, end int) {
+	if end <= start {
+		return
+	}
+	runes := make(structure.Runes, end-start)
+	for i := range runes {
+		runes[i] = b.src.RuneAt(start + i)
+	}
+	structure.Parse(runes, nil).Root().Walk(
+		func(s *structure.Segment) bool {
+			if s.Kind == structure.Root {
+				return true
+			}
+			b.spans = append(
+				b.spans, span{
+					kind: s.Kind, label: s.Label, start: start + s.Start(), end: start + s.End(),
+					open: s.Open, close: s.Close, broken: s.Broken,
+				},
+			)
+			return true
+		},
+	)
+}
+
+// comment records a comment
+func (b *builder) comment(c *ast.Comment) {
+	label := c.Text[:2]
+	if s := b.add(structure.Comment, label, c.Pos(), c.End()); s != nil {
+		s.open = 2
+		if label == "/*" {
+			s.close = 2
+		}
+	}
+}
+
+// node records the segments of a declaration and everything in it
+func (b *builder) node(root ast.Node) {
+	ast.Inspect(
+		root, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case nil:
+				return false
+			case *ast.BadDecl, *ast.BadStmt, *ast.BadExpr:
+				b.fallback(b.pos(x.Pos()), b.pos(x.End()))
+				return false
+			case *ast.FuncDecl:
+				b.add(structure.Node, "func", x.Pos(), x.End())
+			case *ast.GenDecl:
+				s := b.add(structure.Node, x.Tok.String(), x.Pos(), x.End())
+				if s != nil && x.Tok == token.IMPORT {
+					// imports must come before the other declarations
+					s.fixed = true
+				}
+				if x.Lparen.IsValid() {
+					b.delimit(s, x.Lparen, x.Rparen)
+					separate(s, ";")
+				}
+			case *ast.ImportSpec, *ast.ValueSpec, *ast.TypeSpec:
+				b.add(structure.Node, "spec", x.Pos(), x.End())
+			case *ast.FieldList:
+				if x.Opening.IsValid() {
+					// parameters are separated by commas and the fields of structs and interfaces by lines
+					label, sep := "fields", ";"
+					if b.src.RuneAt(b.pos(x.Opening)) == '(' {
+						label, sep = "params", ","
+					}
+					s := b.add(structure.Node, label, x.Opening, x.End())
+					b.delimit(s, x.Opening, x.Closing)
+					separate(s, sep)
+				}
+			case *ast.Field:
+				// unnamed parameters and embedded fields are only types, which cannot be mixed with named ones
+				label := "field"
+				if len(x.Names) == 0 {
+					label = "type"
+				}
+				b.add(structure.Node, label, x.Pos(), x.End())
+			case *ast.BlockStmt:
+				// the bodies of switch and select statements hold clauses rather than statements
+				label := "block"
+				if b.clauses[x] {
+					label = "clauses"
+				}
+				s := b.add(structure.Node, label, x.Lbrace, x.End())
+				b.delimit(s, x.Lbrace, x.Rbrace)
+				separate(s, ";")
+			case *ast.CaseClause, *ast.CommClause:
+				separate(b.add(structure.Node, "case", x.Pos(), x.End()), ";")
+			case *ast.FuncLit:
+				b.add(structure.Node, "funclit", x.Pos(), x.End())
+			case *ast.CompositeLit:
+				s := b.add(structure.Node, "composite", x.Pos(), x.End())
+				b.delimit(s, x.Lbrace, x.Rbrace)
+				separate(s, ",")
+				for _, el := range x.Elts {
+					b.add(structure.Node, "element", el.Pos(), el.End())
+				}
+			case *ast.KeyValueExpr:
+				b.add(structure.Node, "keyvalue", x.Pos(), x.End())
+			case *ast.CallExpr:
+				s := b.add(structure.Node, "call", x.Pos(), x.End())
+				b.delimit(s, x.Lparen, x.Rparen)
+				separate(s, ",")
+				for _, arg := range x.Args {
+					b.add(structure.Node, "arg", arg.Pos(), arg.End())
+				}
+			case *ast.BasicLit:
+				if x.Kind == token.STRING || x.Kind == token.CHAR {
+					if s := b.add(structure.String, x.Value[:1], x.Pos(), x.End()); s != nil {
+						s.open, s.close = 1, 1
+					}
+				}
+			case ast.Stmt:
+				switch st := x.(type) {
+				case *ast.SwitchStmt:
+					b.clauses[st.Body] = true
+				case *ast.TypeSwitchStmt:
+					b.clauses[st.Body] = true
+				case *ast.SelectStmt:
+					b.clauses[st.Body] = true
+				}
+				if label := statement(x); label != "" {
+					b.add(structure.Node, label, x.Pos(), x.End())
+				}
+			}
+			return true
+		},
+	)
+}
+
+// statement returns the label of a statement, or nothing for statements that are not segments of their own
+func statement(s ast.Stmt) string {
+	switch s.(type) {
+	case *ast.IfStmt:
+		return "if"
+	case *ast.ForStmt:
+		return "for"
+	case *ast.RangeStmt:
+		return "range"
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		return "switch"
+	case *ast.SelectStmt:
+		return "select"
+	case *ast.ReturnStmt:
+		return "return"
+	case *ast.DeclStmt:
+		return "decl"
+	case *ast.AssignStmt:
+		return "assign"
+	case *ast.ExprStmt:
+		return "expr"
+	case *ast.IncDecStmt:
+		return "incdec"
+	case *ast.GoStmt:
+		return "go"
+	case *ast.DeferStmt:
+		return "defer"
+	case *ast.BranchStmt:
+		return "branch"
+	case *ast.LabeledStmt:
+		return "label"
+	case *ast.SendStmt:
+		return "send"
+	}
+	return ""
+}
+
+// nest builds the segment tree from the spans. Spans with the same range are merged into one segment that takes the
+// kind and label of the innermost, which is the most specific.
+func (b *builder) nest(n int) (top []*structure.Segment) {
+	spans := b.spans[:0]
+	for _, s := range b.spans {
+		if s.start >= 0 && s.end <= n {
+			spans = append(spans, s)
+		}
+	}
+	sort.SliceStable(
+		spans, func(i, j int) bool {
+			if spans[i].start != spans[j].start {
+				return spans[i].start < spans[j].start
+			}
+			return spans[i].end > spans[j].end
+		},
+	)
+	type open struct {
+		seg *structure.Segment
+		end int
+	}
+	var stack []open
+	for _, s := range spans {
+		for len(stack) > 0 && stack[len(stack)-1].end <= s.start {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			t := stack[len(stack)-1]
+			if s.end > t.end {
+				// overlapping segments cannot be nested, the outer one is kept
+				continue
+			}
+			if s.start == t.seg.Start() && s.end == t.end {
+				t.seg.Kind, t.seg.Label = s.kind, s.label
+				t.seg.Fixed = t.seg.Fixed || s.fixed
+				if s.sep != "" {
+					t.seg.Separator = s.sep
+				}
+				if s.open != 0 || s.close != 0 {
+					t.seg.Open, t.seg.Close, t.seg.Broken = s.open, s.close, s.broken
+				}
+				continue
+			}
+		}
+		seg := structure.NewSegment(s.kind, s.label, s.start, s.end-s.start)
+		seg.Open, seg.Close, seg.Broken, seg.Fixed = s.open, s.close, s.broken, s.fixed
+		seg.Separator = s.sep
+		if len(stack) > 0 {
+			p := stack[len(stack)-1].seg
+			p.Children = append(p.Children, seg)
+		} else {
+			top = append(top, seg)
+		}
+		stack = append(stack, open{seg, s.end})
+	}
+	return
+}
@@ -0,0 +1,123 @@
+package golang_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/structure/golang"
+)
+
+const src = `package main
+
+// Fn renders the editor
+func (s *State) Fn(gtx l.Context) l.Dimensions {
+	return s.Flex().Rigid(func(gtx l.Context) l.Dimensions {
+		switch x := s.Doc.Len(); {
+		case x > 0:
+			s.n++
+		}
+		return l.Dimensions{Size: image.Point{X: 1}}
+	}).Fn(gtx)
+}
+
+var names = []string{"a", "b"}
+`
+
+// labels returns the labels of the segments containing the offset, from the outermost down
+func labels(t *structure.Tree, at int) string {
+	var out []string
+	for _, s := range t.Path(at)[1:] {
+		out = append(out, s.Label)
+	}
+	return strings.Join(out, " ")
+}
+
+// check verifies that segments nest inside their parents and follow each other in order
+func check(t *testing.T, s *structure.Segment) {
+	prev := s.Start()
+	for _, c := range s.Children {
+		if c.Parent != s || c.Start() < prev || c.End() > s.End() {
+			t.Fatalf("%s is out of place in %s", c, s)
+		}
+		prev = c.End()
+		check(t, c)
+	}
+}
+
+func TestSegments(t *testing.T) {
+	tr := golang.Parse(structure.Runes(src))
+	check(t, tr.Root())
+	for _, c := range []struct {
+		at   string
+		want string
+	}{
+		{"Fn renders", "//"},
+		{"gtx l.Context) l.Dimensions {\n\treturn", "func params field"},
+		{"x > 0", "func block return call call funclit block switch clauses case"},
+		{"n++", "func block return call call funclit block switch clauses case incdec"},
+		{"X: 1", "func block return call call funclit block return composite keyvalue composite keyvalue"},
+		{`"b"`, `var spec composite "`},
+		{"names", "var spec"},
+	} {
+		at := len([]rune(src[:strings.Index(src, c.at)]))
+		if got := labels(tr, at); got != c.want {
+			t.Errorf("segments at %q are %q, want %q", c.at, got, c.want)
+		}
+	}
+	call := tr.Path(len([]rune(src[:strings.Index(src, "func(gtx")])))[5]
+	if start, end := call.Inner(); src[start-1] != '(' || src[end] != ')' {
+		t.Errorf("the delimiters of %s are wrong", call)
+	}
+	if s := tr.Enclosing(strings.Index(src, `"a"`)); s.Kind != structure.String {
+		t.Errorf("expected a string, found %s", s)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	broken := strings.Replace(src, "s.n++", "s.n++ +", 1)
+	tr := golang.Parse(structure.Runes(broken))
+	check(t, tr.Root())
+	at := strings.Index(broken, "x > 0")
+	if got := labels(tr, at); got != "{ ( { {" {
+		t.Errorf("segments in the broken declaration are %q", got)
+	}
+	if got := labels(tr, strings.Index(broken, `"b"`)); got != `var spec composite "` {
+		t.Errorf("segments after the broken declaration are %q", got)
+	}
+	tr = golang.Parse(structure.Runes("f(a, [b])"))
+	if got := labels(tr, 6); got != "( [" {
+		t.Errorf("segments of text that is not a file are %q", got)
+	}
+}
+
+func TestEdits(t *testing.T) {
+	d := doc.New()
+	tr := golang.Parse(d)
+	d.Watch(func(ev doc.Event) { tr.Apply(d, ev) })
+	for i, r := range src {
+		if e := d.Insert(len([]rune(src[:i])), string(r)); e != nil {
+			t.Fatal(e)
+		}
+	}
+	if e := d.Move(0, len("package main\n"), d.Len()); e != nil {
+		t.Fatal(e)
+	}
+	want := golang.Parse(structure.Runes(d.Text()))
+	if a, b := dump(tr), dump(want); a != b {
+		t.Fatalf("segments after edits\n%s\nwant\n%s", a, b)
+	}
+}
+
+func dump(t *structure.Tree) string {
+	var sb strings.Builder
+	t.Walk(
+		func(s *structure.Segment) bool {
+			fmt.Fprintf(&sb, "%s%s\n", strings.Repeat("  ", s.Depth()), s)
+			return true
+		},
+	)
+	return sb.String()
+}
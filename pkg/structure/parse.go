@@ -0,0 +1,280 @@
+package structure
+
+import (
+	"unicode"
+)
+
+// frame is an open segment on the parser stack. Segments on the stack and their children hold absolute positions
+// until they are adopted into the tree.
+type frame struct {
+	seg     *Segment
+	bracket int
+	level   int
+}
+
+// parser scans a range of the text into segments
+type parser struct {
+	src   Source
+	m     *matcher
+	end   int
+	limit int
+	stack []*frame
+	// contentEnd is the offset after the last rune that was not white space
+	contentEnd int
+	// stray is set when a closing bracket matched nothing inside the range, and strays are the indices of those
+	// brackets
+	stray  bool
+	strays []int
+	// open is set when a literal or delimiter runs past the end of the range
+	open    bool
+	scanned int
+}
+
+const (
+	// anyCloser makes parse fail if the range ends inside any bracket
+	anyCloser = -1
+	// noCloser makes parse accept a range that ends inside brackets, for parsing to the end of the text
+	noCloser = -2
+)
+
+// parse scans the text from start to end into the children of a segment at start. level is the indentation of the
+// line the range starts on and lineStart is whether the range starts at the beginning of a line.
+//
+// closer is the index of the bracket that closes the range. ok is false if the range cannot be parsed in isolation
+// from the text around it, which is when a closing bracket matches nothing inside it, a literal or delimiter runs past
+// its end, or a bracket of the kind that closes it is left open.
+func parse(src Source, m *matcher, start, end, level int, lineStart bool, closer int) (children []*Segment,
+	scanned int, ok bool) {
+	p := &parser{src: src, m: m, end: end, limit: src.Len(), contentEnd: start}
+	top := &Segment{Kind: Root, start: start}
+	p.stack = []*frame{{seg: top, bracket: -1, level: level}}
+	p.run(start, lineStart)
+	for len(p.stack) > 1 {
+		if b := p.top().bracket; b >= 0 && (closer == anyCloser || b == closer) {
+			p.open = true
+		}
+		p.closeTop(end, true)
+	}
+	return top.Children, p.scanned, !p.stray && !p.open
+}
+
+func (p *parser) top() *frame {
+	return p.stack[len(p.stack)-1]
+}
+
+func (p *parser) push(s *Segment, bracket, level int) {
+	p.stack = append(p.stack, &frame{seg: s, bracket: bracket, level: level})
+}
+
+// closeTop ends the segment on top of the stack at the offset, indentation blocks end after their last content
+// instead. Brackets closed this way are missing their closing delimiter.
+func (p *parser) closeTop(at int, broken bool) {
+	f := p.top()
+	p.stack = p.stack[:len(p.stack)-1]
+	s := f.seg
+	if s.Kind == Indent {
+		at = p.contentEnd
+		if at < s.start {
+			at = s.start
+		}
+		// a bracket left open inside the block runs to where it was closed, and so does the block
+		if n := len(s.Children); n > 0 {
+			if last := s.Children[n-1]; last.start+last.Len > at {
+				at = last.start + last.Len
+			}
+		}
+		if at == s.start {
+			return
+		}
+	} else if broken {
+		s.Broken = true
+	}
+	s.Len = at - s.start
+	parent := p.top().seg
+	parent.Children = append(parent.Children, s)
+}
+
+func (p *parser) add(s *Segment) {
+	parent := p.top().seg
+	parent.Children = append(parent.Children, s)
+}
+
+func (p *parser) run(i int, lineStart bool) {
+	syn := p.m.syntax
+	for i < p.end {
+		p.scanned++
+		if lineStart {
+			lineStart = false
+			if syn.Indent {
+				p.indent(i)
+			}
+		}
+		r := p.src.RuneAt(i)
+		if r == '\n' {
+			lineStart = true
+			i++
+			continue
+		}
+		t, ok := p.m.match(p.src, i, p.limit)
+		if ok && i+len(t.text) > p.end {
+			// the delimiter reaches into the text after the range
+			p.open = true
+			ok = false
+		}
+		if !ok {
+			if !unicode.IsSpace(r) {
+				p.contentEnd = i + 1
+			}
+			i++
+			continue
+		}
+		switch t.kind {
+		case tokOpen:
+			s := &Segment{Kind: Bracket, Label: string(t.text), start: i, Open: len(t.text)}
+			var level int
+			if syn.Indent {
+				// the line may have started inside a literal, so it is measured rather than taken from the scan
+				level = lineIndent(p.src, i, syn.TabWidth)
+			}
+			p.push(s, t.index, level)
+			i += len(t.text)
+		case tokClose:
+			f := len(p.stack) - 1
+			for ; f > 0 && p.stack[f].bracket != t.index; f-- {
+			}
+			i += len(t.text)
+			if f == 0 {
+				p.stray, p.strays = true, append(p.strays, t.index)
+				p.contentEnd = i
+				break
+			}
+			for len(p.stack)-1 > f {
+				p.closeTop(i-len(t.text), true)
+			}
+			p.top().seg.Close = len(t.text)
+			p.contentEnd = i
+			p.closeTop(i, false)
+		case tokQuote:
+			i = p.literal(i, String, string(t.text), len(t.text), p.m.quotes[t.index])
+		case tokLineComment:
+			i = p.literal(i, Comment, string(t.text), len(t.text), Quote{Close: "\n"})
+		case tokBlockComment:
+			q := Quote{Close: string(p.m.blocks[t.index]), Multiline: true}
+			i = p.literal(i, Comment, string(t.text), len(t.text), q)
+		}
+	}
+}
+
+// literal scans a string or comment starting at the offset and returns the offset after it
+func (p *parser) literal(at int, kind Kind, label string, open int, q Quote) int {
+	s := &Segment{Kind: kind, Label: label, start: at, Open: open}
+	closer := []rune(q.Close)
+	i := at + open
+	for {
+		if i >= p.end {
+			if p.end < p.limit && (q.Multiline || p.src.RuneAt(p.end) != '\n') {
+				// the literal continues past the end of the range
+				p.open = true
+			}
+			s.Broken = q.Close != "\n"
+			break
+		}
+		p.scanned++
+		r := p.src.RuneAt(i)
+		if q.Close == "\n" && r == '\n' {
+			// line comments end before the line break
+			break
+		}
+		if hasPrefix(p.src, i, p.limit, closer) {
+			if i+len(closer) > p.end {
+				p.open = true
+			}
+			i += len(closer)
+			s.Close = len(closer)
+			break
+		}
+		if r == '\n' && !q.Multiline {
+			s.Broken = true
+			break
+		}
+		if q.Escape != 0 && r == q.Escape {
+			i++
+		}
+		i++
+	}
+	if i > p.end {
+		i = p.end
+	}
+	s.Len = i - at
+	p.contentEnd = i
+	p.add(s)
+	return i
+}
+
+// indent opens and closes indentation blocks at the start of a line
+func (p *parser) indent(at int) {
+	syn := p.m.syntax
+	tab := syn.TabWidth
+	if tab < 1 {
+		tab = 1
+	}
+	var w int
+	i := at
+	for ; i < p.end; i++ {
+		switch p.src.RuneAt(i) {
+		case ' ':
+			w++
+			continue
+		case '\t':
+			w += tab - w%tab
+			continue
+		}
+		break
+	}
+	if i >= p.end || p.src.RuneAt(i) == '\n' || p.src.RuneAt(i) == '\r' {
+		// blank lines do not change the indentation
+		return
+	}
+	for p.top().seg.Kind == Indent && w < p.top().level {
+		p.closeTop(at, false)
+	}
+	if w > p.top().level {
+		p.push(&Segment{Kind: Indent, start: at}, -1, w)
+	}
+}
+
+// inIndentation reports whether only white space comes before the offset on its line
+func inIndentation(src Source, at int) bool {
+	for i := at - 1; i >= 0; i-- {
+		switch src.RuneAt(i) {
+		case '\n':
+			return true
+		case ' ', '\t':
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// lineIndent measures the indentation of the line containing the offset
+func lineIndent(src Source, at, tab int) (w int) {
+	if tab < 1 {
+		tab = 1
+	}
+	i := at
+	for i > 0 && src.RuneAt(i-1) != '\n' {
+		i--
+	}
+	for ; i < at; i++ {
+		switch src.RuneAt(i) {
+		case ' ':
+			w++
+		case '\t':
+			w += tab - w%tab
+		default:
+			return
+		}
+	}
+	return
+}
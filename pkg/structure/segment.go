@@ -0,0 +1,207 @@
+package structure
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Kind is the type of a segment
+type Kind uint8
+
+const (
+	// Root is the whole document
+	Root Kind = iota
+	// Bracket is a region between an opening and closing bracket, including the brackets
+	Bracket
+	// String is a string or character literal
+	String
+	// Comment is a line or block comment
+	Comment
+	// Indent is a block of lines indented further than the line before them
+	Indent
+	// Node is a segment found by a language specific parser, named by its label
+	Node
+)
+
+var kindNames = map[Kind]string{
+	Root:    "root",
+	Bracket: "bracket",
+	String:  "string",
+	Comment: "comment",
+	Indent:  "indent",
+	Node:    "node",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("kind(%d)", uint8(k))
+}
+
+// Segment is a region of the document that is moved, folded and highlighted as a unit. Segments nest without
+// overlapping and the children of a segment are ordered by their position.
+//
+// The start of a segment is stored relative to the start of its parent, so that an edit only has to adjust the
+// segments that follow it along the path to the root rather than every segment after it in the document.
+type Segment struct {
+	Kind     Kind
+	Label    string
+	Parent   *Segment
+	Children []*Segment
+	// Len is the length of the segment in runes, including its delimiters
+	Len int
+	// Open and Close are the lengths of the opening and closing delimiters. Close is zero if the segment was never
+	// closed.
+	Open  int
+	Close int
+	// Broken is set on segments that are missing their closing delimiter
+	Broken bool
+	// Fixed is set by language parsers on segments that must keep their place, like the package clause of a Go file.
+	// They are not moved and nothing is moved in front of them.
+	Fixed bool
+	// Separator is the text that goes between the children of a container, such as the comma between the elements of
+	// a list, when a language parser knows it
+	Separator string
+	start     int
+}
+
+func (s *Segment) String() string {
+	return fmt.Sprintf("%s %q %d-%d", s.Kind, s.Label, s.Start(), s.End())
+}
+
+// Start returns the offset of the first rune of the segment
+func (s *Segment) Start() (start int) {
+	for ; s != nil; s = s.Parent {
+		start += s.start
+	}
+	return
+}
+
+// End returns the offset after the last rune of the segment
+func (s *Segment) End() int {
+	return s.Start() + s.Len
+}
+
+// Inner returns the range of the segment without its delimiters
+func (s *Segment) Inner() (start, end int) {
+	start = s.Start()
+	return start + s.Open, start + s.Len - s.Close
+}
+
+// Depth returns the number of ancestors of the segment
+func (s *Segment) Depth() (depth int) {
+	for p := s.Parent; p != nil; p = p.Parent {
+		depth++
+	}
+	return
+}
+
+// Container reports whether the segment can hold other segments
+func (s *Segment) Container() bool {
+	switch s.Kind {
+	case String, Comment:
+		return false
+	}
+	return true
+}
+
+// Index returns the position of the segment among its siblings
+func (s *Segment) Index() int {
+	if s.Parent == nil {
+		return 0
+	}
+	sib := s.Parent.Children
+	i := sort.Search(len(sib), func(i int) bool { return sib[i].start >= s.start })
+	if i < len(sib) && sib[i] == s {
+		return i
+	}
+	for i := range sib {
+		if sib[i] == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Siblings returns the other children of the parent of the segment
+func (s *Segment) Siblings() (out []*Segment) {
+	if s.Parent == nil {
+		return
+	}
+	for _, c := range s.Parent.Children {
+		if c != s {
+			out = append(out, c)
+		}
+	}
+	return
+}
+
+// Next returns the sibling after the segment
+func (s *Segment) Next() *Segment {
+	if s.Parent == nil {
+		return nil
+	}
+	if i := s.Index() + 1; i < len(s.Parent.Children) {
+		return s.Parent.Children[i]
+	}
+	return nil
+}
+
+// Prev returns the sibling before the segment
+func (s *Segment) Prev() *Segment {
+	if s.Parent == nil {
+		return nil
+	}
+	if i := s.Index() - 1; i >= 0 {
+		return s.Parent.Children[i]
+	}
+	return nil
+}
+
+// child returns the child of the segment containing the offset relative to the start of the segment. When the offset
+// is between two children the one starting there is returned.
+func (s *Segment) child(rel int) *Segment {
+	ch := s.Children
+	i := sort.Search(len(ch), func(i int) bool { return ch[i].start > rel }) - 1
+	if i >= 0 && rel < ch[i].start+ch[i].Len {
+		return ch[i]
+	}
+	return nil
+}
+
+// Walk calls fn for the segment and its descendants in document order, skipping the descendants of a segment if fn
+// returns false for it
+func (s *Segment) Walk(fn func(s *Segment) bool) {
+	if !fn(s) {
+		return
+	}
+	for _, c := range s.Children {
+		c.Walk(fn)
+	}
+}
+
+// NewSegment creates a segment at an absolute position, for parsers that build trees of their own. The position is
+// made relative when the segment is given to Adopt.
+func NewSegment(kind Kind, label string, start, length int) *Segment {
+	return &Segment{Kind: kind, Label: label, start: start, Len: length}
+}
+
+// Adopt makes the segments children of s. The children must have absolute positions, as given to NewSegment, and
+// their own children are adopted the same way.
+func (s *Segment) Adopt(children ...*Segment) {
+	s.adopt(s.Start(), children)
+}
+
+func (s *Segment) adopt(abs int, children []*Segment) {
+	for _, c := range children {
+		c.Parent = s
+		cabs := c.start
+		c.start -= abs
+		grand := c.Children
+		c.Children = nil
+		c.adopt(cabs, grand)
+	}
+	s.Children = append(s.Children, children...)
+	sort.SliceStable(s.Children, func(i, j int) bool { return s.Children[i].start < s.Children[j].start })
+}
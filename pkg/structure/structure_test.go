@@ -0,0 +1,203 @@
+package structure_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/p9c/glom/pkg/diff"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/structure"
+)
+
+// dump renders a tree as nested kinds, labels and ranges for comparison
+func dump(t *structure.Tree) string {
+	var sb strings.Builder
+	t.Walk(
+		func(s *structure.Segment) bool {
+			fmt.Fprintf(
+				&sb, "%s%s %q %d-%d %v\n", strings.Repeat("  ", s.Depth()), s.Kind, s.Label, s.Start(), s.End(),
+				s.Broken,
+			)
+			return true
+		},
+	)
+	return sb.String()
+}
+
+func TestParse(t *testing.T) {
+	src := `f(a, "x)", '(') // c)
+{ /* ( */ [1, 2] }
+g(`
+	tr := structure.Parse(structure.Runes([]rune(src)), nil)
+	want := `root "" 0-43 false
+  bracket "(" 1-15 false
+    string "\"" 5-9 false
+    string "'" 11-14 false
+  comment "//" 16-21 false
+  bracket "{" 22-40 false
+    comment "/*" 24-31 false
+    bracket "[" 32-38 false
+  bracket "(" 42-43 true
+`
+	if got := dump(tr); got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+	s := tr.Enclosing(33)
+	if s.Label != "[" {
+		t.Fatalf("enclosing segment is %s", s)
+	}
+	if s.Parent.Label != "{" || len(tr.Siblings(s)) != 1 || s.Prev().Kind != structure.Comment {
+		t.Fatalf("unexpected neighbours of %s", s)
+	}
+	if r := tr.EnclosingRange(2, 12); r.Label != "(" || r.Start() != 1 {
+		t.Fatalf("enclosing range is %s", r)
+	}
+}
+
+func TestIndent(t *testing.T) {
+	src := "a:\n  b: 1\n  c:\n    d: 2\n\n    e: [1,\n      2]\nf: 3\n"
+	syn := *structure.Default
+	syn.Indent = true
+	tr := structure.Parse(structure.Runes([]rune(src)), &syn)
+	var blocks []string
+	tr.Walk(
+		func(s *structure.Segment) bool {
+			if s.Kind == structure.Indent {
+				blocks = append(blocks, strings.TrimSpace(src[s.Start():s.End()]))
+			}
+			return true
+		},
+	)
+	want := []string{"b: 1\n  c:\n    d: 2\n\n    e: [1,\n      2]", "d: 2\n\n    e: [1,\n      2]", "2"}
+	if fmt.Sprint(blocks) != fmt.Sprint(want) {
+		t.Fatalf("got blocks %q, want %q", blocks, want)
+	}
+}
+
+// TestBalanced checks that unclosed brackets and literals and stray closers unbalance a text, and delimiters inside
+// literals do not
+func TestBalanced(t *testing.T) {
+	for src, want := range map[string]bool{
+		"":                          true,
+		"f(a, [b], {c})":            true,
+		"f(\")\", ')', `(`) // (\n": true,
+		"/* ( */ x":                 true,
+		"f(a":                       false,
+		"f(a))":                     false,
+		"f(a]":                      false,
+		"x := \"a\nb\"":             false,
+		"x /* y":                    false,
+		"`":                         false,
+	} {
+		if got := structure.Balanced(structure.Runes([]rune(src)), nil); got != want {
+			t.Errorf("%q is balanced %v, want %v", src, got, want)
+		}
+	}
+}
+
+// TestMissing checks the delimiters that complete fragments of text, and that the completed fragments are balanced
+func TestMissing(t *testing.T) {
+	for _, c := range []struct{ src, open, close string }{
+		{"f(a, [b", "", "])"},
+		{"b) + c]", "[(", ""},
+		{"x]) + (y", "([", ")"},
+		{`f("a)`, "", `")`},
+		{"a */ b /* c", "", "*/"},
+		{"s := `(", "", "`"},
+		{"f(a)", "", ""},
+	} {
+		open, close := structure.Missing(structure.Runes([]rune(c.src)), nil)
+		if open != c.open || close != c.close {
+			t.Errorf("%q is missing %q and %q, want %q and %q", c.src, open, close, c.open, c.close)
+		}
+		if whole := open + c.src + close; !structure.Balanced(structure.Runes([]rune(whole)), nil) &&
+			!strings.Contains(c.src, "*/") {
+			t.Errorf("%q completed to %q is not balanced", c.src, whole)
+		}
+	}
+}
+
+// TestUpdate checks that updating a tree after random edits gives the same tree as parsing the result from scratch
+func TestUpdate(t *testing.T) {
+	for _, indent := range []bool{false, true} {
+		syn := *structure.Default
+		syn.Indent = indent
+		rnd := rand.New(rand.NewSource(3))
+		pieces := []string{"(", ")", "{", "}", "[", "]", "\"", "'", "`", "//", "/*", "*/", "\n", "\n  ", "x", " ", "\\"}
+		d := doc.New()
+		if e := d.Insert(0, "func f() {\n\tif x {\n\t\ty(\"}\")\n\t}\n}\n"); e != nil {
+			t.Fatal(e)
+		}
+		tr := structure.Parse(d, &syn)
+		for i := 0; i < 3000; i++ {
+			var e error
+			if n := d.Len(); n > 0 && rnd.Intn(3) == 0 {
+				at := rnd.Intn(n)
+				if rnd.Intn(4) == 0 {
+					l := rnd.Intn(n-at) + 1
+					to := rnd.Intn(n + 1)
+					if to > at && to < at+l {
+						to = at
+					}
+					e = d.Move(at, l, to)
+				} else {
+					e = d.Delete(at, rnd.Intn(minInt(n-at, 4))+1)
+				}
+			} else {
+				e = d.Insert(rnd.Intn(d.Len()+1), pieces[rnd.Intn(len(pieces))])
+			}
+			if e != nil {
+				t.Fatal(e)
+			}
+			tr.Apply(d, d.Log().At(d.Log().Len()-1))
+			full := structure.Parse(d, &syn)
+			if got, want := dump(tr), dump(full); got != want {
+				t.Fatalf(
+					"indent %v edit %d: %s on %q\n%s", indent, i, d.Log().At(d.Log().Len()-1), d.Text(),
+					diff.Format(diff.Lines(want, got)),
+				)
+			}
+		}
+	}
+}
+
+// TestUpdateCost checks that an edit inside a small bracket does not rescan the document
+func TestUpdateCost(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&sb, "func f%d() {\n\tg(%d, h(x))\n}\n", i, i)
+	}
+	d := doc.New()
+	if e := d.Insert(0, sb.String()); e != nil {
+		t.Fatal(e)
+	}
+	tr := structure.Parse(d, nil)
+	full := tr.Cost
+	at := strings.Index(sb.String(), "h(x)") + 2
+	if e := d.Insert(at, "y, "); e != nil {
+		t.Fatal(e)
+	}
+	tr.Apply(d, d.Log().At(1))
+	if tr.Cost > 20 {
+		t.Fatalf("update scanned %d runes of %d", tr.Cost, full)
+	}
+	if e := d.Insert(at, "("); e != nil {
+		t.Fatal(e)
+	}
+	tr.Apply(d, d.Log().At(2))
+	if tr.Cost > 100 {
+		t.Fatalf("unbalancing update scanned %d runes of %d", tr.Cost, full)
+	}
+	if got, want := dump(tr), dump(structure.Parse(d, nil)); got != want {
+		t.Fatal("incremental tree differs from full parse")
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
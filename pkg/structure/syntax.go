@@ -0,0 +1,140 @@
+package structure
+
+import (
+	"sort"
+	"strings"
+)
+
+// Pair is an opening and closing delimiter
+type Pair struct {
+	Open  string
+	Close string
+}
+
+// Quote describes a literal such as a string or character. Escape is the rune that makes the following rune part of
+// the literal, or zero if there is none. A literal that is not Multiline ends at the end of the line even when it is
+// not closed.
+type Quote struct {
+	Open      string
+	Close     string
+	Escape    rune
+	Multiline bool
+}
+
+// Syntax is the set of delimiters that make up the structure of a kind of document
+type Syntax struct {
+	Brackets      []Pair
+	Strings       []Quote
+	LineComments  []string
+	BlockComments []Pair
+	// Indent enables segments for blocks of lines that are indented further than the line before them
+	Indent bool
+	// TabWidth is the number of columns a tab counts for when comparing indentation
+	TabWidth int
+}
+
+// Default is the syntax of the C family of languages, which includes Go
+var Default = &Syntax{
+	Brackets: []Pair{{"(", ")"}, {"[", "]"}, {"{", "}"}},
+	Strings: []Quote{
+		{Open: `"`, Close: `"`, Escape: '\\'},
+		{Open: "'", Close: "'", Escape: '\\'},
+		{Open: "`", Close: "`", Multiline: true},
+	},
+	LineComments:  []string{"//"},
+	BlockComments: []Pair{{"/*", "*/"}},
+	TabWidth:      4,
+}
+
+type tokenKind uint8
+
+const (
+	tokOpen tokenKind = iota
+	tokClose
+	tokQuote
+	tokLineComment
+	tokBlockComment
+)
+
+type token struct {
+	text  []rune
+	kind  tokenKind
+	index int
+}
+
+// matcher finds the delimiters of a syntax in a text
+type matcher struct {
+	syntax *Syntax
+	// byFirst holds the tokens starting with each rune, longest first
+	byFirst map[rune][]token
+	quotes  []Quote
+	blocks  [][]rune
+	// opens maps the opening delimiter of each bracket to its index
+	opens map[string]int
+	// extends is set for brackets whose opening delimiter is the start of a longer delimiter
+	extends []bool
+}
+
+func newMatcher(syn *Syntax) (m *matcher) {
+	m = &matcher{syntax: syn, byFirst: make(map[rune][]token), quotes: syn.Strings, opens: make(map[string]int)}
+	add := func(s string, kind tokenKind, index int) {
+		if s == "" {
+			return
+		}
+		r := []rune(s)
+		m.byFirst[r[0]] = append(m.byFirst[r[0]], token{text: r, kind: kind, index: index})
+	}
+	for i, p := range syn.Brackets {
+		add(p.Open, tokOpen, i)
+		add(p.Close, tokClose, i)
+		m.opens[p.Open] = i
+	}
+	for i, q := range syn.Strings {
+		add(q.Open, tokQuote, i)
+	}
+	for i, c := range syn.LineComments {
+		add(c, tokLineComment, i)
+	}
+	for i, p := range syn.BlockComments {
+		add(p.Open, tokBlockComment, i)
+		m.blocks = append(m.blocks, []rune(p.Close))
+	}
+	for r := range m.byFirst {
+		toks := m.byFirst[r]
+		sort.SliceStable(toks, func(i, j int) bool { return len(toks[i].text) > len(toks[j].text) })
+	}
+	m.extends = make([]bool, len(syn.Brackets))
+	for i, p := range syn.Brackets {
+		if p.Open == "" {
+			continue
+		}
+		for _, t := range m.byFirst[[]rune(p.Open)[0]] {
+			if len(t.text) > len([]rune(p.Open)) && strings.HasPrefix(string(t.text), p.Open) {
+				m.extends[i] = true
+			}
+		}
+	}
+	return
+}
+
+// match returns the delimiter starting at the offset
+func (m *matcher) match(src Source, at, end int) (t token, ok bool) {
+	for _, t = range m.byFirst[src.RuneAt(at)] {
+		if hasPrefix(src, at, end, t.text) {
+			return t, true
+		}
+	}
+	return token{}, false
+}
+
+func hasPrefix(src Source, at, end int, prefix []rune) bool {
+	if at+len(prefix) > end {
+		return false
+	}
+	for i, r := range prefix {
+		if src.RuneAt(at+i) != r {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,314 @@
+// Package structure finds the nested segments of a document, the bracketed regions, literals, comments and indented
+// blocks that glom keeps intact when text is dragged, folded and highlighted, and keeps them up to date as the
+// document is edited.
+package structure
+
+import (
+	"strings"
+
+	"github.com/p9c/glom/pkg/doc"
+)
+
+// Source is the text a tree is built from
+type Source interface {
+	Len() int
+	RuneAt(i int) rune
+}
+
+// Runes is a Source over a slice of runes
+type Runes []rune
+
+// Len returns the number of runes
+func (r Runes) Len() int {
+	return len(r)
+}
+
+// RuneAt returns the rune at the offset
+func (r Runes) RuneAt(i int) rune {
+	return r[i]
+}
+
+// Parser builds the segments of a whole text for a language that has a parser of its own. The root it returns holds
+// the whole text.
+type Parser func(src Source) (root *Segment)
+
+// Tree is the segmentation of a document
+type Tree struct {
+	m      *matcher
+	parser Parser
+	root   *Segment
+	// Cost is the number of runes scanned by the last parse or update
+	Cost int
+}
+
+// Parse builds the segment tree of a text
+func Parse(src Source, syn *Syntax) (t *Tree) {
+	if syn == nil {
+		syn = Default
+	}
+	t = &Tree{m: newMatcher(syn)}
+	t.parseAll(src)
+	return
+}
+
+// ParseWith builds the segment tree of a text with a language parser. The syntax is kept for the delimiters of the
+// language, and edits parse the whole text again with the parser.
+func ParseWith(src Source, syn *Syntax, p Parser) (t *Tree) {
+	if syn == nil {
+		syn = Default
+	}
+	t = &Tree{m: newMatcher(syn), parser: p}
+	t.parseAll(src)
+	return
+}
+
+// Balanced reports whether every bracket, literal and block comment in a text is closed, and every closing bracket
+// closes one
+func Balanced(src Source, syn *Syntax) (ok bool) {
+	if syn == nil {
+		syn = Default
+	}
+	var children []*Segment
+	if children, _, ok = parse(src, newMatcher(syn), 0, src.Len(), 0, true, anyCloser); !ok {
+		return
+	}
+	(&Segment{Children: children}).Walk(
+		func(s *Segment) bool {
+			ok = ok && !s.Broken
+			return ok
+		},
+	)
+	return
+}
+
+// Missing returns the delimiters a fragment of text lacks: the opening brackets of the closing brackets in it that
+// close nothing, in the order they go before it, and the closing delimiters of the brackets, literal or block comment
+// it leaves open, in the order they go after it. A fragment with a literal that is broken by the end of a line cannot
+// be completed, which Balanced tells.
+func Missing(src Source, syn *Syntax) (open, close string) {
+	if syn == nil {
+		syn = Default
+	}
+	p := &parser{src: src, m: newMatcher(syn), end: src.Len(), limit: src.Len()}
+	p.stack = []*frame{{seg: &Segment{Kind: Root}, bracket: -1}}
+	p.run(0, true)
+	for i := len(p.strays) - 1; i >= 0; i-- {
+		open += syn.Brackets[p.strays[i]].Open
+	}
+	// a literal or block comment that runs to the end is the last segment added, inside the innermost open bracket
+	if ch := p.top().seg.Children; len(ch) > 0 {
+		if last := ch[len(ch)-1]; last.Broken && last.start+last.Len == src.Len() {
+			for _, q := range syn.Strings {
+				if last.Kind == String && q.Open == last.Label {
+					close = q.Close
+				}
+			}
+			for _, b := range syn.BlockComments {
+				if last.Kind == Comment && b.Open == last.Label {
+					close = b.Close
+				}
+			}
+		}
+	}
+	for i := len(p.stack) - 1; i > 0; i-- {
+		if b := p.stack[i].bracket; b >= 0 {
+			close += syn.Brackets[b].Close
+		}
+	}
+	return
+}
+
+// Syntax returns the syntax the tree was parsed with
+func (t *Tree) Syntax() *Syntax {
+	return t.m.syntax
+}
+
+// Root returns the segment covering the whole document
+func (t *Tree) Root() *Segment {
+	return t.root
+}
+
+func (t *Tree) parseAll(src Source) {
+	if t.parser != nil {
+		t.root = t.parser(src)
+		t.Cost = src.Len()
+		return
+	}
+	children, scanned, _ := parse(src, t.m, 0, src.Len(), 0, true, noCloser)
+	t.root = &Segment{Kind: Root, Len: src.Len()}
+	t.root.adopt(0, children)
+	t.Cost = scanned
+}
+
+// Apply updates the tree for an event that has been applied to the document the source reads from
+func (t *Tree) Apply(src Source, ev doc.Event) {
+	switch ev.Kind {
+	case doc.Insert:
+		t.update(src, ev.Offset, 0, runeLen(ev.Text), strings.Contains(ev.Text, "\n"))
+	case doc.Delete:
+		t.update(src, ev.Offset, runeLen(ev.Old), 0, strings.Contains(ev.Old, "\n"))
+	case doc.Move:
+		// everything outside of the span from the source to the destination is unchanged
+		removed, inserted := runeLen(ev.Old), runeLen(ev.Text)
+		start, end := ev.Offset, ev.Offset+removed
+		if ev.To < start {
+			start = ev.To
+		}
+		if ev.To > end {
+			end = ev.To
+		}
+		t.update(src, start, end-start, end-start-removed+inserted, true)
+	}
+}
+
+// Update changes the tree to account for the removal of removed runes at the offset and the insertion of inserted
+// runes in their place. The source must already contain the change.
+//
+// Only the interior of the smallest bracket that contains the change is parsed again, widening to its ancestors when
+// the change unbalances it, and the positions of the segments after it are adjusted along the path to the root. The
+// cost of an edit is therefore proportional to the size of the innermost balanced region around it rather than the
+// size of the document.
+//
+// When the syntax has indentation blocks, an edit that adds or removes lines or changes the indentation of a line can
+// change blocks anywhere after it, and the whole document is parsed again. Trees built by a language parser are always
+// parsed again in full.
+func (t *Tree) Update(src Source, at, removed, inserted int) {
+	lines := removed > 0
+	for i := at; i < at+inserted && !lines; i++ {
+		lines = src.RuneAt(i) == '\n'
+	}
+	t.update(src, at, removed, inserted, lines)
+}
+
+func (t *Tree) update(src Source, at, removed, inserted int, lines bool) {
+	delta := inserted - removed
+	t.Cost = 0
+	if t.parser != nil {
+		t.parseAll(src)
+		return
+	}
+	c := t.container(at, at+removed)
+	if t.m.syntax.Indent && (lines || inIndentation(src, at)) {
+		c = t.root
+	}
+	for c != t.root {
+		start := c.Start()
+		innerStart := start + c.Open
+		innerEnd := start + c.Len - c.Close + delta
+		syn := t.m.syntax
+		level := 0
+		if syn.Indent {
+			level = lineIndent(src, start, syn.TabWidth)
+		}
+		closer := anyCloser
+		if !c.Broken {
+			closer = t.m.opens[c.Label]
+		}
+		children, scanned, ok := parse(src, t.m, innerStart, innerEnd, level, false, closer)
+		t.Cost += scanned
+		if !ok {
+			c = containerOf(c.Parent)
+			continue
+		}
+		c.Children = nil
+		c.adopt(start, children)
+		for s := c; s != nil; s = s.Parent {
+			s.Len += delta
+			if s.Parent == nil {
+				break
+			}
+			sib := s.Parent.Children
+			for i := s.Index() + 1; i < len(sib); i++ {
+				sib[i].start += delta
+			}
+		}
+		return
+	}
+	cost := t.Cost
+	t.parseAll(src)
+	t.Cost += cost
+}
+
+// container finds the innermost bracket whose interior contains the range, or the root
+func (t *Tree) container(lo, hi int) (c *Segment) {
+	c = t.root
+	cur, base := t.root, 0
+	for {
+		ch := cur.child(lo - base)
+		if ch == nil || ch.start+base+ch.Len < hi {
+			return
+		}
+		chStart := base + ch.start
+		switch ch.Kind {
+		case Bracket:
+			innerStart := chStart + ch.Open
+			if lo < innerStart || lo == innerStart && t.m.extends[t.m.opens[ch.Label]] ||
+				hi > chStart+ch.Len-ch.Close {
+				return
+			}
+			c = ch
+		case Indent:
+		default:
+			return
+		}
+		cur, base = ch, chStart
+	}
+}
+
+// containerOf returns the nearest bracket or root at or above the segment
+func containerOf(s *Segment) *Segment {
+	for s.Parent != nil && s.Kind != Bracket {
+		s = s.Parent
+	}
+	return s
+}
+
+// Enclosing returns the innermost segment containing the offset, or the root
+func (t *Tree) Enclosing(at int) *Segment {
+	path := t.Path(at)
+	return path[len(path)-1]
+}
+
+// EnclosingRange returns the innermost segment that contains the whole range, or the root
+func (t *Tree) EnclosingRange(start, end int) (s *Segment) {
+	s = t.root
+	base := 0
+	for {
+		ch := s.child(start - base)
+		if ch == nil || base+ch.start+ch.Len < end {
+			return
+		}
+		s, base = ch, base+ch.start
+	}
+}
+
+// Path returns the segments containing the offset from the root down to the innermost
+func (t *Tree) Path(at int) (path []*Segment) {
+	s, base := t.root, 0
+	path = append(path, s)
+	for {
+		ch := s.child(at - base)
+		if ch == nil {
+			return
+		}
+		path = append(path, ch)
+		s, base = ch, base+ch.start
+	}
+}
+
+// Siblings returns the segments beside the segment under the same parent
+func (t *Tree) Siblings(s *Segment) []*Segment {
+	return s.Siblings()
+}
+
+// Walk calls fn for every segment in document order, skipping the descendants of segments fn returns false for
+func (t *Tree) Walk(fn func(s *Segment) bool) {
+	t.root.Walk(fn)
+}
+
+func runeLen(s string) (n int) {
+	for range s {
+		n++
+	}
+	return
+}
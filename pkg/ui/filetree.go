@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"image"
+
+	l "gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"github.com/p9c/gel"
+
+	"github.com/p9c/glom/pkg/workspace"
+)
+
+// FileTree shows the files of a workspace as an indented list. Clicking a directory opens or closes it and clicking a
+// file hands its path to the owner.
+type FileTree struct {
+	*gel.Window
+	root   *workspace.Entry
+	width  unit.Value
+	list   *gel.List
+	opened map[string]bool
+	clicks map[string]*gel.Clickable
+	// active is the file shown in the editor, which is marked in the tree
+	active string
+	onOpen func(path string)
+}
+
+// NewFileTree creates an empty file tree
+func NewFileTree(w *gel.Window) *FileTree {
+	return &FileTree{
+		Window: w,
+		width:  w.TextSize.Scale(14),
+		list:   w.List(),
+		opened: make(map[string]bool),
+		clicks: make(map[string]*gel.Clickable),
+		onOpen: func(string) {},
+	}
+}
+
+// Root sets the tree of files shown, keeping the directories that were open before
+func (t *FileTree) Root(root *workspace.Entry) *FileTree {
+	t.root = root
+	return t
+}
+
+// Width sets the width of the panel
+func (t *FileTree) Width(v unit.Value) *FileTree {
+	t.width = v
+	return t
+}
+
+// SetOpen sets the function called with the path of a file that was clicked
+func (t *FileTree) SetOpen(fn func(path string)) *FileTree {
+	t.onOpen = fn
+	return t
+}
+
+// Active marks the file shown in the editor and opens the directories it is in
+func (t *FileTree) Active(path string) *FileTree {
+	if path == t.active || t.root == nil {
+		return t
+	}
+	t.active = path
+	var above []*workspace.Entry
+	t.root.Walk(
+		func(en *workspace.Entry, depth int) bool {
+			above = append(above[:depth], en)
+			if en.Path == path {
+				for _, dir := range above[:depth] {
+					t.opened[dir.Path] = true
+				}
+			}
+			return en.Dir
+		},
+	)
+	return t
+}
+
+// row is an entry of the tree that is shown and how deep it is
+type row struct {
+	entry *workspace.Entry
+	depth int
+}
+
+// rows returns the entries below the root that are in open directories
+func (t *FileTree) rows() (rows []row) {
+	if t.root == nil {
+		return
+	}
+	for _, c := range t.root.Children {
+		c.Walk(
+			func(en *workspace.Entry, depth int) bool {
+				rows = append(rows, row{en, depth})
+				return en.Dir && t.opened[en.Path]
+			},
+		)
+	}
+	return
+}
+
+// item returns the widget of a row
+func (t *FileTree) item(r row) l.Widget {
+	en := r.entry
+	c, ok := t.clicks[en.Path]
+	if !ok {
+		c = t.Clickable()
+		t.clicks[en.Path] = c
+	}
+	name, color := en.Name, "DocText"
+	if en.Dir {
+		c.SetClick(func() { t.opened[en.Path] = !t.opened[en.Path] })
+		if t.opened[en.Path] {
+			name = "▾ " + name
+		} else {
+			name = "▸ " + name
+		}
+	} else {
+		c.SetClick(func() { t.onOpen(en.Path) })
+		name = "  " + name
+	}
+	background := "Transparent"
+	if en.Path == t.active {
+		background, color = "DocBgHilite", "DocText"
+	}
+	indent := l.Inset{Left: t.TextSize.Scale(float32(r.depth))}
+	return t.ButtonLayout(c).Background(background).Embed(
+		func(gtx l.Context) l.Dimensions {
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			return indent.Layout(gtx, t.Inset(0.125, t.Body2(name).Color(color).MaxLines(1).Fn).Fn)
+		},
+	).Fn
+}
+
+// Fn renders the tree
+func (t *FileTree) Fn(gtx l.Context) l.Dimensions {
+	size := image.Point{X: gtx.Px(t.width), Y: gtx.Constraints.Max.Y}
+	paint.FillShape(gtx.Ops, t.Colors.GetNRGBAFromName("DocBgDim"), clip.Rect{Max: size}.Op())
+	gtx.Constraints = l.Exact(size)
+	rows := t.rows()
+	t.list.Vertical().Length(len(rows)).ListElement(
+		func(gtx l.Context, index int) l.Dimensions {
+			return t.item(rows[index])(gtx)
+		},
+	).Fn(gtx)
+	return l.Dimensions{Size: size}
+}
@@ -0,0 +1,152 @@
+package ui
+
+import (
+	"image"
+
+	"gioui.org/f32"
+	l "gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"github.com/p9c/gel"
+
+	"github.com/p9c/glom/pkg/annotate"
+)
+
+// Note is a note shown in a note column, Y is the height in the column of the segment it is attached to
+type Note struct {
+	ID   string
+	Text string
+	Y    int
+}
+
+// NoteColumn shows notes beside the text they belong to. Each note is lined up with its segment, or pushed down below
+// the note before it when they would overlap. Clicking a note opens it for editing.
+type NoteColumn struct {
+	*gel.Window
+	width  unit.Value
+	gap    unit.Value
+	notes  []Note
+	clicks map[string]*gel.Clickable
+	editor *gel.Editor
+	input  *gel.TextInput
+	// editing is the note open in the editor, which may not exist yet
+	editing  Note
+	onSubmit func(id, text string)
+}
+
+// NewNoteColumn creates an empty note column
+func NewNoteColumn(w *gel.Window) (n *NoteColumn) {
+	n = &NoteColumn{
+		Window:   w,
+		width:    w.TextSize.Scale(20),
+		gap:      w.TextSize.Scale(0.25),
+		clicks:   make(map[string]*gel.Clickable),
+		onSubmit: func(string, string) {},
+	}
+	n.editor = w.Editor().SingleLine().Submit(true).SetSubmit(
+		func(txt string) {
+			ed := n.editing
+			n.editing = Note{}
+			n.onSubmit(ed.ID, txt)
+		},
+	)
+	n.input = w.TextInput(n.editor, "note").Color("DocText")
+	return
+}
+
+// Width sets the width of the column
+func (n *NoteColumn) Width(v unit.Value) *NoteColumn {
+	n.width = v
+	return n
+}
+
+// SetSubmit sets the function called with the text of a note when its editor is submitted
+func (n *NoteColumn) SetSubmit(fn func(id, text string)) *NoteColumn {
+	n.onSubmit = fn
+	return n
+}
+
+// Notes sets the notes shown in the column, in the order of their segments
+func (n *NoteColumn) Notes(notes []Note) *NoteColumn {
+	n.notes = notes
+	return n
+}
+
+// Edit opens a note in the editor, placed at the height y if it is not one of the notes shown
+func (n *NoteColumn) Edit(id, text string, y int) {
+	n.editing = Note{ID: id, Text: text, Y: y}
+	n.editor.SetText(text)
+	n.editor.Focus()
+}
+
+// Editing returns the note open in the editor
+func (n *NoteColumn) Editing() (id string, ok bool) {
+	return n.editing.ID, n.editing.ID != ""
+}
+
+// items returns the notes to draw, with the note being edited in its place among them
+func (n *NoteColumn) items() (items []Note) {
+	placed := n.editing.ID == ""
+	for _, nt := range n.notes {
+		if !placed && n.editing.ID == nt.ID {
+			placed = true
+		}
+		if !placed && n.editing.Y < nt.Y {
+			items, placed = append(items, n.editing), true
+		}
+		items = append(items, nt)
+	}
+	if !placed {
+		items = append(items, n.editing)
+	}
+	return
+}
+
+// note returns the widget of a note
+func (n *NoteColumn) note(nt Note) l.Widget {
+	if nt.ID == n.editing.ID {
+		return n.Inset(0.25, n.input.Fn).Fn
+	}
+	c, ok := n.clicks[nt.ID]
+	if !ok {
+		c = n.Clickable()
+		n.clicks[nt.ID] = c
+	}
+	id, txt, y := nt.ID, nt.Text, nt.Y
+	c.SetClick(func() { n.Edit(id, txt, y) })
+	return n.ButtonLayout(c).Background("Transparent").Embed(
+		n.Inset(0.25, n.Body2(txt).Color("DocText").Fn).Fn,
+	).Fn
+}
+
+// Fn renders the column
+func (n *NoteColumn) Fn(gtx l.Context) l.Dimensions {
+	size := image.Point{X: gtx.Px(n.width), Y: gtx.Constraints.Max.Y}
+	paint.FillShape(gtx.Ops, n.Colors.GetNRGBAFromName("DocBgDim"), clip.Rect{Max: size}.Op())
+	items := n.items()
+	calls := make([]op.CallOp, len(items))
+	want := make([]int, len(items))
+	heights := make([]int, len(items))
+	for i, nt := range items {
+		cgtx := gtx
+		cgtx.Constraints = l.Constraints{Min: image.Point{X: size.X}, Max: image.Point{X: size.X, Y: size.Y}}
+		macro := op.Record(gtx.Ops)
+		dims := n.note(nt)(cgtx)
+		calls[i] = macro.Stop()
+		want[i], heights[i] = nt.Y, dims.Size.Y
+	}
+	ys := annotate.Stack(want, heights, gtx.Px(n.gap))
+	rule := n.Colors.GetNRGBAFromName("Primary")
+	w := gtx.Px(unit.Dp(2))
+	for i := range calls {
+		// the rule beside a note reaches up to its segment when the note was pushed down
+		paint.FillShape(gtx.Ops, rule, clip.Rect(image.Rect(0, want[i], w, ys[i]+heights[i])).Op())
+		stack := op.Save(gtx.Ops)
+		op.Offset(f32.Pt(0, float32(ys[i]))).Add(gtx.Ops)
+		calls[i].Add(gtx.Ops)
+		stack.Load()
+	}
+	return l.Dimensions{Size: size}
+}
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	l "gioui.org/layout"
+	"github.com/p9c/gel"
+)
+
+// Tabs is a row with a tab for each open file, the active one drawn in the color of the document. Clicking a tab
+// selects it and clicking the cross on it closes it.
+type Tabs struct {
+	*gel.Window
+	names    []string
+	active   int
+	selects  []*gel.Clickable
+	closes   []*gel.Clickable
+	onSelect func(i int)
+	onClose  func(i int)
+}
+
+// NewTabs creates a row without tabs
+func NewTabs(w *gel.Window) *Tabs {
+	return &Tabs{Window: w, onSelect: func(int) {}, onClose: func(int) {}}
+}
+
+// Tabs sets the names on the tabs and which of them is active
+func (t *Tabs) Tabs(names []string, active int) *Tabs {
+	t.names, t.active = names, active
+	for len(t.selects) < len(names) {
+		t.selects, t.closes = append(t.selects, t.Clickable()), append(t.closes, t.Clickable())
+	}
+	return t
+}
+
+// SetSelect sets the function called with the index of a tab that was clicked
+func (t *Tabs) SetSelect(fn func(i int)) *Tabs {
+	t.onSelect = fn
+	return t
+}
+
+// SetClose sets the function called with the index of a tab whose cross was clicked
+func (t *Tabs) SetClose(fn func(i int)) *Tabs {
+	t.onClose = fn
+	return t
+}
+
+// tab returns the widget of a tab
+func (t *Tabs) tab(i int) l.Widget {
+	t.selects[i].SetClick(func() { t.onSelect(i) })
+	t.closes[i].SetClick(func() { t.onClose(i) })
+	background, color := "DocBgDim", "DocTextDim"
+	if i == t.active {
+		background, color = "DocBg", "DocText"
+	}
+	return t.ButtonLayout(t.selects[i]).Background(background).Embed(
+		t.Inset(
+			0.25,
+			t.Flex().
+				Rigid(t.Body2(t.names[i]).Color(color).MaxLines(1).Fn).
+				Rigid(
+					t.ButtonLayout(t.closes[i]).Background("Transparent").Embed(
+						t.Inset(0.125, t.Body2("×").Color(color).Fn).Fn,
+					).Fn,
+				).
+				Fn,
+		).Fn,
+	).Fn
+}
+
+// Fn renders the row
+func (t *Tabs) Fn(gtx l.Context) l.Dimensions {
+	if len(t.names) == 0 {
+		return l.Dimensions{}
+	}
+	f := t.Flex()
+	for i := range t.names {
+		f.Rigid(t.tab(i))
+	}
+	return f.Fn(gtx)
+}
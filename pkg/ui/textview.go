@@ -0,0 +1,582 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"unicode/utf8"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	l "gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/text"
+	"gioui.org/unit"
+	"github.com/p9c/gel"
+	"github.com/p9c/gel/fonts/p9fonts"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextView draws a text in a monospaced font and maps between positions in the view and offsets in the text. Lines
+// can be wrapped at the width of the view and numbered in a gutter on the left. Only the rows that are scrolled into
+// view are shaped and drawn, so the cost of a frame does not grow with the length of the text. The pointer events over
+// the view are delivered to the view as the tag, for the owner to handle with OffsetAt.
+type TextView struct {
+	*gel.Window
+	shaper   *text.Cache
+	font     text.Font
+	size     unit.Value
+	color    string
+	tabWidth int
+	src      string
+	text     []rune
+	// lines holds the offset of the start of each line and rows the start of each row it is drawn in
+	lines []int
+	rows  []int
+	// wrap breaks lines at the width of the view, wrapAt is the column the rows were broken at or zero for none
+	wrap   bool
+	wrapAt int
+	gutter bool
+	// top is the distance in pixels the text is scrolled up by and view the size of the view on the last frame
+	top        int
+	view       image.Point
+	highlights []highlight
+	tints      []tint
+	// advance and height are the width of a character and the height of a line in pixels on the last frame
+	advance int
+	height  int
+	ascent  int
+}
+
+type highlight struct {
+	start, end int
+	color      color.NRGBA
+	// bar is set for a thin mark in front of the start instead of a filled range
+	bar bool
+}
+
+// tint is a range of the text drawn in a color of its own
+type tint struct {
+	start, end int
+	color      color.NRGBA
+}
+
+// NewTextView creates a text view in the monospaced Go font
+func NewTextView(w *gel.Window) *TextView {
+	return &TextView{
+		Window:   w,
+		shaper:   text.NewCache(p9fonts.Collection()),
+		font:     p9fonts.Fonts["go regular"],
+		size:     w.TextSize,
+		color:    "DocText",
+		tabWidth: 4,
+		lines:    []int{0},
+		rows:     []int{0},
+	}
+}
+
+// Text sets the text shown in the view. Only the lines between the start and end the text has in common with the last
+// one are scanned again, so a small edit to a long text is cheap.
+func (v *TextView) Text(txt string) *TextView {
+	if txt == v.src {
+		return v
+	}
+	old := v.src
+	pre := prefix(old, txt)
+	suf := suffix(old[pre:], txt[pre:])
+	for pre > 0 && (pre < len(old) && !utf8.RuneStart(old[pre]) || pre < len(txt) && !utf8.RuneStart(txt[pre])) {
+		pre--
+	}
+	for suf > 0 && !utf8.RuneStart(txt[len(txt)-suf]) {
+		suf--
+	}
+	v.src = txt
+	start := utf8.RuneCountInString(txt[:pre])
+	end := len(v.text) - utf8.RuneCountInString(txt[len(txt)-suf:])
+	mid := []rune(txt[pre : len(txt)-suf])
+	delta := len(mid) - (end - start)
+	// the runes after the change are moved into place before the new ones are copied in
+	size := len(v.text)
+	if delta > 0 {
+		v.text = append(v.text, make([]rune, delta)...)
+	}
+	copy(v.text[start+len(mid):], v.text[end:size])
+	v.text = v.text[:size+delta]
+	copy(v.text[start:], mid)
+	// lines and rows after the change keep their breaks and only move
+	first := search(v.lines, start)
+	next := first + 1
+	for next < len(v.lines) && v.lines[next] <= end {
+		next++
+	}
+	var lineTail, rowTail []int
+	if next < len(v.lines) {
+		lineTail = shift(v.lines[next:], delta)
+		rowTail = shift(v.rows[search(v.rows, v.lines[next]):], delta)
+	}
+	v.lines = v.lines[:first+1]
+	for i, r := range mid {
+		if r == '\n' {
+			v.lines = append(v.lines, start+i+1)
+		}
+	}
+	flowed := len(v.lines)
+	v.lines = append(v.lines, lineTail...)
+	v.rows = append(v.flow(v.rows[:search(v.rows, v.lines[first])], first, flowed), rowTail...)
+	return v
+}
+
+// prefix returns the number of bytes at the start of two strings that are the same
+func prefix(a, b string) (n int) {
+	const chunk = 1 << 12
+	for n+chunk <= len(a) && n+chunk <= len(b) && a[n:n+chunk] == b[n:n+chunk] {
+		n += chunk
+	}
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return
+}
+
+// suffix returns the number of bytes at the end of two strings that are the same
+func suffix(a, b string) (n int) {
+	const chunk = 1 << 12
+	for n+chunk <= len(a) && n+chunk <= len(b) && a[len(a)-n-chunk:len(a)-n] == b[len(b)-n-chunk:len(b)-n] {
+		n += chunk
+	}
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	return
+}
+
+// shift returns a copy of offsets moved by a distance
+func shift(offsets []int, delta int) (out []int) {
+	out = make([]int, len(offsets))
+	for i, at := range offsets {
+		out[i] = at + delta
+	}
+	return
+}
+
+// Wrap sets whether lines longer than the view is wide are continued on the rows below
+func (v *TextView) Wrap(wrap bool) *TextView {
+	v.wrap = wrap
+	return v
+}
+
+// Gutter sets whether the lines are numbered in a gutter on the left
+func (v *TextView) Gutter(show bool) *TextView {
+	v.gutter = show
+	return v
+}
+
+// Color sets the theme color of the text
+func (v *TextView) Color(color string) *TextView {
+	v.color = color
+	return v
+}
+
+// TextScale sets the size of the text relative to the theme text size
+func (v *TextView) TextScale(scale float32) *TextView {
+	v.size = v.TextSize.Scale(scale)
+	return v
+}
+
+// Font sets the font of the text by its name in the fonts glom is built with, which must be monospaced
+func (v *TextView) Font(name string) *TextView {
+	if f, ok := p9fonts.Fonts[name]; ok {
+		v.font = f
+	}
+	return v
+}
+
+// FontSize sets the size of the text
+func (v *TextView) FontSize(size unit.Value) *TextView {
+	v.size = size
+	return v
+}
+
+// TabWidth sets the number of columns between tab stops
+func (v *TextView) TabWidth(n int) *TextView {
+	if n < 1 {
+		n = 1
+	}
+	if n != v.tabWidth {
+		v.tabWidth = n
+		v.reflow()
+	}
+	return v
+}
+
+// Highlight fills the background of a range of the text with a color on the next frame
+func (v *TextView) Highlight(start, end int, c color.NRGBA) {
+	v.highlights = append(v.highlights, highlight{start: start, end: end, color: c})
+}
+
+// Bar draws a thin mark in front of the character at the offset on the next frame, such as a drop indicator
+func (v *TextView) Bar(at int, c color.NRGBA) {
+	v.highlights = append(v.highlights, highlight{start: at, end: at, color: c, bar: true})
+}
+
+// Tint draws a range of the text in a color of its own on the next frame, such as a token of a language. Ranges are
+// given in order and do not overlap.
+func (v *TextView) Tint(start, end int, c color.NRGBA) {
+	if end > start {
+		v.tints = append(v.tints, tint{start: start, end: end, color: c})
+	}
+}
+
+// Caret returns the position in the view of the top left corner of the character at the offset
+func (v *TextView) Caret(at int) image.Point {
+	return image.Pt(v.gutterWidth()+v.column(at)*v.advance, v.row(at)*v.height-v.top)
+}
+
+// ScrollBy scrolls the text up by a distance in pixels, or down for a negative distance
+func (v *TextView) ScrollBy(dy int) {
+	v.top += dy
+	v.clamp()
+}
+
+// ScrollTo scrolls the view as little as needed for the row with the offset to be in it
+func (v *TextView) ScrollTo(at int) {
+	y := v.row(at) * v.height
+	switch {
+	case y < v.top:
+		v.top = y
+	case y+v.height > v.top+v.view.Y:
+		v.top = y + v.height - v.view.Y
+	}
+	v.clamp()
+}
+
+// clamp keeps the scroll position between the start of the text and its last row at the top of the view
+func (v *TextView) clamp() {
+	if max := (len(v.rows) - 1) * v.height; v.top > max {
+		v.top = max
+	}
+	if v.top < 0 {
+		v.top = 0
+	}
+}
+
+// Visible returns the range of the text in the rows inside the view on the last frame
+func (v *TextView) Visible() (start, end int) {
+	first, last := v.visibleRows()
+	return v.rows[first], v.rowEnd(last - 1)
+}
+
+// Rows returns the number of whole rows that fit in the view on the last frame
+func (v *TextView) Rows() int {
+	if v.height == 0 {
+		return 0
+	}
+	return v.view.Y / v.height
+}
+
+// visibleRows returns the first row in the view and the one after the last
+func (v *TextView) visibleRows() (first, last int) {
+	if v.height == 0 {
+		return 0, len(v.rows)
+	}
+	first, last = v.top/v.height, (v.top+v.view.Y)/v.height+1
+	if first >= len(v.rows) {
+		first = len(v.rows) - 1
+	}
+	if last > len(v.rows) {
+		last = len(v.rows)
+	}
+	return
+}
+
+// reflow breaks all of the lines into rows again
+func (v *TextView) reflow() {
+	v.rows = v.flow(v.rows[:0], 0, len(v.lines))
+}
+
+// flow appends the rows of the lines from first up to last to rows. Lines are broken at the wrap column, after the
+// last space before it where there is one.
+func (v *TextView) flow(rows []int, first, last int) []int {
+	for i := first; i < last; i++ {
+		start := v.lines[i]
+		rows = append(rows, start)
+		if v.wrapAt == 0 {
+			continue
+		}
+		end := len(v.text)
+		if i+1 < len(v.lines) {
+			end = v.lines[i+1] - 1
+		}
+		col, rowStart, space := 0, start, -1
+		for at := start; at < end; at++ {
+			r := v.text[at]
+			next := v.advanceColumn(col, r)
+			if next > v.wrapAt && at > rowStart {
+				brk := at
+				if space >= rowStart {
+					brk = space + 1
+				}
+				rows = append(rows, brk)
+				rowStart, space, col = brk, -1, 0
+				for j := brk; j < at; j++ {
+					col = v.advanceColumn(col, v.text[j])
+				}
+				next = v.advanceColumn(col, r)
+			}
+			if r == ' ' || r == '\t' {
+				space = at
+			}
+			col = next
+		}
+	}
+	return rows
+}
+
+// row returns the row containing the offset
+func (v *TextView) row(at int) int {
+	return search(v.rows, at)
+}
+
+// search returns the index of the last of the ascending starts that is not after the offset
+func search(starts []int, at int) int {
+	lo, hi := 0, len(starts)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if starts[mid] <= at {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// rowEnd returns the offset after the last character of a row, which is the line break ending it if it has one
+func (v *TextView) rowEnd(row int) int {
+	if row+1 >= len(v.rows) {
+		return len(v.text)
+	}
+	next := v.rows[row+1]
+	if v.text[next-1] == '\n' {
+		return next - 1
+	}
+	return next
+}
+
+// column returns the column the offset is drawn at on its row, counting tabs to the next tab stop
+func (v *TextView) column(at int) (col int) {
+	for i := v.rows[v.row(at)]; i < at; i++ {
+		col = v.advanceColumn(col, v.text[i])
+	}
+	return
+}
+
+func (v *TextView) advanceColumn(col int, r rune) int {
+	if r == '\t' {
+		return col + v.tabWidth - col%v.tabWidth
+	}
+	return col + 1
+}
+
+// gutterWidth returns the width of the line numbers and the space after them
+func (v *TextView) gutterWidth() int {
+	if !v.gutter {
+		return 0
+	}
+	return (digits(len(v.lines)) + 2) * v.advance
+}
+
+func digits(n int) (d int) {
+	for d = 1; n >= 10; n /= 10 {
+		d++
+	}
+	return
+}
+
+// OffsetAt returns the offset of the character under a position in the view. Positions past the end of a row give
+// the offset after its last character and positions in the gutter the start of the row.
+func (v *TextView) OffsetAt(p f32.Point) int {
+	if v.height == 0 || v.advance == 0 {
+		return 0
+	}
+	y := int(p.Y) + v.top
+	row := y / v.height
+	switch {
+	case y < 0:
+		return 0
+	case row >= len(v.rows):
+		return len(v.text)
+	}
+	x := (int(p.X) - v.gutterWidth()) / v.advance
+	col := 0
+	end := v.rowEnd(row)
+	for i := v.rows[row]; i < end; i++ {
+		if col = v.advanceColumn(col, v.text[i]); col > x {
+			return i
+		}
+	}
+	return end
+}
+
+// Rects returns the rectangles in the view covering a range of the text, one for each row it spans
+func (v *TextView) Rects(start, end int) (rects []image.Rectangle) {
+	if end <= start {
+		return
+	}
+	startRow := v.row(start)
+	first, last := startRow, v.row(end-1)
+	// rows outside of the view are left out
+	top, bottom := v.visibleRows()
+	if first < top {
+		first = top
+	}
+	if last >= bottom {
+		last = bottom - 1
+	}
+	gw := v.gutterWidth()
+	for row := first; row <= last; row++ {
+		from, to := v.rows[row], v.rowEnd(row)
+		if row == startRow {
+			from = start
+		}
+		// ranges running over the end of a row cover the rest of it
+		wide := end > to
+		if !wide {
+			to = end
+		}
+		x0, x1 := v.column(from)*v.advance, v.column(to)*v.advance
+		if wide {
+			x1 += v.advance
+		}
+		y := row*v.height - v.top
+		rects = append(rects, image.Rect(gw+x0, y, gw+x1, y+v.height))
+	}
+	return
+}
+
+// measure finds the size of a character and a line at the current text size
+func (v *TextView) measure(gtx l.Context) fixed.Int26_6 {
+	size := fixed.I(gtx.Px(v.size))
+	if lines := v.shaper.LayoutString(v.font, size, 1<<20, "m"); len(lines) > 0 {
+		v.advance = lines[0].Width.Ceil()
+		v.ascent = lines[0].Ascent.Ceil()
+		v.height = (lines[0].Ascent + lines[0].Descent).Ceil()
+	}
+	return size
+}
+
+// Fn renders the rows of the text inside the view with the highlights and tints added since the last frame. The view
+// takes all the space it is given.
+func (v *TextView) Fn(gtx l.Context) l.Dimensions {
+	size := v.measure(gtx)
+	dims := gtx.Constraints.Max
+	v.view = dims
+	gw := v.gutterWidth()
+	wrapAt := 0
+	if v.wrap && v.advance > 0 {
+		if wrapAt = (dims.X - gw) / v.advance; wrapAt < 1 {
+			wrapAt = 1
+		}
+	}
+	if wrapAt != v.wrapAt {
+		v.wrapAt = wrapAt
+		v.reflow()
+	}
+	v.clamp()
+	defer op.Save(gtx.Ops).Load()
+	clip.Rect{Max: dims}.Add(gtx.Ops)
+	pointer.Rect(image.Rectangle{Max: dims}).Add(gtx.Ops)
+	pointer.InputOp{
+		Tag: v,
+		Types: pointer.Move | pointer.Enter | pointer.Leave | pointer.Scroll | pointer.Press | pointer.Drag |
+			pointer.Release,
+		ScrollBounds: image.Rect(-1<<20, -1<<20, 1<<20, 1<<20),
+	}.Add(gtx.Ops)
+	for _, h := range v.highlights {
+		if h.bar {
+			p := v.Caret(h.start)
+			w := v.advance / 6
+			if w < 2 {
+				w = 2
+			}
+			paint.FillShape(gtx.Ops, h.color, clip.Rect(image.Rect(p.X-w/2, p.Y, p.X+w-w/2, p.Y+v.height)).Op())
+			continue
+		}
+		for _, r := range v.Rects(h.start, h.end) {
+			paint.FillShape(gtx.Ops, h.color, clip.Rect(r).Op())
+		}
+	}
+	v.highlights = v.highlights[:0]
+	first, last := v.visibleRows()
+	col := v.Colors.GetNRGBAFromName(v.color)
+	dim := v.Colors.GetNRGBAFromName("DocTextDim")
+	tints := v.tints
+	for row := first; row < last; row++ {
+		y := row*v.height - v.top + v.ascent
+		start, end := v.rows[row], v.rowEnd(row)
+		if line := search(v.lines, start); gw > 0 && v.lines[line] == start {
+			num := strconv.Itoa(line + 1)
+			v.draw(gtx, size, num, image.Pt((digits(len(v.lines))-len(num))*v.advance+v.advance/2, y), dim)
+		}
+		// the row is drawn in pieces between the tinted ranges
+		for len(tints) > 0 && tints[0].end <= start {
+			tints = tints[1:]
+		}
+		at := start
+		for _, t := range tints {
+			if t.start >= end {
+				break
+			}
+			if t.start > at {
+				v.draw(gtx, size, v.expand(at, t.start), image.Pt(gw+v.column(at)*v.advance, y), col)
+				at = t.start
+			}
+			to := t.end
+			if to > end {
+				to = end
+			}
+			v.draw(gtx, size, v.expand(at, to), image.Pt(gw+v.column(at)*v.advance, y), t.color)
+			at = to
+		}
+		v.draw(gtx, size, v.expand(at, end), image.Pt(gw+v.column(at)*v.advance, y), col)
+	}
+	v.tints = v.tints[:0]
+	return l.Dimensions{Size: dims}
+}
+
+// draw shapes a string and paints it with its baseline starting at a point
+func (v *TextView) draw(gtx l.Context, size fixed.Int26_6, s string, at image.Point, c color.NRGBA) {
+	if s == "" {
+		return
+	}
+	lines := v.shaper.LayoutString(v.font, size, 1<<20, s)
+	if len(lines) == 0 {
+		return
+	}
+	stack := op.Save(gtx.Ops)
+	op.Offset(f32.Pt(float32(at.X), float32(at.Y))).Add(gtx.Ops)
+	paint.ColorOp{Color: c}.Add(gtx.Ops)
+	v.shaper.Shape(v.font, size, lines[0].Layout).Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	stack.Load()
+}
+
+// expand returns a range of a row with its tabs replaced by spaces up to the next tab stop
+func (v *TextView) expand(start, end int) string {
+	out := make([]rune, 0, end-start)
+	col := v.column(start)
+	for _, r := range v.text[start:end] {
+		next := v.advanceColumn(col, r)
+		if r == '\t' {
+			for ; col < next; col++ {
+				out = append(out, ' ')
+			}
+			continue
+		}
+		out = append(out, r)
+		col = next
+	}
+	return string(out)
+}
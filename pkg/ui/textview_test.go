@@ -0,0 +1,197 @@
+package ui_test
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/gpu/headless"
+	l "gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/unit"
+	"github.com/p9c/qu"
+
+	"github.com/p9c/glom/pkg/ui"
+)
+
+const width, height = 400, 300
+
+// frame lays out the view once in a context of a fixed size
+func frame(v *ui.TextView, ops *op.Ops) {
+	ops.Reset()
+	gtx := l.Context{
+		Ops:         ops,
+		Now:         time.Now(),
+		Metric:      unit.Metric{PxPerDp: 1, PxPerSp: 1},
+		Constraints: l.Exact(image.Pt(width, height)),
+	}
+	v.Fn(gtx)
+}
+
+func TestTextView(t *testing.T) {
+	v := ui.NewTextView(ui.NewWindow(qu.T())).Wrap(true).Gutter(true)
+	long := strings.Repeat("word ", 40)
+	txt := "package main\n\n\tfunc main() {}\n" + long + "\n" + strings.Repeat("x", 120) + "\nend\n"
+	v.Text(txt)
+	ops := new(op.Ops)
+	frame(v, ops)
+	runes := []rune(txt)
+	gutter := v.Caret(0).X
+	if gutter <= 0 {
+		t.Fatal("the gutter has no width")
+	}
+	advance := v.Caret(1).X - gutter
+	for at := 0; at <= len(runes); at++ {
+		p := v.Caret(at)
+		if at < len(runes) && runes[at] != '\n' && p.X+advance > width {
+			t.Errorf("offset %d is drawn past the edge at %v", at, p)
+		}
+		if got := v.OffsetAt(f32.Pt(float32(p.X)+1, float32(p.Y)+1)); got != at {
+			t.Errorf("offset %d is at %v which maps back to %d", at, p, got)
+		}
+	}
+	// the long line was wrapped after a space
+	start := strings.Index(txt, long)
+	row := v.Caret(start).Y
+	for at := start; at < start+len(long); at++ {
+		if p := v.Caret(at); p.Y != row {
+			if runes[at-1] != ' ' {
+				t.Errorf("the row before offset %d ends with %q", at, runes[at-1])
+			}
+			row = p.Y
+		}
+	}
+	if rects := v.Rects(start, start+len(long)); len(rects) < 2 {
+		t.Errorf("the wrapped line is covered by %d rects", len(rects))
+	}
+	// tints are drawn in pieces of the rows they run over
+	v.Tint(0, 7, color.NRGBA{R: 0xff, A: 0xff})
+	v.Tint(start+3, start+len(long), color.NRGBA{B: 0xff, A: 0xff})
+	frame(v, ops)
+	// scrolling moves the text up and leaves the rows above the view out of what is visible
+	v.ScrollTo(len(runes))
+	frame(v, ops)
+	v.ScrollBy(-v.Caret(0).Y)
+	if v.Caret(0).Y != 0 {
+		t.Errorf("scrolled back to %v", v.Caret(0))
+	}
+	v.ScrollBy(1 << 20)
+	frame(v, ops)
+	if first, _ := v.Visible(); first == 0 {
+		t.Error("the start is visible after scrolling to the end")
+	}
+}
+
+// document returns a text of some lines of Go like code
+func document(lines int) string {
+	var sb strings.Builder
+	for i := 0; i < lines; i++ {
+		switch i % 4 {
+		case 0:
+			sb.WriteString("func (s *State) Fn(gtx l.Context) l.Dimensions {\n")
+		case 1:
+			sb.WriteString("\treturn s.Flex().Rigid(s.Files.Fn).Flexed(1, s.editor).Fn(gtx) // a comment to make it longer\n")
+		case 2:
+			sb.WriteString("}\n")
+		default:
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+func benchmarkFrames(b *testing.B, wrap bool, render func(ops *op.Ops)) {
+	v := ui.NewTextView(ui.NewWindow(qu.T())).Wrap(wrap).Gutter(true)
+	v.Text(document(50000))
+	ops := new(op.Ops)
+	frame(v, ops)
+	v.ScrollBy(1 << 20 / 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// each frame scrolls and highlights like the pointer moving over the text
+		v.ScrollBy(7)
+		start, end := v.Visible()
+		v.Highlight(start, (start+end)/2, color.NRGBA{A: 0x40})
+		frame(v, ops)
+		if render != nil {
+			render(ops)
+		}
+	}
+}
+
+func BenchmarkTextView50k(b *testing.B) {
+	benchmarkFrames(b, false, nil)
+}
+
+func BenchmarkTextView50kWrapped(b *testing.B) {
+	benchmarkFrames(b, true, nil)
+}
+
+// BenchmarkTextView50kHeadless also renders the frames with the GPU, and is skipped where no GPU context can be made
+func BenchmarkTextView50kHeadless(b *testing.B) {
+	w, e := headless.NewWindow(width, height)
+	if e != nil {
+		b.Skip("no headless window:", e)
+	}
+	defer w.Release()
+	benchmarkFrames(
+		b, true, func(ops *op.Ops) {
+			if e := w.Frame(ops); e != nil {
+				b.Fatal(e)
+			}
+		},
+	)
+}
+
+// BenchmarkTextView50kEdit sets a changed text before each frame, as typing does
+func BenchmarkTextView50kEdit(b *testing.B) {
+	v := ui.NewTextView(ui.NewWindow(qu.T())).Wrap(true).Gutter(true)
+	texts := [2]string{document(50000), document(50000) + "x"}
+	ops := new(op.Ops)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v.Text(texts[i%2])
+		frame(v, ops)
+	}
+}
+
+// TestTextViewEdits checks that a view given a changed text maps offsets as one given the text from the start
+func TestTextViewEdits(t *testing.T) {
+	w := ui.NewWindow(qu.T())
+	edited := ui.NewTextView(w).Wrap(true).Gutter(true)
+	ops := new(op.Ops)
+	txt := document(40)
+	edited.Text(txt)
+	frame(edited, ops)
+	for i, ed := range []struct {
+		at, del int
+		ins     string
+	}{
+		{0, 0, "// héllo\n"},
+		{10, 3, ""},
+		{50, 0, strings.Repeat("long words to wrap ", 10)},
+		{120, 40, "\n\n"},
+		{len(txt) / 2, 0, "ü"},
+		{5, 200, "x"},
+		{len(txt) - 300, 300, ""},
+	} {
+		runes := []rune(txt)
+		if ed.at+ed.del > len(runes) {
+			ed.at = len(runes) - ed.del
+		}
+		txt = string(runes[:ed.at]) + ed.ins + string(runes[ed.at+ed.del:])
+		edited.Text(txt)
+		frame(edited, ops)
+		fresh := ui.NewTextView(w).Wrap(true).Gutter(true)
+		fresh.Text(txt)
+		frame(fresh, ops)
+		for at := 0; at <= len([]rune(txt)); at++ {
+			if a, b := edited.Caret(at), fresh.Caret(at); a != b {
+				t.Fatalf("after edit %d offset %d is at %v, want %v", i, at, a, b)
+			}
+		}
+	}
+}
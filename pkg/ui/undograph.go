@@ -0,0 +1,232 @@
+// Package ui contains the widgets that make up the glom editor window, built on gel and Gio.
+package ui
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/io/pointer"
+	l "gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"github.com/p9c/gel"
+
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// UndoGraph draws the branching history of a document as a graph of nodes. Hovering a node previews the text at that
+// node and clicking it switches the document to that timeline. The graph appears when the history changes and fades
+// away after a while without activity.
+type UndoGraph struct {
+	*gel.Window
+	tree    *undo.Tree
+	timeout time.Duration
+	fade    time.Duration
+	spacing unit.Value
+	shown   time.Time
+	hovered int
+	preview string
+	// previewKey is the hovered node and document state the preview was made for
+	previewKey [3]int
+	// seen is the current node and size of the tree on the last frame, a change shows the graph
+	seen  [2]int
+	first int
+}
+
+// NewUndoGraph creates a graph of the history in the tree
+func NewUndoGraph(w *gel.Window, t *undo.Tree) *UndoGraph {
+	return &UndoGraph{
+		Window:  w,
+		tree:    t,
+		timeout: 3 * time.Second,
+		fade:    time.Second,
+		spacing: unit.Dp(20),
+		hovered: -1,
+	}
+}
+
+// Tree sets the history shown in the graph
+func (g *UndoGraph) Tree(t *undo.Tree) *UndoGraph {
+	if t != g.tree {
+		g.tree, g.hovered, g.preview, g.previewKey = t, -1, "", [3]int{-1, -1, -1}
+	}
+	return g
+}
+
+// Timeout sets how long the graph stays fully visible after the last activity
+func (g *UndoGraph) Timeout(d time.Duration) *UndoGraph {
+	g.timeout = d
+	return g
+}
+
+// Spacing sets the distance between rows and columns of the graph
+func (g *UndoGraph) Spacing(v unit.Value) *UndoGraph {
+	g.spacing = v
+	return g
+}
+
+// Show makes the graph fully visible and restarts the timeout
+func (g *UndoGraph) Show() {
+	g.shown = time.Now()
+}
+
+// Preview returns the text of the node under the pointer
+func (g *UndoGraph) Preview() (text string, ok bool) {
+	if g.hovered < 0 {
+		return "", false
+	}
+	return g.preview, true
+}
+
+// opacity returns how visible the graph is at the time
+func (g *UndoGraph) opacity(now time.Time) float32 {
+	if g.hovered >= 0 {
+		return 1
+	}
+	since := now.Sub(g.shown)
+	switch {
+	case since < g.timeout:
+		return 1
+	case since > g.timeout+g.fade:
+		return 0
+	}
+	return 1 - float32(since-g.timeout)/float32(g.fade)
+}
+
+// Fn renders the graph
+func (g *UndoGraph) Fn(gtx l.Context) l.Dimensions {
+	cur := g.tree.Current()
+	if seen := [2]int{cur.ID, g.tree.Len()}; seen != g.seen {
+		g.seen = seen
+		g.shown = gtx.Now
+	}
+	places, columns := g.tree.Layout()
+	step := float32(gtx.Px(g.spacing))
+	radius := step / 4
+	size := image.Point{X: int(step * float32(columns+1)), Y: gtx.Constraints.Max.Y}
+	// keep the current node in view when the tree is taller than the space for it
+	rows := int(float32(size.Y)/step) - 1
+	if cur.Depth < g.first || cur.Depth >= g.first+rows {
+		g.first = cur.Depth - rows/2
+	}
+	if g.first < 0 {
+		g.first = 0
+	}
+	pos := func(p undo.Place) f32.Point {
+		return f32.Pt(step*float32(p.Column+1), step*float32(p.Row-g.first+1))
+	}
+	g.events(gtx, places, pos, radius)
+	alpha := g.opacity(gtx.Now)
+	if alpha <= 0 {
+		// a hidden graph takes no space and lets the pointer through to the editor
+		return l.Dimensions{}
+	}
+	stack := op.Save(gtx.Ops)
+	pointer.Rect(image.Rectangle{Max: size}).Add(gtx.Ops)
+	pointer.InputOp{Tag: g, Types: pointer.Move | pointer.Enter | pointer.Leave | pointer.Press}.Add(gtx.Ops)
+	stack.Load()
+	if alpha < 1 {
+		op.InvalidateOp{}.Add(gtx.Ops)
+	} else {
+		op.InvalidateOp{At: g.shown.Add(g.timeout)}.Add(gtx.Ops)
+	}
+	bg := g.color("DocBgDim", alpha*0.5)
+	paint.FillShape(gtx.Ops, bg, clip.Rect{Max: size}.Op())
+	edge := g.color("DocTextDim", alpha)
+	for _, p := range places {
+		if p.Node.Parent == nil {
+			continue
+		}
+		from, to := pos(places[p.Node.Parent.ID]), pos(p)
+		if to.Y < 0 && from.Y < 0 || from.Y > float32(size.Y) {
+			continue
+		}
+		var path clip.Path
+		path.Begin(gtx.Ops)
+		path.MoveTo(from)
+		if from.X != to.X {
+			// branches leave their parent diagonally and then run straight down
+			path.LineTo(f32.Pt(to.X, from.Y+step/2))
+		}
+		path.LineTo(to)
+		paint.FillShape(
+			gtx.Ops, edge, clip.Stroke{Path: path.End(), Style: clip.StrokeStyle{Width: radius / 3}}.Op(),
+		)
+	}
+	for _, p := range places {
+		c := pos(p)
+		if c.Y < -radius || c.Y > float32(size.Y)+radius {
+			continue
+		}
+		col, r := "DocText", radius
+		switch {
+		case p.Node == cur:
+			col, r = "Primary", radius*1.4
+		case p.Node.ID == g.hovered:
+			col, r = "Secondary", radius*1.4
+		case p.Node.Name != "":
+			col = "Secondary"
+		}
+		paint.FillShape(gtx.Ops, g.color(col, alpha), clip.Circle{Center: c, Radius: r}.Op(gtx.Ops))
+		if p.Node.Name != "" {
+			stack := op.Save(gtx.Ops)
+			op.Offset(f32.Pt(c.X+radius*2, c.Y-radius*2)).Add(gtx.Ops)
+			gtx1 := gtx
+			gtx1.Constraints.Min = image.Point{}
+			g.Caption(p.Node.Name).Color("DocText").Fn(gtx1)
+			stack.Load()
+		}
+	}
+	return l.Dimensions{Size: size}
+}
+
+// events handles hovering and clicking on the nodes of the graph
+func (g *UndoGraph) events(gtx l.Context, places []undo.Place, pos func(undo.Place) f32.Point, radius float32) {
+	for _, ev := range gtx.Events(g) {
+		pe, ok := ev.(pointer.Event)
+		if !ok {
+			continue
+		}
+		switch pe.Type {
+		case pointer.Leave, pointer.Cancel:
+			g.hovered = -1
+		case pointer.Move, pointer.Enter:
+			g.hovered = -1
+			for _, p := range places {
+				if d := pos(p).Sub(pe.Position); d.X*d.X+d.Y*d.Y <= radius*radius*4 {
+					g.hovered = p.Node.ID
+					break
+				}
+			}
+			g.Show()
+		case pointer.Press:
+			if g.hovered < 0 {
+				break
+			}
+			if e := g.tree.Switch(g.hovered); E.Chk(e) {
+			}
+			g.Show()
+		}
+	}
+	if g.hovered >= 0 {
+		key := [3]int{g.hovered, g.tree.Current().ID, g.tree.Doc().Log().Len()}
+		if key != g.previewKey {
+			var e error
+			if g.preview, e = g.tree.Text(g.hovered); E.Chk(e) {
+				g.preview = ""
+			}
+			g.previewKey = key
+		}
+	}
+}
+
+// color returns a theme color with its opacity scaled
+func (g *UndoGraph) color(name string, alpha float32) (c color.NRGBA) {
+	c = g.Colors.GetNRGBAFromName(name)
+	c.A = uint8(float32(c.A) * alpha)
+	return
+}
@@ -0,0 +1,18 @@
+package ui
+
+import (
+	"github.com/p9c/gel"
+	"github.com/p9c/gel/fonts/p9fonts"
+	"github.com/p9c/opts/binary"
+	"github.com/p9c/opts/meta"
+	"github.com/p9c/qu"
+)
+
+// NewWindow creates a gel window with the built in fonts and the light theme. It does what gel.NewWindowP9 is meant
+// to, which hands the dark theme option a method of the theme before the theme exists and so cannot be called.
+func NewWindow(quit qu.C) (w *gel.Window) {
+	w = gel.NewWindow(gel.NewTheme(binary.New(meta.Data{}, false), p9fonts.Collection(), quit))
+	w.Runner = gel.NewCallbackQueue(32)
+	w.Theme.WidgetPool = w.NewPool()
+	return
+}
@@ -0,0 +1,31 @@
+package undo
+
+// Place is the position of a node in a drawing of the tree, rows are the depth of the node and columns separate the
+// branches
+type Place struct {
+	Node   *Node
+	Column int
+	Row    int
+}
+
+// Layout arranges the tree for drawing. The first child of a node stays in the column of its parent, and every other
+// child starts a new column to the right of all the columns used so far, so branches never cross each other. Places
+// are returned in the order of node IDs.
+func (t *Tree) Layout() (places []Place, columns int) {
+	places = make([]Place, len(t.nodes))
+	var walk func(n *Node, col int)
+	walk = func(n *Node, col int) {
+		places[n.ID] = Place{Node: n, Column: col, Row: n.Depth}
+		for i, c := range n.Children {
+			if i == 0 {
+				walk(c, col)
+				continue
+			}
+			columns++
+			walk(c, columns)
+		}
+	}
+	walk(t.Root(), 0)
+	columns++
+	return
+}
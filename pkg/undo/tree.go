@@ -0,0 +1,389 @@
+// Package undo keeps the history of a document as a tree. Undoing and then editing does not throw away the undone
+// edits, it starts a new branch beside them, and any node of the tree can be returned to by replaying the recorded
+// events between the current node and the target.
+package undo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/p9c/glom/pkg/diff"
+	"github.com/p9c/glom/pkg/doc"
+)
+
+var (
+	// ErrNoNode is returned when a node ID is not in the tree
+	ErrNoNode = errors.New("no such node")
+	// ErrRoot is returned when undoing at the root of the tree
+	ErrRoot = errors.New("nothing to undo")
+	// ErrLeaf is returned when redoing at a node with no children
+	ErrLeaf = errors.New("nothing to redo")
+	// ErrName is returned when a name is already given to another node
+	ErrName = errors.New("name already in use")
+)
+
+// Node is a state of the document. The root is the state the tree was created with and every other node is reached
+// by applying its events to the state of its parent.
+type Node struct {
+	ID       int
+	Parent   *Node
+	Children []*Node
+	Events   []doc.Event
+	Name     string
+	Time     time.Time
+	Depth    int
+	// redo is the child that was most recently left by an undo or created
+	redo *Node
+}
+
+// Leaf reports whether the node is the tip of a branch
+func (n *Node) Leaf() bool {
+	return len(n.Children) == 0
+}
+
+// Change is what happened to a tree, as reported to its watchers
+type Change uint8
+
+const (
+	// Added is reported with a new node, which is a child of the node that was current and is now current itself
+	Added Change = iota + 1
+	// Switched is reported with the node the document was moved to
+	Switched
+	// Named is reported with a node whose name was changed
+	Named
+)
+
+// Tree is the branching history of a document
+type Tree struct {
+	doc      *doc.Document
+	nodes    []*Node
+	names    map[string]*Node
+	current  *Node
+	watchers []func(c Change, n *Node)
+}
+
+// New creates a tree whose root is the present state of the document
+func New(d *doc.Document) (t *Tree) {
+	t = &Tree{
+		doc:   d,
+		names: make(map[string]*Node),
+	}
+	t.current = t.add(nil, nil, d.Clock())
+	return
+}
+
+// Watch registers a function to be called with every change to the tree after it was made, so that the history can be
+// stored as it grows
+func (t *Tree) Watch(fn func(c Change, n *Node)) {
+	t.watchers = append(t.watchers, fn)
+}
+
+func (t *Tree) notify(c Change, n *Node) {
+	for _, fn := range t.watchers {
+		fn(c, n)
+	}
+}
+
+// Doc returns the document the tree edits
+func (t *Tree) Doc() *doc.Document {
+	return t.doc
+}
+
+// Root returns the first node of the tree
+func (t *Tree) Root() *Node {
+	return t.nodes[0]
+}
+
+// Current returns the node the document is at
+func (t *Tree) Current() *Node {
+	return t.current
+}
+
+// Len returns the number of nodes in the tree
+func (t *Tree) Len() int {
+	return len(t.nodes)
+}
+
+// Node returns the node with the given ID
+func (t *Tree) Node(id int) (n *Node, e error) {
+	if id < 0 || id >= len(t.nodes) {
+		return nil, ErrNoNode
+	}
+	return t.nodes[id], nil
+}
+
+// Nodes returns every node in the order they were created
+func (t *Tree) Nodes() []*Node {
+	return t.nodes
+}
+
+func (t *Tree) add(parent *Node, events []doc.Event, tm time.Time) (n *Node) {
+	n = &Node{
+		ID:     len(t.nodes),
+		Parent: parent,
+		Events: events,
+		Time:   tm,
+	}
+	if parent != nil {
+		n.Depth = parent.Depth + 1
+		parent.Children = append(parent.Children, n)
+		parent.redo = n
+	}
+	t.nodes = append(t.nodes, n)
+	return
+}
+
+// Graft adds a node holding the events as a child of the node with the given ID, without applying them to the
+// document or moving to the new node. It is for rebuilding a history whose document is brought to its state
+// separately, such as from a journal.
+func (t *Tree) Graft(parent int, events []doc.Event, tm time.Time) (n *Node, e error) {
+	var p *Node
+	if p, e = t.Node(parent); e != nil {
+		return
+	}
+	return t.add(p, events, tm), nil
+}
+
+// Reset makes the node with the given ID current without changing the document, which must already be at the state
+// of the node
+func (t *Tree) Reset(id int) (e error) {
+	var n *Node
+	if n, e = t.Node(id); e != nil {
+		return
+	}
+	t.current = n
+	return
+}
+
+// Commit applies the events to the document and records them as a new child of the current node, which becomes the
+// current node. If any of the events fail the ones already applied are reversed and no node is created.
+func (t *Tree) Commit(events ...doc.Event) (n *Node, e error) {
+	return t.Edit(
+		func(d *doc.Document) (e error) {
+			for i := range events {
+				if e = d.Apply(events[i]); e != nil {
+					return
+				}
+			}
+			return
+		},
+	)
+}
+
+// Edit runs fn and records the events it applies to the document as one new node, so that they are undone together.
+// If fn returns an error its events are reversed and no node is created.
+func (t *Tree) Edit(fn func(d *doc.Document) error) (n *Node, e error) {
+	start := t.doc.Log().Len()
+	e = fn(t.doc)
+	applied := append([]doc.Event{}, t.doc.Log().Events()[start:]...)
+	if e != nil {
+		if re := t.reverse(applied); re != nil {
+			E.Ln("failed to roll back edit:", re)
+		}
+		return
+	}
+	if len(applied) == 0 {
+		return t.current, nil
+	}
+	n = t.add(t.current, applied, applied[len(applied)-1].Time)
+	t.current = n
+	t.notify(Added, n)
+	return
+}
+
+// Record adds a node with events that were already applied to the document, for callers that change the document
+// directly and only then hand the change to the tree.
+func (t *Tree) Record(events ...doc.Event) (n *Node) {
+	if len(events) == 0 {
+		return t.current
+	}
+	n = t.add(t.current, append([]doc.Event{}, events...), events[len(events)-1].Time)
+	t.current = n
+	t.notify(Added, n)
+	return
+}
+
+// Undo moves to the parent of the current node
+func (t *Tree) Undo() (e error) {
+	if t.current.Parent == nil {
+		return ErrRoot
+	}
+	return t.Switch(t.current.Parent.ID)
+}
+
+// Redo moves to the child of the current node that was most recently visited
+func (t *Tree) Redo() (e error) {
+	if t.current.redo == nil {
+		return ErrLeaf
+	}
+	return t.Switch(t.current.redo.ID)
+}
+
+// Switch moves the document to the state of the node with the given ID by reversing the events back to the common
+// ancestor of the two nodes and replaying the events down to the target.
+func (t *Tree) Switch(id int) (e error) {
+	var target *Node
+	if target, e = t.Node(id); e != nil {
+		return
+	}
+	up, down := path(t.current, target)
+	if len(up)+len(down) > 0 {
+		// a switch that fails halfway still leaves the document at another node
+		defer func() { t.notify(Switched, t.current) }()
+	}
+	for _, n := range up {
+		if e = t.reverse(n.Events); e != nil {
+			return fmt.Errorf("undoing node %d: %w", n.ID, e)
+		}
+		n.Parent.redo = n
+		t.current = n.Parent
+	}
+	for _, n := range down {
+		if e = t.replay(t.doc, n.Events); e != nil {
+			return fmt.Errorf("redoing node %d: %w", n.ID, e)
+		}
+		n.Parent.redo = n
+		t.current = n
+	}
+	return
+}
+
+// reverse applies the inverses of the events in reverse order
+func (t *Tree) reverse(events []doc.Event) (e error) {
+	for i := len(events) - 1; i >= 0; i-- {
+		if e = t.doc.Apply(doc.Inverse(events[i])); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// replay applies recorded events again as new edits
+func (t *Tree) replay(d *doc.Document, events []doc.Event) (e error) {
+	for _, ev := range events {
+		ev.Time = time.Time{}
+		if e = d.Apply(ev); e != nil {
+			return
+		}
+	}
+	return
+}
+
+// path returns the nodes to undo going up from a to the common ancestor, and the nodes to redo going down from the
+// common ancestor to b
+func path(a, b *Node) (up, down []*Node) {
+	for a.Depth > b.Depth {
+		up = append(up, a)
+		a = a.Parent
+	}
+	for b.Depth > a.Depth {
+		down = append(down, b)
+		b = b.Parent
+	}
+	for a != b {
+		up = append(up, a)
+		down = append(down, b)
+		a, b = a.Parent, b.Parent
+	}
+	for i, j := 0, len(down)-1; i < j; i, j = i+1, j-1 {
+		down[i], down[j] = down[j], down[i]
+	}
+	return
+}
+
+// Branches returns the tips of every branch, most recent first
+func (t *Tree) Branches() (out []*Node) {
+	for _, n := range t.nodes {
+		if n.Leaf() {
+			out = append(out, n)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return
+}
+
+// Text returns the text of the document at a node without moving the document there. The text is found by replaying
+// the path from the current node onto a scratch copy of the current text.
+func (t *Tree) Text(id int) (s string, e error) {
+	var target *Node
+	if target, e = t.Node(id); e != nil {
+		return
+	}
+	scratch := doc.New()
+	if e = scratch.Insert(0, t.doc.Text()); e != nil {
+		return
+	}
+	up, down := path(t.current, target)
+	for _, n := range up {
+		for i := len(n.Events) - 1; i >= 0; i-- {
+			if e = applyText(scratch, doc.Inverse(n.Events[i])); e != nil {
+				return
+			}
+		}
+	}
+	for _, n := range down {
+		for _, ev := range n.Events {
+			if e = applyText(scratch, ev); e != nil {
+				return
+			}
+		}
+	}
+	return scratch.Text(), nil
+}
+
+// applyText applies an event to a copy of the text that has no notes, so annotations are skipped
+func applyText(d *doc.Document, ev doc.Event) error {
+	if ev.Kind == doc.Annotate {
+		return nil
+	}
+	return d.Apply(ev)
+}
+
+// Diff returns the line differences between the texts at two nodes
+func (t *Tree) Diff(a, b int) (chunks []diff.Chunk, e error) {
+	var ta, tb string
+	if ta, e = t.Text(a); e != nil {
+		return
+	}
+	if tb, e = t.Text(b); e != nil {
+		return
+	}
+	return diff.Lines(ta, tb), nil
+}
+
+// Name gives a node a name so it can be found again. An empty name removes the name from the node.
+func (t *Tree) Name(id int, name string) (e error) {
+	var n *Node
+	if n, e = t.Node(id); e != nil {
+		return
+	}
+	if other, ok := t.names[name]; ok && other != n {
+		return ErrName
+	}
+	if n.Name != "" {
+		delete(t.names, n.Name)
+	}
+	n.Name = name
+	if name != "" {
+		t.names[name] = n
+	}
+	t.notify(Named, n)
+	return
+}
+
+// Lookup finds the node with the given name
+func (t *Tree) Lookup(name string) (n *Node, ok bool) {
+	n, ok = t.names[name]
+	return
+}
+
+// Bookmarks returns the named nodes ordered by name
+func (t *Tree) Bookmarks() (out []*Node) {
+	for _, n := range t.names {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return
+}
@@ -0,0 +1,200 @@
+package undo_test
+
+import (
+	"testing"
+
+	"github.com/p9c/glom/pkg/diff"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+func insert(t *testing.T, tr *undo.Tree, at int, s string) *undo.Node {
+	t.Helper()
+	n, e := tr.Edit(func(d *doc.Document) error { return d.Insert(at, s) })
+	if e != nil {
+		t.Fatal(e)
+	}
+	return n
+}
+
+func expect(t *testing.T, tr *undo.Tree, want string) {
+	t.Helper()
+	if got := tr.Doc().Text(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestBranching checks an edit after an undo starts a sibling branch and that both timelines can be visited
+func TestBranching(t *testing.T) {
+	tr := undo.New(doc.New())
+	a := insert(t, tr, 0, "one")
+	b := insert(t, tr, 3, " two")
+	expect(t, tr, "one two")
+	if e := tr.Undo(); e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "one")
+	c := insert(t, tr, 3, " three")
+	expect(t, tr, "one three")
+	if b.Parent != a || c.Parent != a || len(a.Children) != 2 {
+		t.Fatal("second edit after undo did not branch")
+	}
+	if branches := tr.Branches(); len(branches) != 2 {
+		t.Fatalf("got %d branches, want 2", len(branches))
+	}
+	if e := tr.Switch(b.ID); e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "one two")
+	if e := tr.Switch(tr.Root().ID); e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "")
+	if e := tr.Undo(); e != undo.ErrRoot {
+		t.Fatalf("undo at root returned %v", e)
+	}
+	// redo follows the branch that was last visited
+	if e := tr.Redo(); e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Redo(); e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "one two")
+	if e := tr.Redo(); e != undo.ErrLeaf {
+		t.Fatalf("redo at leaf returned %v", e)
+	}
+}
+
+// TestSwitchReplays checks that moving between timelines is recorded as edits in the document log
+func TestSwitchReplays(t *testing.T) {
+	tr := undo.New(doc.New())
+	insert(t, tr, 0, "abc")
+	n, e := tr.Edit(
+		func(d *doc.Document) (e error) {
+			if e = d.Move(0, 1, 3); e != nil {
+				return
+			}
+			return d.Annotate("x", 0, 2, "note")
+		},
+	)
+	if e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "bca")
+	before := tr.Doc().Log().Len()
+	if e = tr.Undo(); e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "abc")
+	if _, ok := tr.Doc().Note("x"); ok {
+		t.Fatal("undo kept the annotation")
+	}
+	if tr.Doc().Log().Len() != before+2 {
+		t.Fatalf("undo recorded %d events, want 2", tr.Doc().Log().Len()-before)
+	}
+	if e = tr.Switch(n.ID); e != nil {
+		t.Fatal(e)
+	}
+	expect(t, tr, "bca")
+	if _, ok := tr.Doc().Note("x"); !ok {
+		t.Fatal("redo lost the annotation")
+	}
+}
+
+// TestFailedEdit checks a failing edit is rolled back without creating a node
+func TestFailedEdit(t *testing.T) {
+	tr := undo.New(doc.New())
+	insert(t, tr, 0, "keep")
+	_, e := tr.Edit(
+		func(d *doc.Document) (e error) {
+			if e = d.Insert(0, "drop "); e != nil {
+				return
+			}
+			return d.Delete(100, 1)
+		},
+	)
+	if e == nil {
+		t.Fatal("edit did not fail")
+	}
+	expect(t, tr, "keep")
+	if tr.Len() != 2 {
+		t.Fatalf("tree has %d nodes, want 2", tr.Len())
+	}
+}
+
+// TestTextAndDiff checks other nodes can be read and compared without switching to them
+func TestTextAndDiff(t *testing.T) {
+	tr := undo.New(doc.New())
+	a := insert(t, tr, 0, "a\nb\nc\n")
+	if e := tr.Undo(); e != nil {
+		t.Fatal(e)
+	}
+	b := insert(t, tr, 0, "a\nx\nc\n")
+	s, e := tr.Text(a.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if s != "a\nb\nc\n" {
+		t.Fatalf("text of other branch is %q", s)
+	}
+	expect(t, tr, "a\nx\nc\n")
+	chunks, e := tr.Diff(a.ID, b.ID)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if got := diff.Format(chunks); got != " a\n-b\n+x\n c\n" {
+		t.Fatalf("unexpected diff:\n%s", got)
+	}
+}
+
+// TestNames checks bookmarks can be set, found and are unique
+func TestNames(t *testing.T) {
+	tr := undo.New(doc.New())
+	a := insert(t, tr, 0, "a")
+	b := insert(t, tr, 1, "b")
+	if e := tr.Name(a.ID, "first"); e != nil {
+		t.Fatal(e)
+	}
+	if e := tr.Name(b.ID, "first"); e != undo.ErrName {
+		t.Fatalf("duplicate name returned %v", e)
+	}
+	if n, ok := tr.Lookup("first"); !ok || n != a {
+		t.Fatal("lookup failed")
+	}
+	if e := tr.Name(a.ID, "renamed"); e != nil {
+		t.Fatal(e)
+	}
+	if _, ok := tr.Lookup("first"); ok {
+		t.Fatal("old name still found")
+	}
+	if bm := tr.Bookmarks(); len(bm) != 1 || bm[0] != a {
+		t.Fatal("unexpected bookmarks")
+	}
+}
+
+// TestLayout checks that branches are given their own columns
+func TestLayout(t *testing.T) {
+	tr := undo.New(doc.New())
+	a := insert(t, tr, 0, "a")
+	b := insert(t, tr, 1, "b")
+	if e := tr.Switch(a.ID); e != nil {
+		t.Fatal(e)
+	}
+	c := insert(t, tr, 1, "c")
+	if e := tr.Switch(tr.Root().ID); e != nil {
+		t.Fatal(e)
+	}
+	d := insert(t, tr, 0, "d")
+	places, columns := tr.Layout()
+	if columns != 3 {
+		t.Fatalf("got %d columns, want 3", columns)
+	}
+	want := map[*undo.Node][2]int{a: {0, 1}, b: {0, 2}, c: {1, 2}, d: {2, 1}}
+	for n, w := range want {
+		p := places[n.ID]
+		if p.Column != w[0] || p.Row != w[1] {
+			t.Errorf("node %d placed at %d,%d, want %d,%d", n.ID, p.Column, p.Row, w[0], w[1])
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/fold"
+	"github.com/p9c/glom/pkg/grammar"
+	"github.com/p9c/glom/pkg/highlight"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/settings"
+	"github.com/p9c/glom/pkg/structure"
+	"github.com/p9c/glom/pkg/undo"
+)
+
+// Options is where a workspace keeps the state of its files and how it sets them up when they are opened
+type Options struct {
+	JournalDir string
+	FoldDir    string
+	Fold       settings.Fold
+	// Languages is what the language of a file is detected among, the built in ones if it is nil
+	Languages *grammar.Languages
+}
+
+// DefaultOptions keeps the state of files in the data directory of glom with the default settings
+func DefaultOptions() Options {
+	return Options{
+		JournalDir: journal.Dir(), FoldDir: fold.Dir(), Fold: settings.Default().Fold, Languages: grammar.Builtin(),
+	}
+}
+
+// Buffer is a document open in the editor with everything that goes with it: its history and the journal it is
+// recorded in, its language with the structure and tokens it gives it, its folds and the selection in it
+type Buffer struct {
+	Doc       *doc.Document
+	History   *undo.Tree
+	Language  *grammar.Language
+	Structure *structure.Tree
+	Highlight *highlight.Highlighter
+	Folds     *fold.Set
+	Selection *doc.Selection
+	Journal   *journal.Journal
+	// Path is the file the document was opened from, which its fold state is stored for
+	Path string
+}
+
+// NewBuffer creates a buffer with an empty document of Go, whose structure, tokens, folds and selection follow its
+// edits
+func NewBuffer() (b *Buffer) {
+	b = &Buffer{Doc: doc.New(), Folds: fold.New(), Selection: doc.NewSelection()}
+	b.History = undo.New(b.Doc)
+	b.Use(grammar.Go)
+	b.Doc.Watch(
+		func(ev doc.Event) {
+			b.Structure.Apply(b.Doc, ev)
+			b.Highlight.Apply(b.Doc, ev)
+			b.Folds.Apply(ev)
+			b.Selection.Follow(ev)
+		},
+	)
+	return
+}
+
+// Use changes the language of the document, segmenting and lexing it again
+func (b *Buffer) Use(l *grammar.Language) {
+	b.Language = l
+	b.Structure = l.Parse(b.Doc)
+	b.Highlight = l.Highlight(b.Doc)
+}
+
+// Open loads a file into the document along with the history in its journal, the folds it had and the notes of its
+// sidecar. A file that was changed outside of glom since glom last read or wrote it gets the change as a new edit, a
+// file that was not keeps the document the journal brings it to. The language of the file is detected from its name
+// and text.
+func (b *Buffer) Open(path string, o Options) (e error) {
+	var content []byte
+	if content, e = ioutil.ReadFile(path); E.Chk(e) {
+		return
+	}
+	languages := o.Languages
+	if languages == nil {
+		languages = grammar.Builtin()
+	}
+	b.Use(languages.Detect(path, string(content)))
+	var records []journal.Record
+	if b.Journal, records, e = journal.Open(journal.Path(o.JournalDir, path)); E.Chk(e) {
+		return
+	}
+	if len(records) == 0 {
+		// a new journal names its file, so that it can be exported without knowing where it came from
+		name := path
+		if abs, ae := filepath.Abs(path); !E.Chk(ae) {
+			name = abs
+		}
+		if e = b.Journal.Append(journal.Record{Kind: journal.FileRecord, Name: name}); E.Chk(e) {
+			return
+		}
+	}
+	if e = journal.Restore(b.History, records); E.Chk(e) {
+		return
+	}
+	journal.Attach(b.Journal, b.History)
+	if sum := journal.Sum(content); journal.Disk(records) != sum {
+		if e = b.replace(string(content)); E.Chk(e) {
+			return
+		}
+		if e = b.Journal.Append(journal.Record{Kind: journal.DiskRecord, Name: sum}); E.Chk(e) {
+			return
+		}
+	}
+	b.Path = path
+	// replaying the history carried the cursor along, a file is opened with it at the start
+	b.Selection.Set(doc.Cursor(0))
+	folds := fold.New()
+	if o.Fold.Restore {
+		if folds, e = fold.Load(o.FoldDir, path); E.Chk(e) {
+			return
+		}
+	}
+	if len(folds.Folds()) == 0 && o.Fold.Depth > 0 {
+		folds.FoldTo(b.Doc, b.Structure, o.Fold.Depth)
+	}
+	b.Folds = folds
+	// notes shared through a sidecar file are placed on the segments they were written for
+	var sc annotate.Sidecar
+	if sc, e = annotate.ReadSidecar(annotate.SidecarPath(path)); E.Chk(e) {
+		return
+	}
+	notes := sc.Notes[:0]
+	for _, ex := range sc.Notes {
+		if _, ok := b.Doc.Note(ex.ID); !ok {
+			notes = append(notes, ex)
+		}
+	}
+	if sc.Notes = notes; len(notes) == 0 {
+		return
+	}
+	var lost []annotate.Exported
+	if lost, e = annotate.Import(b.History, b.Structure, sc); E.Chk(e) {
+		return
+	}
+	for _, ex := range lost {
+		W.Ln("note", ex.ID, "could not be placed:", ex.Summary)
+	}
+	return
+}
+
+// replace changes the text of the document to the text as a single edit, which only touches the part between what
+// the two have in common at their start and end
+func (b *Buffer) replace(txt string) (e error) {
+	old, nw := []rune(b.Doc.Text()), []rune(txt)
+	pre := 0
+	for pre < len(old) && pre < len(nw) && old[pre] == nw[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(old)-pre && suf < len(nw)-pre && old[len(old)-1-suf] == nw[len(nw)-1-suf] {
+		suf++
+	}
+	if pre == len(old) && pre == len(nw) {
+		return
+	}
+	_, e = b.History.Edit(
+		func(d *doc.Document) (e error) {
+			if n := len(old) - pre - suf; n > 0 {
+				if e = d.Delete(pre, n); e != nil {
+					return
+				}
+			}
+			if ins := string(nw[pre : len(nw)-suf]); ins != "" {
+				e = d.Insert(pre, ins)
+			}
+			return
+		},
+	)
+	return
+}
+
+// Save writes the document to the file it was opened from with its notes to the sidecar of the file, and records in
+// its journal what the file now holds
+func (b *Buffer) Save() (e error) {
+	if b.Path == "" {
+		return
+	}
+	content := []byte(b.Doc.Text())
+	if e = writeFile(b.Path, content); E.Chk(e) {
+		return
+	}
+	if b.Journal != nil {
+		if e = b.Journal.Append(journal.Record{Kind: journal.DiskRecord, Name: journal.Sum(content)}); E.Chk(e) {
+			return
+		}
+	}
+	return b.SaveNotes()
+}
+
+// writeFile replaces the content of a file in one step, so that a crash or a full disk never leaves half of it behind.
+// The content is written to a new file beside it and synced, and then renamed over it, keeping its permissions. A
+// symbolic link is followed, so that the file it points to is replaced rather than the link.
+func writeFile(path string, content []byte) (e error) {
+	if real, le := filepath.EvalSymlinks(path); le == nil {
+		path = real
+	}
+	mode := os.FileMode(0644)
+	if info, se := os.Stat(path); se == nil {
+		mode = info.Mode().Perm()
+	}
+	var tmp *os.File
+	if tmp, e = ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp"); E.Chk(e) {
+		return
+	}
+	defer func() {
+		if e != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, e = tmp.Write(content); E.Chk(e) {
+		return
+	}
+	if e = tmp.Chmod(mode); E.Chk(e) {
+		return
+	}
+	if e = tmp.Sync(); E.Chk(e) {
+		return
+	}
+	if e = tmp.Close(); E.Chk(e) {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// SaveNotes writes the notes of the document to the sidecar of the file it was opened from, so that they can be shared
+// with the file. The sidecar of a document without notes is removed, so that notes that were deleted do not come back
+// from it.
+func (b *Buffer) SaveNotes() (e error) {
+	if b.Path == "" {
+		return
+	}
+	path := annotate.SidecarPath(b.Path)
+	if len(b.Doc.Notes()) == 0 {
+		if e = os.Remove(path); os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	return annotate.WriteSidecar(path, b.Doc, b.Structure)
+}
+
+// SaveFolds stores the folds of the file the document was opened from
+func (b *Buffer) SaveFolds(dir string) (e error) {
+	if b.Path == "" {
+		return
+	}
+	return b.Folds.Save(dir, b.Path)
+}
+
+// Close closes the journal of the buffer
+func (b *Buffer) Close() (e error) {
+	if b.Journal == nil {
+		return
+	}
+	e = b.Journal.Close()
+	b.Journal = nil
+	return
+}
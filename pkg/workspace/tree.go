@@ -0,0 +1,156 @@
+package workspace
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+// Entry is a file or directory in the tree of a workspace
+type Entry struct {
+	Name string
+	// Path is the absolute path of the file
+	Path     string
+	Dir      bool
+	Children []*Entry
+}
+
+// Walk calls fn with the entry and everything below it in the order they are shown, and does not go into a
+// directory when fn returns false for it
+func (en *Entry) Walk(fn func(en *Entry, depth int) bool) {
+	en.walk(fn, 0)
+}
+
+func (en *Entry) walk(fn func(en *Entry, depth int) bool, depth int) {
+	if !fn(en, depth) {
+		return
+	}
+	for _, c := range en.Children {
+		c.walk(fn, depth+1)
+	}
+}
+
+// split returns the parts of a path relative to a base
+func split(base, path string) []string {
+	rel, e := filepath.Rel(base, path)
+	if e != nil || rel == "." {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// readIgnore reads the patterns of a .gitignore or exclude file, which apply below the domain
+func readIgnore(path string, domain []string) (ps []gitignore.Pattern) {
+	f, e := os.Open(path)
+	if e != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ps = append(ps, gitignore.ParsePattern(line, domain))
+	}
+	return
+}
+
+// patterns returns the ignore patterns that apply to the root of the workspace, from the repository exclude file and
+// the .gitignore files from the root of the working tree down to it
+func (w *Workspace) patterns() (ps []gitignore.Pattern) {
+	if w.Repo == nil {
+		return readIgnore(filepath.Join(w.Root, ".gitignore"), nil)
+	}
+	ps = readIgnore(filepath.Join(w.base, ".git", "info", "exclude"), nil)
+	dir := w.base
+	for _, part := range append([]string{""}, split(w.base, w.Root)...) {
+		dir = filepath.Join(dir, part)
+		ps = append(ps, readIgnore(filepath.Join(dir, ".gitignore"), split(w.base, dir))...)
+	}
+	return
+}
+
+// Tree returns the files and directories of the workspace that are not ignored by git, directories first and then by
+// name. The .git directory is always left out.
+func (w *Workspace) Tree() (root *Entry, e error) {
+	root = &Entry{Name: filepath.Base(w.Root), Path: w.Root, Dir: true}
+	e = w.read(root, w.patterns())
+	return
+}
+
+// read fills in the children of a directory entry, adding the .gitignore of each directory below the root to the
+// patterns that apply inside it
+func (w *Workspace) read(dir *Entry, ps []gitignore.Pattern) (e error) {
+	if dir.Path != w.Root {
+		ps = append(ps[:len(ps):len(ps)], readIgnore(filepath.Join(dir.Path, ".gitignore"), split(w.base, dir.Path))...)
+	}
+	m := gitignore.NewMatcher(ps)
+	var f *os.File
+	if f, e = os.Open(dir.Path); E.Chk(e) {
+		return
+	}
+	var infos []os.FileInfo
+	infos, e = f.Readdir(-1)
+	if ce := f.Close(); E.Chk(ce) {
+	}
+	if E.Chk(e) {
+		return
+	}
+	for _, info := range infos {
+		if info.Name() == ".git" {
+			continue
+		}
+		en := &Entry{Name: info.Name(), Path: filepath.Join(dir.Path, info.Name()), Dir: info.IsDir()}
+		if m.Match(split(w.base, en.Path), en.Dir) {
+			continue
+		}
+		if en.Dir {
+			if e = w.read(en, ps); e != nil {
+				return
+			}
+		}
+		dir.Children = append(dir.Children, en)
+	}
+	sort.Slice(
+		dir.Children, func(i, j int) bool {
+			a, b := dir.Children[i], dir.Children[j]
+			if a.Dir != b.Dir {
+				return a.Dir
+			}
+			return a.Name < b.Name
+		},
+	)
+	return
+}
+
+// Ignored reports whether git ignores a file or directory of the workspace
+func (w *Workspace) Ignored(path string) bool {
+	abs, e := filepath.Abs(path)
+	if E.Chk(e) {
+		return false
+	}
+	info, e := os.Stat(abs)
+	if e != nil {
+		return false
+	}
+	ps := w.patterns()
+	parts := split(w.Root, abs)
+	dir := w.Root
+	for i, part := range parts {
+		m := gitignore.NewMatcher(ps)
+		sub := filepath.Join(dir, part)
+		if part == ".git" || m.Match(split(w.base, sub), i < len(parts)-1 || info.IsDir()) {
+			return true
+		}
+		if dir = sub; i < len(parts)-1 {
+			ps = append(ps, readIgnore(filepath.Join(dir, ".gitignore"), split(w.base, dir))...)
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+// Package workspace holds the files of a directory that are open in the editor. Each file is a buffer with its own
+// history, kept in a journal of its own, and the directory is shown as a tree of the files that git does not ignore.
+package workspace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+
+	"github.com/p9c/glom/pkg/settings"
+)
+
+// ErrNotOpen is returned when closing a buffer the workspace does not have
+var ErrNotOpen = errors.New("buffer is not open in the workspace")
+
+// Workspace is a directory and the files of it that are open
+type Workspace struct {
+	// Root is the absolute path of the directory
+	Root string
+	// Repo is the git repository the directory is in, and nil outside of one
+	Repo    *git.Repository
+	Options Options
+	// base is the root of the working tree of the repository, which ignore patterns are relative to
+	base    string
+	buffers []*Buffer
+}
+
+// repository finds the git repository a directory is in and the root of its working tree
+func repository(dir string) (repo *git.Repository, root string) {
+	var e error
+	if repo, e = git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true}); e != nil {
+		return nil, ""
+	}
+	var wt *git.Worktree
+	if wt, e = repo.Worktree(); e != nil {
+		// a bare repository has no files to show
+		return nil, ""
+	}
+	return repo, wt.Filesystem.Root()
+}
+
+// Root returns the directory of the workspace a path is in: the nearest directory with a project file, or failing
+// that the root of the git repository, or the directory itself
+func Root(path string) string {
+	dir := path
+	if info, e := os.Stat(path); e == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	if abs, e := filepath.Abs(dir); !E.Chk(e) {
+		dir = abs
+	}
+	if root := settings.Workspace(dir); root != "" {
+		return root
+	}
+	if _, root := repository(dir); root != "" {
+		return root
+	}
+	return dir
+}
+
+// Open opens a directory as a workspace without any open files
+func Open(dir string, o Options) (w *Workspace, e error) {
+	if dir, e = filepath.Abs(dir); E.Chk(e) {
+		return
+	}
+	var info os.FileInfo
+	if info, e = os.Stat(dir); e != nil {
+		return
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "open workspace", Path: dir, Err: errors.New("not a directory")}
+	}
+	w = &Workspace{Root: dir, Options: o}
+	if w.Repo, w.base = repository(dir); w.base == "" {
+		w.base = dir
+	}
+	return
+}
+
+// Rel returns the path of a file relative to the root of the workspace, or the path itself for a file outside of it
+func (w *Workspace) Rel(path string) string {
+	abs, e := filepath.Abs(path)
+	if E.Chk(e) {
+		return path
+	}
+	rel, e := filepath.Rel(w.Root, abs)
+	if e != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return rel
+}
+
+// Buffers returns the open buffers in the order they were opened
+func (w *Workspace) Buffers() []*Buffer {
+	return append([]*Buffer(nil), w.buffers...)
+}
+
+// Buffer returns the open buffer of a file
+func (w *Workspace) Buffer(path string) (b *Buffer, ok bool) {
+	abs, e := filepath.Abs(path)
+	if E.Chk(e) {
+		return
+	}
+	for _, b = range w.buffers {
+		if b.Path == abs {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Open returns the buffer of a file, opening it if it is not open yet, so that a file only ever has one buffer
+// appending to its journal
+func (w *Workspace) Open(path string) (b *Buffer, e error) {
+	var ok bool
+	if b, ok = w.Buffer(path); ok {
+		return
+	}
+	if path, e = filepath.Abs(path); E.Chk(e) {
+		return
+	}
+	b = NewBuffer()
+	if e = b.Open(path, w.Options); e != nil {
+		if ce := b.Close(); E.Chk(ce) {
+		}
+		return nil, e
+	}
+	w.buffers = append(w.buffers, b)
+	return
+}
+
+// Close closes an open buffer and removes it from the workspace
+func (w *Workspace) Close(b *Buffer) (e error) {
+	for i := range w.buffers {
+		if w.buffers[i] == b {
+			w.buffers = append(w.buffers[:i], w.buffers[i+1:]...)
+			return b.Close()
+		}
+	}
+	return ErrNotOpen
+}
+
+// CloseAll closes every open buffer, returning the first error
+func (w *Workspace) CloseAll() (e error) {
+	for _, b := range w.buffers {
+		if ce := b.Close(); E.Chk(ce) && e == nil {
+			e = ce
+		}
+	}
+	w.buffers = nil
+	return
+}
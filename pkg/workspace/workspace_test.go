@@ -0,0 +1,236 @@
+package workspace_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4"
+
+	"github.com/p9c/glom/pkg/annotate"
+	"github.com/p9c/glom/pkg/doc"
+	"github.com/p9c/glom/pkg/journal"
+	"github.com/p9c/glom/pkg/workspace"
+)
+
+// project creates a repository with ignored and kept files in a temporary directory
+func project(t *testing.T) (dir string, done func()) {
+	dir, e := ioutil.TempDir("", "glom")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e = git.PlainInit(dir, false); e != nil {
+		t.Fatal(e)
+	}
+	for path, content := range map[string]string{
+		".gitignore":         "*.log\nbuild/\n",
+		"main.go":            "package main\n\nfunc main() {}\n",
+		"debug.log":          "",
+		"build/main":         "",
+		"pkg/a/a.go":         "package a\n",
+		"pkg/a/.gitignore":   "secret.txt\n",
+		"pkg/a/secret.txt":   "",
+		"pkg/b/b.go":         "package b\n",
+		"pkg/b/secret.txt":   "",
+		"pkg/b/trace/x.log":  "",
+		"docs/README.md":     "# docs\n",
+		"docs/.git/ignore.x": "",
+	} {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if e = os.MkdirAll(filepath.Dir(path), 0755); e != nil {
+			t.Fatal(e)
+		}
+		if e = ioutil.WriteFile(path, []byte(content), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestTree(t *testing.T) {
+	dir, done := project(t)
+	defer done()
+	if root := workspace.Root(filepath.Join(dir, "pkg", "a", "a.go")); root != dir {
+		t.Errorf("root of a file in the repository is %q, want %q", root, dir)
+	}
+	w, e := workspace.Open(filepath.Join(dir, "pkg"), workspace.DefaultOptions())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if w.Repo == nil {
+		t.Error("the repository above the workspace was not found")
+	}
+	var tree *workspace.Entry
+	if tree, e = w.Tree(); e != nil {
+		t.Fatal(e)
+	}
+	var shown []string
+	tree.Walk(
+		func(en *workspace.Entry, depth int) bool {
+			shown = append(shown, strings.Repeat(" ", depth)+en.Name)
+			return true
+		},
+	)
+	want := "pkg\n a\n  .gitignore\n  a.go\n b\n  trace\n  b.go\n  secret.txt"
+	if got := strings.Join(shown, "\n"); got != want {
+		t.Errorf("tree is\n%s\nwant\n%s", got, want)
+	}
+	if w, e = workspace.Open(dir, workspace.DefaultOptions()); e != nil {
+		t.Fatal(e)
+	}
+	for path, ignored := range map[string]bool{
+		"main.go":            false,
+		"debug.log":          true,
+		"build/main":         true,
+		"pkg/a/secret.txt":   true,
+		"pkg/b/secret.txt":   false,
+		"docs/.git/ignore.x": true,
+	} {
+		if got := w.Ignored(filepath.Join(dir, filepath.FromSlash(path))); got != ignored {
+			t.Errorf("%s ignored is %v", path, got)
+		}
+	}
+}
+
+func TestBuffers(t *testing.T) {
+	dir, done := project(t)
+	defer done()
+	o := workspace.DefaultOptions()
+	o.JournalDir, o.FoldDir = filepath.Join(dir, "build", "journals"), filepath.Join(dir, "build", "folds")
+	w, e := workspace.Open(dir, o)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer w.CloseAll()
+	main, a := filepath.Join(dir, "main.go"), filepath.Join(dir, "pkg", "a", "a.go")
+	var bm, ba, again *workspace.Buffer
+	if bm, e = w.Open(main); e != nil {
+		t.Fatal(e)
+	}
+	if ba, e = w.Open(a); e != nil {
+		t.Fatal(e)
+	}
+	if again, e = w.Open(filepath.Join(dir, "pkg", "..", "main.go")); e != nil || again != bm {
+		t.Errorf("opening a file again gave another buffer, %v", e)
+	}
+	if bm.Doc.Text() != "package main\n\nfunc main() {}\n" || ba.Doc.Text() != "package a\n" {
+		t.Errorf("buffers hold %q and %q", bm.Doc.Text(), ba.Doc.Text())
+	}
+	if bm.Journal.Path() == ba.Journal.Path() || bm.Journal.Path() != journal.Path(o.JournalDir, main) {
+		t.Errorf("journals are %s and %s", bm.Journal.Path(), ba.Journal.Path())
+	}
+	if got := w.Rel(a); got != filepath.Join("pkg", "a", "a.go") {
+		t.Errorf("relative path is %q", got)
+	}
+	if e = w.Close(ba); e != nil || len(w.Buffers()) != 1 {
+		t.Errorf("closing left %d buffers, %v", len(w.Buffers()), e)
+	}
+	if e = w.Close(ba); e != workspace.ErrNotOpen {
+		t.Errorf("closing twice gave %v", e)
+	}
+}
+
+// TestReopen checks that the edits of a file survive closing and opening it again whether it was saved or not, and
+// that a change made to it outside of glom comes in as a new edit
+func TestReopen(t *testing.T) {
+	dir, done := project(t)
+	defer done()
+	o := workspace.DefaultOptions()
+	o.JournalDir, o.FoldDir = filepath.Join(dir, "build", "journals"), filepath.Join(dir, "build", "folds")
+	w, e := workspace.Open(dir, o)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer w.CloseAll()
+	path := filepath.Join(dir, "pkg", "a", "a.go")
+	reopen := func(b *workspace.Buffer, want string, nodes int) *workspace.Buffer {
+		t.Helper()
+		if b != nil {
+			if e := w.Close(b); e != nil {
+				t.Fatal(e)
+			}
+		}
+		if b, e = w.Open(path); e != nil {
+			t.Fatal(e)
+		}
+		if got := b.Doc.Text(); got != want || b.History.Len() != nodes {
+			t.Fatalf("reopened to %q with %d nodes, want %q with %d", got, b.History.Len(), want, nodes)
+		}
+		return b
+	}
+	b := reopen(nil, "package a\n", 2)
+	if _, e = b.History.Edit(func(d *doc.Document) error { return d.Insert(d.Len(), "\nvar x int\n") }); e != nil {
+		t.Fatal(e)
+	}
+	const edited = "package a\n\nvar x int\n"
+	b = reopen(b, edited, 3)
+	if e = b.Save(); e != nil {
+		t.Fatal(e)
+	}
+	if content, _ := ioutil.ReadFile(path); string(content) != edited {
+		t.Fatalf("saved %q", content)
+	}
+	// the file is replaced whole with the permissions it had, and nothing is left beside it
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+		t.Errorf("saved with mode %v", info.Mode())
+	}
+	if left, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp")); len(left) > 0 {
+		t.Errorf("saving left %v", left)
+	}
+	b = reopen(b, edited, 3)
+	if e = ioutil.WriteFile(path, []byte("package b\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	b = reopen(b, "package b\n", 4)
+	if e = b.History.Undo(); e != nil || b.Doc.Text() != edited {
+		t.Errorf("undoing the change from outside gave %q, %v", b.Doc.Text(), e)
+	}
+}
+
+// TestSaveNotes checks that saving writes the notes of a document to the sidecar of its file, which opening another
+// buffer of the file reads them from, and that the sidecar goes when the notes do
+func TestSaveNotes(t *testing.T) {
+	dir, done := project(t)
+	defer done()
+	o := workspace.DefaultOptions()
+	o.JournalDir, o.FoldDir = filepath.Join(dir, "build", "journals"), filepath.Join(dir, "build", "folds")
+	path := filepath.Join(dir, "main.go")
+	b := workspace.NewBuffer()
+	if e := b.Open(path, o); e != nil {
+		t.Fatal(e)
+	}
+	seg := b.Structure.EnclosingRange(14, 28)
+	if seg.Parent == nil {
+		t.Fatal("the function is not a segment")
+	}
+	if e := annotate.Set(b.History, seg, "n1", "the entry point"); e != nil {
+		t.Fatal(e)
+	}
+	if e := b.Save(); e != nil {
+		t.Fatal(e)
+	}
+	if e := b.Close(); e != nil {
+		t.Fatal(e)
+	}
+	// a buffer with another journal has the note only from the sidecar
+	o.JournalDir = filepath.Join(dir, "build", "other")
+	shared := workspace.NewBuffer()
+	if e := shared.Open(path, o); e != nil {
+		t.Fatal(e)
+	}
+	defer shared.Close()
+	if n, ok := shared.Doc.Note("n1"); !ok || n.Text != "the entry point" || n.Offset != seg.Start() {
+		t.Fatalf("the shared buffer has note %+v, %v", n, ok)
+	}
+	if e := annotate.Remove(shared.History, "n1"); e != nil {
+		t.Fatal(e)
+	}
+	if e := shared.SaveNotes(); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := os.Stat(annotate.SidecarPath(path)); !os.IsNotExist(e) {
+		t.Errorf("the sidecar of a file without notes is still there, %v", e)
+	}
+}